@@ -0,0 +1,623 @@
+package blobs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
+)
+
+// The magic bytes starting an archive, followed by a byte with the format
+// version.
+const archiveMagic = "fdb-blobs"
+
+const archiveVersion = 1
+
+// The maximum length of the header of an archived blob.
+const maxArchiveHeaderLen = 16 << 20
+
+// The number of blobs listed per transaction when exporting.
+const exportBatchSize = 100
+
+var invalidArchiveError = errors.New("invalid archive, the archive needs to be produced by the export method")
+
+// The header of an archived blob, it is followed by the content of the blob.
+type archiveEntry struct {
+	Id          Id                `json:"id"`
+	CreatedAt   int64             `json:"createdAt"`
+	Removed     bool              `json:"removed,omitempty"`
+	DeletedAt   int64             `json:"deletedAt,omitempty"`
+	ChunkSize   int               `json:"chunkSize"`
+	Len         int64             `json:"len"`
+	Checksum    []byte            `json:"checksum,omitempty"`
+	ContentType string            `json:"contentType,omitempty"`
+	Filename    string            `json:"filename,omitempty"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+}
+
+func (entry archiveEntry) metadata() Metadata {
+	metadata := Metadata{
+		ContentType: entry.ContentType,
+		Filename:    entry.Filename,
+		Attributes:  entry.Attributes,
+	}
+
+	if metadata.Attributes == nil {
+		metadata.Attributes = map[string]string{}
+	}
+
+	return metadata
+}
+
+// Export option type.
+type ExportOption func(export *exportOptions) error
+
+type exportOptions struct {
+	removed bool
+}
+
+// Includes the removed blobs that are not deleted yet in the archive, together
+// with the time they were removed at.
+func WithRemovedBlobs() ExportOption {
+	return func(export *exportOptions) error {
+		export.removed = true
+		return nil
+	}
+}
+
+// Writes all blobs of the store to w as an archive, that can be imported into
+// another store using [Store.Import].
+//
+// The archive starts with the magic bytes "fdb-blobs" followed by a byte with
+// the format version, which is 1. Each blob is written as a record holding a
+// big-endian uint32 length, a JSON header of that length with the id, creation
+// time, chunk size, length, checksum and metadata of the blob, followed by the
+// content of the blob. A record with a zero length ends the archive.
+//
+// The content is written decoded, so the archive doesn't depend on the
+// compression or encryption of the store. Notice that this means that archives
+// of encrypted stores contains the content in plain text. Named keys and
+// versions are not included.
+//
+// Each blob is read with a reader pinned to its length and checksum, so blobs
+// appended to while exporting are archived consistently.
+func (store *Store) Export(w io.Writer, opts ...ExportOption) error {
+	return store.ExportContext(context.Background(), w, opts...)
+}
+
+// Like [Store.Export], but stops exporting with the error of the context when it
+// is done.
+func (store *Store) ExportContext(ctx context.Context, w io.Writer, opts ...ExportOption) error {
+	options := &exportOptions{}
+
+	for _, opt := range opts {
+		err := opt(options)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := startArchive(w)
+	if err != nil {
+		return err
+	}
+
+	_, err = store.exportDir(ctx, w, store.blobsDir, false, nil)
+	if err != nil {
+		return err
+	}
+
+	if options.removed {
+		_, err = store.exportDir(ctx, w, store.removedDir, true, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	return endArchive(w)
+}
+
+func startArchive(w io.Writer) error {
+	_, err := w.Write(append([]byte(archiveMagic), archiveVersion))
+	return err
+}
+
+func endArchive(w io.Writer) error {
+	_, err := w.Write(make([]byte, 4))
+	return err
+}
+
+// Exports the blobs in the given directory committed in the given range of
+// versions, or all blobs if it is nil, listing a batch of blobs per
+// transaction. Returns the number of exported blobs.
+func (store *Store) exportDir(ctx context.Context, w io.Writer, dir directory.DirectorySubspace, removed bool, versions *versionRange) (int, error) {
+	options := &listOptions{limit: exportBatchSize}
+	exported := 0
+
+	for {
+		err := ctx.Err()
+		if err != nil {
+			return exported, err
+		}
+
+		var names []string
+
+		cursor, err := readTransact(store.db, func(tr fdb.ReadTransaction) (string, error) {
+			var cursor string
+			var err error
+
+			names, _, cursor, err = listPage(tr, dir, options)
+
+			return cursor, err
+		})
+
+		if err != nil {
+			return exported, err
+		}
+
+		for _, name := range names {
+			found, err := store.exportBlob(ctx, w, dir, Id(name), removed, versions)
+			if err != nil {
+				return exported, err
+			}
+
+			if found {
+				exported++
+			}
+		}
+
+		if cursor == "" {
+			return exported, nil
+		}
+
+		options.cursor = cursor
+	}
+}
+
+// Exports the blob with the given id, returns false if the blob wasn't committed
+// in the given range of versions or doesn't exist anymore.
+func (store *Store) exportBlob(ctx context.Context, w io.Writer, dir directory.DirectorySubspace, id Id, removed bool, versions *versionRange) (bool, error) {
+	var entry archiveEntry
+	var br *reader
+
+	found, err := readTransact(store.db, func(tr fdb.ReadTransaction) (bool, error) {
+		blobDir, err := dir.Open(tr, []string{string(id)}, nil)
+		if errors.Is(err, directory.ErrDirNotExists) {
+			// The blob was moved or deleted after it was listed
+			return false, nil
+		}
+
+		if err != nil {
+			return false, err
+		}
+
+		if versions != nil {
+			data, err := tr.Get(blobDir.Sub(committedVersionKey)).Get()
+			if err != nil {
+				return false, err
+			}
+
+			if !versions.includes(decodeCommittedVersion(data)) {
+				return false, nil
+			}
+		}
+
+		data, err := tr.Get(blobDir.Sub("createdAt")).Get()
+		if err != nil {
+			return false, err
+		}
+
+		createdAt := int64(decodeUInt64(data))
+
+		deletedAt := tr.Get(blobDir.Sub("deletedAt"))
+
+		blob, err := store.loadBlobTx(tr, blobDir)
+		if err != nil {
+			return false, err
+		}
+
+		br = blob.newReader(ctx)
+
+		pin, err := br.readPin(tr)
+		if err != nil {
+			return false, err
+		}
+		br.setPin(pin)
+
+		metadata, err := readMetadata(tr, blobDir)
+		if err != nil {
+			return false, err
+		}
+
+		entry = archiveEntry{
+			Id:          id,
+			CreatedAt:   createdAt,
+			Removed:     removed,
+			ChunkSize:   blob.chunkSize,
+			Len:         pin.len,
+			Checksum:    pin.checksum,
+			ContentType: metadata.ContentType,
+			Filename:    metadata.Filename,
+			Attributes:  metadata.Attributes,
+		}
+
+		if removed {
+			data, err := deletedAt.Get()
+			if err != nil {
+				return false, err
+			}
+			entry.DeletedAt = int64(decodeUInt64(data))
+		}
+
+		return true, nil
+	})
+
+	if err != nil || !found {
+		return false, err
+	}
+
+	header, err := json.Marshal(entry)
+	if err != nil {
+		return false, err
+	}
+
+	record := binary.BigEndian.AppendUint32(nil, uint32(len(header)))
+
+	_, err = w.Write(append(record, header...))
+	if err != nil {
+		return false, err
+	}
+
+	// The reader verifies the content against the pinned checksum
+	_, err = io.Copy(w, br)
+
+	return err == nil, err
+}
+
+// Reads the header of the next archived blob, returns nil at the end of the
+// archive.
+func readArchiveEntry(r io.Reader) (*archiveEntry, error) {
+	var length [4]byte
+
+	_, err := io.ReadFull(r, length[:])
+	if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	headerLen := binary.BigEndian.Uint32(length[:])
+	if headerLen == 0 {
+		return nil, nil
+	}
+
+	if headerLen > maxArchiveHeaderLen {
+		return nil, invalidArchiveError
+	}
+
+	header := make([]byte, headerLen)
+
+	_, err = io.ReadFull(r, header)
+	if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var entry archiveEntry
+
+	err = json.Unmarshal(header, &entry)
+	if err != nil || entry.Id == "" || entry.Len < 0 {
+		return nil, invalidArchiveError
+	}
+
+	// The chunk size decides the buffers allocated when importing the blob
+	if entry.ChunkSize < 1 || entry.ChunkSize > maxValueSize {
+		return nil, invalidArchiveError
+	}
+
+	if entry.Checksum != nil && len(entry.Checksum) != sha256.Size {
+		return nil, invalidArchiveError
+	}
+
+	return &entry, nil
+}
+
+// Reads an archive written by [Store.Export] from r and creates the archived
+// blobs in the store. Returns the ids of the imported blobs.
+//
+// The blobs keep their ids, creation times, chunk sizes and metadata, and are
+// stored using the compression, deduplication and encryption of the store. The
+// content is verified against the archived checksums, and a [CorruptBlobError]
+// is returned on mismatch.
+//
+// Importing is idempotent, blobs that already exists in the store, or have been
+// removed from it, are skipped. An import that fails can be restarted with the
+// same archive, the blob that was being imported is resumed where it stopped.
+func (store *Store) Import(r io.Reader) ([]Id, error) {
+	return store.ImportContext(context.Background(), r)
+}
+
+// Like [Store.Import], but stops importing with the error of the context when it
+// is done. Blobs imported before the context was done stay imported.
+func (store *Store) ImportContext(ctx context.Context, r io.Reader) ([]Id, error) {
+	return store.importArchive(ctx, r, false)
+}
+
+// Imports the archive read from r. Existing blobs are replaced by archived blobs
+// of another length or checksum when replace is true, otherwise they are
+// skipped.
+func (store *Store) importArchive(ctx context.Context, r io.Reader, replace bool) ([]Id, error) {
+	var imported []Id
+
+	magic := make([]byte, len(archiveMagic)+1)
+
+	_, err := io.ReadFull(r, magic)
+	if err != nil || string(magic[:len(archiveMagic)]) != archiveMagic {
+		return nil, invalidArchiveError
+	}
+
+	if version := magic[len(archiveMagic)]; version != archiveVersion {
+		return nil, fmt.Errorf("unsupported archive version %d", version)
+	}
+
+	for {
+		err := ctx.Err()
+		if err != nil {
+			return imported, err
+		}
+
+		entry, err := readArchiveEntry(r)
+		if err != nil || entry == nil {
+			return imported, err
+		}
+
+		ok, err := store.importBlob(ctx, io.LimitReader(r, entry.Len), *entry, replace)
+		if err != nil {
+			return imported, err
+		}
+
+		if ok {
+			imported = append(imported, entry.Id)
+		}
+	}
+}
+
+// Skips n bytes of the content of an archived blob.
+func skipContent(content io.Reader, n int64) error {
+	skipped, err := io.CopyN(io.Discard, content, n)
+	if err == io.EOF || skipped < n {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
+
+// Imports the archived blob with the content read from content, returns false
+// if the blob already exists and isn't replaced.
+func (store *Store) importBlob(ctx context.Context, content io.Reader, entry archiveEntry, replace bool) (bool, error) {
+	id := entry.Id
+
+	exists, err := readTransact(store.db, func(tr fdb.ReadTransaction) (bool, error) {
+		blobDir, err := store.blobsDir.Open(tr, []string{string(id)}, nil)
+		if errors.Is(err, directory.ErrDirNotExists) {
+			return store.removedDir.Exists(tr, []string{string(id)})
+		}
+
+		if err != nil || !replace {
+			return err == nil, err
+		}
+
+		changed, err := store.archivedBlobChanged(tr, blobDir, entry)
+
+		return !changed, err
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	if exists {
+		return false, skipContent(content, entry.Len)
+	}
+
+	if entry.ChunkSize > store.maxChunkSize() {
+		return false, fmt.Errorf("%w: the blob %q has chunks of %d bytes, the store can write chunks of at most %d bytes", ChunkTooLargeError, id, entry.ChunkSize, store.maxChunkSize())
+	}
+
+	if store.quota != 0 && uint64(entry.Len) > store.quota {
+		return false, fmt.Errorf("%w: the blob %q of %d bytes exceeds the quota of %d bytes", QuotaExceededError, id, entry.Len, store.quota)
+	}
+
+	token, written, err := store.resumeImport(entry)
+	if err != nil {
+		return false, err
+	}
+
+	err = skipContent(content, int64(written))
+	if err != nil {
+		return false, err
+	}
+
+	written, err = store.append(ctx, id, token.dir, content, false)
+	if err != nil {
+		// The upload is kept, so the import can be resumed
+		return false, err
+	}
+
+	if int64(written) < entry.Len {
+		return false, io.ErrUnexpectedEOF
+	}
+
+	checksum, err := readTransact(store.db, func(tr fdb.ReadTransaction) ([]byte, error) {
+		checksum := tr.Get(token.dir.Sub("checksum"))
+
+		enc, err := store.readChunkEncoding(tr, token.dir)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := checksum.Get()
+		if err != nil {
+			return nil, err
+		}
+
+		return enc.openValue(id, "checksum", data)
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	if entry.Checksum != nil && !bytes.Equal(checksum, entry.Checksum) {
+		return false, store.abortFailedUpload(token, fmt.Errorf("%w: checksum mismatch for %q", CorruptBlobError, id))
+	}
+
+	var releasing bool
+
+	err = updateTransact(store.db, func(tr fdb.Transaction) error {
+		var err error
+
+		releasing = false
+		if replace {
+			releasing, err = store.deleteReplacedBlob(tr, id)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = store.CommitUpload(tr, token)
+		if err != nil {
+			return err
+		}
+
+		// The blob keeps its creation time from the archive
+		tr.Set(token.dir.Sub("createdAt"), encodeUInt64(uint64(entry.CreatedAt)))
+
+		if entry.Removed {
+			return store.removeBlobTx(tr, id, entry.DeletedAt)
+		}
+
+		return nil
+	})
+
+	if err != nil || !releasing {
+		return err == nil, err
+	}
+
+	// A release that fails is continued by the next cleanup
+	return true, store.releaseDeletedChunks(ctx)
+}
+
+// Returns true if the length or checksum of the blob stored in the given
+// directory differs from the archived blob.
+func (store *Store) archivedBlobChanged(tr fdb.ReadTransaction, blobDir directory.DirectorySubspace, entry archiveEntry) (bool, error) {
+	checksumFuture := tr.Get(blobDir.Sub("checksum"))
+
+	length, err := readLen(tr, blobDir)
+	if err != nil {
+		return false, err
+	}
+
+	if length != entry.Len {
+		return true, nil
+	}
+
+	enc, err := store.readChunkEncoding(tr, blobDir)
+	if err != nil {
+		return false, err
+	}
+
+	data, err := checksumFuture.Get()
+	if err != nil {
+		return false, err
+	}
+
+	checksum, err := enc.openValue(entry.Id, "checksum", data)
+	if err != nil {
+		return false, err
+	}
+
+	return !bytes.Equal(checksum, entry.Checksum), nil
+}
+
+// Deletes the blob with the given id, if it exists, so it can be replaced by an
+// archived blob. Returns true if the chunks of the blob are left to be released
+// by [Store.releaseDeletedChunks].
+//
+// Keys naming the blob are kept, so they name the archived blob.
+func (store *Store) deleteReplacedBlob(tr fdb.Transaction, id Id) (bool, error) {
+	blobDir, err := store.blobsDir.Open(tr, []string{string(id)}, nil)
+	if errors.Is(err, directory.ErrDirNotExists) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	length, err := readLen(tr, blobDir)
+	if err != nil {
+		return false, err
+	}
+
+	store.addUsage(tr, bytesCounter, -length)
+	store.addUsage(tr, blobsCounter, -1)
+
+	return store.deleteEntry(tr, store.blobsDir, blobDir, id)
+}
+
+// Returns the upload of an archived blob and the number of bytes uploaded to it.
+//
+// An upload left by an earlier import of the blob is resumed, unless it doesn't
+// fit the archived blob, then it is started over.
+func (store *Store) resumeImport(entry archiveEntry) (UploadToken, uint64, error) {
+	token, err := store.ParseUploadToken([]byte(entry.Id))
+
+	if err == nil {
+		var enc chunkEncoding
+		var written int64
+
+		_, err = readTransact(store.db, func(tr fdb.ReadTransaction) (any, error) {
+			var err error
+
+			enc, err = store.readChunkEncoding(tr, token.dir)
+			if err != nil {
+				return nil, err
+			}
+
+			written, err = readLen(tr, token.dir)
+
+			return nil, err
+		})
+
+		if err != nil {
+			return token, 0, err
+		}
+
+		if enc.chunkSize == entry.ChunkSize && written <= entry.Len {
+			return token, uint64(written), nil
+		}
+
+		err = store.AbortUpload(token)
+	}
+
+	if err != nil && !errors.Is(err, UploadNotFoundError) {
+		return token, 0, err
+	}
+
+	token, err = store.startUpload(entry.Id, entry.ChunkSize, entry.metadata())
+
+	return token, 0, err
+}
@@ -0,0 +1,155 @@
+package blobs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestExportImport(t *testing.T) {
+	date, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+	input := strings.Repeat("content ", 100)
+
+	st := &SystemTimeMock{Time: date}
+	src := createTestStore(WithChunkSize(100), WithChunksPerTransaction(2), WithSystemTime(st))
+
+	blob, err := src.Create(strings.NewReader(input), WithFilename("doc.txt"), WithAttribute("kind", "draft"))
+	assert.NoError(t, err)
+
+	removed, err := src.Create(strings.NewReader("removed"))
+	assert.NoError(t, err)
+	st.Time = date.Add(time.Hour)
+	err = src.RemoveBlob(removed.Id())
+	assert.NoError(t, err)
+
+	var archive bytes.Buffer
+	err = src.Export(&archive, WithRemovedBlobs())
+	assert.NoError(t, err)
+
+	t.Run("imports the blobs with their ids, creation times and metadata", func(t *testing.T) {
+		dst := createTestStore(WithCompression(GzipCodec{}))
+
+		imported, err := dst.Import(bytes.NewReader(archive.Bytes()))
+		assert.NoError(t, err)
+		assert.Equal(t, []Id{blob.Id(), removed.Id()}, imported)
+
+		assert.Equal(t, input, readBlob(t, dst, blob.Id()))
+
+		copied, err := dst.Blob(blob.Id())
+		assert.NoError(t, err)
+		assert.Equal(t, 100, copied.ChunkSize())
+
+		createdAt, err := copied.CreatedAt()
+		assert.NoError(t, err)
+		assert.Equal(t, date, createdAt.UTC())
+
+		metadata, err := copied.Metadata()
+		assert.NoError(t, err)
+		assert.Equal(t, "doc.txt", metadata.Filename)
+		assert.Equal(t, map[string]string{"kind": "draft"}, metadata.Attributes)
+
+		_, err = dst.Blob(removed.Id())
+		assert.True(t, errors.Is(err, BlobNotFoundError))
+
+		err = dst.RestoreBlob(removed.Id())
+		assert.NoError(t, err)
+		assert.Equal(t, "removed", readBlob(t, dst, removed.Id()))
+	})
+
+	t.Run("skips blobs that are already imported", func(t *testing.T) {
+		dst := createTestStore()
+
+		_, err := dst.Import(bytes.NewReader(archive.Bytes()))
+		assert.NoError(t, err)
+
+		imported, err := dst.Import(bytes.NewReader(archive.Bytes()))
+		assert.NoError(t, err)
+		assert.Equal(t, 0, len(imported))
+
+		usage, err := dst.Usage()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), usage.Blobs)
+	})
+
+	t.Run("resumes an interrupted import", func(t *testing.T) {
+		dst := createTestStore()
+
+		// Cut the archive in the middle of the content of the first blob
+		truncated := archive.Bytes()[:archive.Len()/2]
+
+		imported, err := dst.Import(bytes.NewReader(truncated))
+		assert.Equal(t, io.ErrUnexpectedEOF, err)
+		assert.Equal(t, 0, len(imported))
+
+		imported, err = dst.Import(bytes.NewReader(archive.Bytes()))
+		assert.NoError(t, err)
+		assert.Equal(t, []Id{blob.Id(), removed.Id()}, imported)
+
+		assert.Equal(t, input, readBlob(t, dst, blob.Id()))
+	})
+
+	t.Run("leaves out removed blobs by default", func(t *testing.T) {
+		var archive bytes.Buffer
+		err := src.Export(&archive)
+		assert.NoError(t, err)
+
+		dst := createTestStore()
+
+		imported, err := dst.Import(&archive)
+		assert.NoError(t, err)
+		assert.Equal(t, []Id{blob.Id()}, imported)
+	})
+
+	t.Run("rejects invalid archives", func(t *testing.T) {
+		dst := createTestStore()
+
+		_, err := dst.Import(strings.NewReader("not an archive"))
+		assert.EqualError(t, err, "invalid archive, the archive needs to be produced by the export method")
+	})
+
+	t.Run("rejects archived blobs with chunk sizes above the maximum", func(t *testing.T) {
+		dst := createTestStore()
+
+		_, err := dst.Import(testArchive(`{"id":"huge","chunkSize":1000000000,"len":10}`))
+		assert.EqualError(t, err, "invalid archive, the archive needs to be produced by the export method")
+	})
+
+	t.Run("rejects archived blobs with chunks too large for encrypted stores", func(t *testing.T) {
+		dst := createTestStore(WithEncryption(&AESKeyProvider{
+			Keys:         map[string][]byte{"key-1": testKey(t)},
+			CurrentKeyId: "key-1",
+		}))
+
+		_, err := dst.Import(testArchive(`{"id":"large","chunkSize":100000,"len":10}`))
+		assert.True(t, errors.Is(err, ChunkTooLargeError))
+
+		_, err = dst.ParseUploadToken([]byte("large"))
+		assert.True(t, errors.Is(err, UploadNotFoundError))
+	})
+
+	t.Run("rejects archived blobs exceeding the quota before importing them", func(t *testing.T) {
+		dst := createTestStore(WithQuota(100))
+
+		_, err := dst.Import(testArchive(`{"id":"huge","chunkSize":10,"len":1000000000000}`))
+		assert.True(t, errors.Is(err, QuotaExceededError))
+
+		_, err = dst.ParseUploadToken([]byte("huge"))
+		assert.True(t, errors.Is(err, UploadNotFoundError))
+	})
+}
+
+// Returns an archive with a blob with the given header and no content.
+func testArchive(header string) io.Reader {
+	var archive bytes.Buffer
+	archive.WriteString(archiveMagic)
+	archive.WriteByte(archiveVersion)
+	_ = binary.Write(&archive, binary.BigEndian, uint32(len(header)))
+	archive.WriteString(header)
+	return &archive
+}
@@ -0,0 +1,529 @@
+package blobs
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
+)
+
+// The name of the manifest listing the backups of a backup directory.
+const backupManifestName = "manifest.json"
+
+const backupManifestVersion = 1
+
+// The key of a blob holding the versionstamp of the transaction that committed
+// it to the blobs directory.
+const committedVersionKey = "committedVersion"
+
+// Records the commit version of the transaction in the given blob directory.
+func setCommittedVersion(tr fdb.Transaction, blobDir subspace.Subspace) {
+	// The value is the versionstamp followed by its offset in the value
+	tr.SetVersionstampedValue(blobDir.Sub(committedVersionKey), make([]byte, 10+4))
+}
+
+// Returns the commit version of a recorded versionstamp, or zero for blobs
+// committed before the versions were recorded.
+func decodeCommittedVersion(data []byte) int64 {
+	if len(data) < 8 {
+		return 0
+	}
+
+	return int64(binary.BigEndian.Uint64(data))
+}
+
+// A range of commit versions, from after since to until.
+type versionRange struct {
+	since int64
+	until int64
+}
+
+func (versions versionRange) includes(version int64) bool {
+	if version == 0 {
+		// Blobs committed before the versions were recorded belong to the
+		// first backup
+		return versions.since == 0
+	}
+
+	return versions.since < version && version <= versions.until
+}
+
+// Information about a backup in a backup chain.
+type BackupInfo struct {
+	// The position of the backup in the chain, backups are numbered from 1 and
+	// up.
+	Sequence int
+	// The time the previous backup started at, blobs removed at or after this
+	// time are recorded. This is the zero unix time for the first backup.
+	Since time.Time
+	// The time the backup started at.
+	Until time.Time
+	// The database version the previous backup started at, blobs committed
+	// after this version are included. This is zero for the first backup.
+	SinceVersion int64
+	// The database version the backup started at.
+	UntilVersion int64
+	// The number of blobs included.
+	Blobs int
+	// The number of blobs recorded as removed.
+	Removed int
+	// The number of removed blobs recorded as restored.
+	Restored int
+}
+
+// The manifest of a backup directory.
+type backupManifest struct {
+	Version int           `json:"version"`
+	Backups []backupEntry `json:"backups"`
+}
+
+// A backup listed in the manifest.
+type backupEntry struct {
+	Sequence     int    `json:"sequence"`
+	Since        int64  `json:"since"`
+	Until        int64  `json:"until"`
+	SinceVersion int64  `json:"sinceVersion"`
+	UntilVersion int64  `json:"untilVersion"`
+	Archive      string `json:"archive"`
+	Tombstones   string `json:"tombstones"`
+	Blobs        int    `json:"blobs"`
+	Removed      int    `json:"removed"`
+	Restored     int    `json:"restored"`
+}
+
+func (entry backupEntry) info() BackupInfo {
+	return BackupInfo{
+		Sequence:     entry.Sequence,
+		Since:        time.Unix(entry.Since, 0),
+		Until:        time.Unix(entry.Until, 0),
+		SinceVersion: entry.SinceVersion,
+		UntilVersion: entry.UntilVersion,
+		Blobs:        entry.Blobs,
+		Removed:      entry.Removed,
+		Restored:     entry.Restored,
+	}
+}
+
+// A blob removed from the store.
+type tombstone struct {
+	Id        Id    `json:"id"`
+	DeletedAt int64 `json:"deletedAt"`
+}
+
+// The changes to blobs created before a backup, recorded with the backup.
+type backupTombstones struct {
+	// Blobs removed since the previous backup.
+	Removed []tombstone `json:"removed"`
+	// Blobs removed in earlier backups, that have been restored since.
+	Restored []Id `json:"restored"`
+}
+
+func readBackupManifest(dir string) (backupManifest, error) {
+	manifest := backupManifest{Version: backupManifestVersion}
+
+	data, err := os.ReadFile(filepath.Join(dir, backupManifestName))
+	if errors.Is(err, os.ErrNotExist) {
+		return manifest, nil
+	}
+
+	if err != nil {
+		return manifest, err
+	}
+
+	err = json.Unmarshal(data, &manifest)
+	if err != nil {
+		return manifest, fmt.Errorf("invalid backup manifest: %w", err)
+	}
+
+	if manifest.Version != backupManifestVersion {
+		return manifest, fmt.Errorf("unsupported backup manifest version %d", manifest.Version)
+	}
+
+	return manifest, nil
+}
+
+func readBackupTombstones(dir string, entry backupEntry) (backupTombstones, error) {
+	var tombstones backupTombstones
+
+	data, err := os.ReadFile(filepath.Join(dir, entry.Tombstones))
+	if err != nil {
+		return tombstones, err
+	}
+
+	err = json.Unmarshal(data, &tombstones)
+
+	return tombstones, err
+}
+
+// Writes a file by writing to a temporary file in the same directory, and
+// renaming it when it is written, so a failed write leaves no partial file.
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	file, err := os.CreateTemp(filepath.Dir(path), ".tmp-"+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	w := bufio.NewWriter(file)
+
+	err = write(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+
+	closeErr := file.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+
+	return os.Rename(file.Name(), path)
+}
+
+func writeJSONFileAtomic(path string, value any) error {
+	return writeFileAtomic(path, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	})
+}
+
+// Writes an incremental backup of the store to the given directory on the
+// local filesystem, and returns information about the backup.
+//
+// The directory holds a chain of backups listed in the manifest.json file. The
+// first backup in a directory includes all blobs, and each following backup
+// includes the blobs committed since the high-water mark of the previous backup,
+// which is the database version it started at. The blobs are selected by the
+// version of the transaction committing them, so blobs imported, restored or
+// committed while a backup runs are included by the next backup, no matter
+// when they were created. Each backup consists of an archive in the format
+// written by [Store.Export], and a tombstones file listing the blobs removed
+// since the previous backup, and the removed blobs that have been restored.
+//
+// Removed blobs are found using the time they were removed at, so blobs that
+// are removed and deleted between two backups aren't recorded. Run backups more
+// often than removed blobs are deleted to record every removal. Appending to or
+// truncating a blob records a new commit version, so the blob is included again
+// by the next backup.
+//
+// The files of a backup are written before the manifest is updated, so a failed
+// backup leaves the chain as it was and can be run again.
+func (store *Store) Backup(dir string) (BackupInfo, error) {
+	return store.BackupContext(context.Background(), dir)
+}
+
+// Like [Store.Backup], but stops the backup with the error of the context when
+// it is done.
+func (store *Store) BackupContext(ctx context.Context, dir string) (BackupInfo, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return BackupInfo{}, err
+	}
+
+	manifest, err := readBackupManifest(dir)
+	if err != nil {
+		return BackupInfo{}, err
+	}
+
+	untilVersion, err := readTransact(store.db, func(tr fdb.ReadTransaction) (int64, error) {
+		return tr.GetReadVersion().Get()
+	})
+
+	if err != nil {
+		return BackupInfo{}, err
+	}
+
+	entry := backupEntry{
+		Sequence:     1,
+		Until:        store.systemTime.Now().Unix(),
+		UntilVersion: untilVersion,
+	}
+
+	if n := len(manifest.Backups); n > 0 {
+		previous := manifest.Backups[n-1]
+		entry.Sequence = previous.Sequence + 1
+		entry.Since = previous.Until
+		entry.SinceVersion = previous.UntilVersion
+	}
+
+	name := fmt.Sprintf("backup-%06d", entry.Sequence)
+	entry.Archive = name + ".archive"
+	entry.Tombstones = name + ".tombstones"
+
+	// Removals are recorded first, so blobs removed while the backup runs are
+	// recorded by the next backup
+	var tombstones backupTombstones
+
+	tombstones.Removed, err = store.removedBetween(ctx, entry.Since, entry.Until)
+	if err != nil {
+		return BackupInfo{}, err
+	}
+
+	tombstones.Restored, err = store.restoredSince(ctx, dir, manifest)
+	if err != nil {
+		return BackupInfo{}, err
+	}
+
+	entry.Removed = len(tombstones.Removed)
+	entry.Restored = len(tombstones.Restored)
+
+	err = writeFileAtomic(filepath.Join(dir, entry.Archive), func(w io.Writer) error {
+		err := startArchive(w)
+		if err != nil {
+			return err
+		}
+
+		versions := &versionRange{since: entry.SinceVersion, until: entry.UntilVersion}
+
+		entry.Blobs, err = store.exportDir(ctx, w, store.blobsDir, false, versions)
+		if err != nil {
+			return err
+		}
+
+		return endArchive(w)
+	})
+
+	if err != nil {
+		return BackupInfo{}, err
+	}
+
+	err = writeJSONFileAtomic(filepath.Join(dir, entry.Tombstones), tombstones)
+	if err != nil {
+		return BackupInfo{}, err
+	}
+
+	manifest.Backups = append(manifest.Backups, entry)
+
+	err = writeJSONFileAtomic(filepath.Join(dir, backupManifestName), manifest)
+	if err != nil {
+		return BackupInfo{}, err
+	}
+
+	return entry.info(), nil
+}
+
+// Returns the blobs removed at or after the since unix timestamp and before the
+// until unix timestamp, using the cleanup index of removed blobs.
+func (store *Store) removedBetween(ctx context.Context, since, until int64) ([]tombstone, error) {
+	err := store.buildCleanupIndexes(ctx, exportBatchSize)
+	if err != nil {
+		return nil, err
+	}
+
+	indexSubspace := store.cleanupDir.Sub(removedIndex)
+	keyRange := fdb.SelectorRange{
+		Begin: fdb.FirstGreaterOrEqual(indexSubspace.Sub(since)),
+		End:   fdb.FirstGreaterOrEqual(indexSubspace.Sub(until)),
+	}
+
+	tombstones := []tombstone{}
+
+	for {
+		err := ctx.Err()
+		if err != nil {
+			return tombstones, err
+		}
+
+		entries, err := readTransact(store.db, func(tr fdb.ReadTransaction) ([]fdb.KeyValue, error) {
+			return tr.GetRange(keyRange, fdb.RangeOptions{Limit: exportBatchSize}).GetSliceWithError()
+		})
+
+		if err != nil {
+			return tombstones, err
+		}
+
+		for _, entry := range entries {
+			t, err := indexSubspace.Unpack(entry.Key)
+			if err != nil {
+				return tombstones, err
+			}
+
+			tombstones = append(tombstones, tombstone{Id: Id(t[1].(string)), DeletedAt: t[0].(int64)})
+		}
+
+		if len(entries) < exportBatchSize {
+			return tombstones, nil
+		}
+
+		keyRange.Begin = fdb.FirstGreaterThan(entries[len(entries)-1].Key)
+	}
+}
+
+// Returns the blobs that are removed according to the backup chain in the
+// given manifest, but exists in the store again.
+func (store *Store) restoredSince(ctx context.Context, dir string, manifest backupManifest) ([]Id, error) {
+	removed := map[Id]bool{}
+
+	for _, entry := range manifest.Backups {
+		tombstones, err := readBackupTombstones(dir, entry)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, id := range tombstones.Restored {
+			delete(removed, id)
+		}
+
+		for _, tombstone := range tombstones.Removed {
+			removed[tombstone.Id] = true
+		}
+	}
+
+	ids := make([]Id, 0, len(removed))
+	for id := range removed {
+		ids = append(ids, id)
+	}
+
+	restored := []Id{}
+
+	for start := 0; start < len(ids); start += exportBatchSize {
+		err := ctx.Err()
+		if err != nil {
+			return restored, err
+		}
+
+		end := start + exportBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		batch, err := readTransact(store.db, func(tr fdb.ReadTransaction) ([]Id, error) {
+			var batch []Id
+
+			for _, id := range ids[start:end] {
+				exists, err := store.blobsDir.Exists(tr, []string{string(id)})
+				if err != nil {
+					return nil, err
+				}
+
+				if exists {
+					batch = append(batch, id)
+				}
+			}
+
+			return batch, nil
+		})
+
+		if err != nil {
+			return restored, err
+		}
+
+		restored = append(restored, batch...)
+	}
+
+	return restored, nil
+}
+
+// Restores the blobs of the backup chain in the given directory into the
+// store, and returns information about the restored backups.
+//
+// The backups are applied in order, importing the archive of each backup like
+// [Store.Import] before removing and restoring the blobs listed in its
+// tombstones file. Unlike [Store.Import], existing blobs of another length or
+// checksum than the archived blob are replaced, so blobs appended to or
+// truncated between backups are restored with their latest content. Blobs keep
+// the time they were removed at, so they are deleted like any other removed
+// blob.
+//
+// Restoring is idempotent, so a failed restore can be run again.
+func (store *Store) RestoreBackup(dir string) ([]BackupInfo, error) {
+	return store.RestoreBackupContext(context.Background(), dir)
+}
+
+// Like [Store.RestoreBackup], but stops restoring with the error of the context
+// when it is done.
+func (store *Store) RestoreBackupContext(ctx context.Context, dir string) ([]BackupInfo, error) {
+	manifest, err := readBackupManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(manifest.Backups) == 0 {
+		return nil, fmt.Errorf("no backups found in %q", dir)
+	}
+
+	var restored []BackupInfo
+
+	for _, entry := range manifest.Backups {
+		err := store.restoreBackupEntry(ctx, dir, entry)
+		if err != nil {
+			return restored, err
+		}
+
+		restored = append(restored, entry.info())
+	}
+
+	return restored, nil
+}
+
+func (store *Store) restoreBackupEntry(ctx context.Context, dir string, entry backupEntry) error {
+	tombstones, err := readBackupTombstones(dir, entry)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(filepath.Join(dir, entry.Archive))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Blobs restored since the previous backup are restored before the archive
+	// is imported, so blobs modified after they were restored are compared to
+	// the restored blob and replaced
+	for _, id := range tombstones.Restored {
+		err := store.RestoreBlobContext(ctx, id)
+		if err != nil && !errors.Is(err, BlobNotFoundError) {
+			return err
+		}
+	}
+
+	_, err = store.importArchive(ctx, bufio.NewReader(file), true)
+	if err != nil {
+		return err
+	}
+
+	for start := 0; start < len(tombstones.Removed); start += exportBatchSize {
+		err := ctx.Err()
+		if err != nil {
+			return err
+		}
+
+		end := start + exportBatchSize
+		if end > len(tombstones.Removed) {
+			end = len(tombstones.Removed)
+		}
+
+		err = updateTransact(store.db, func(tr fdb.Transaction) error {
+			for _, tombstone := range tombstones.Removed[start:end] {
+				err := store.removeBlobTx(tr, tombstone.Id, tombstone.DeletedAt)
+				if err != nil && !errors.Is(err, BlobNotFoundError) {
+					return err
+				}
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
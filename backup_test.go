@@ -0,0 +1,255 @@
+package blobs
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestBackup(t *testing.T) {
+	date, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+
+	st := &SystemTimeMock{Time: date}
+	store := createTestStore(WithChunkSize(100), WithSystemTime(st))
+	dir := t.TempDir()
+
+	a, err := store.Create(strings.NewReader("a"))
+	assert.NoError(t, err)
+	b, err := store.Create(strings.NewReader("b"))
+	assert.NoError(t, err)
+
+	t.Run("the first backup includes all blobs", func(t *testing.T) {
+		st.Time = date.Add(time.Minute)
+
+		info, err := store.Backup(dir)
+		assert.NoError(t, err)
+		assert.NotZero(t, info.UntilVersion)
+		assert.Equal(t, BackupInfo{
+			Sequence:     1,
+			Since:        time.Unix(0, 0),
+			Until:        time.Unix(date.Add(time.Minute).Unix(), 0),
+			UntilVersion: info.UntilVersion,
+			Blobs:        2,
+		}, info)
+	})
+
+	var c *Blob
+
+	t.Run("later backups includes the blobs created and removed since", func(t *testing.T) {
+		st.Time = date.Add(time.Hour)
+
+		c, err = store.Create(strings.NewReader("c"))
+		assert.NoError(t, err)
+		err = store.RemoveBlob(a.Id())
+		assert.NoError(t, err)
+
+		st.Time = date.Add(2 * time.Hour)
+
+		info, err := store.Backup(dir)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, info.Sequence)
+		assert.Equal(t, 1, info.Blobs)
+		assert.Equal(t, 1, info.Removed)
+
+		restored := createTestStore()
+
+		infos, err := restored.RestoreBackup(dir)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(infos))
+
+		assert.Equal(t, "b", readBlob(t, restored, b.Id()))
+		assert.Equal(t, "c", readBlob(t, restored, c.Id()))
+
+		_, err = restored.Blob(a.Id())
+		assert.True(t, errors.Is(err, BlobNotFoundError))
+
+		// The removed blob keeps the time it was removed at
+		deleted, err := restored.DeleteRemovedBlobsBefore(date.Add(time.Hour))
+		assert.NoError(t, err)
+		assert.Equal(t, 0, len(deleted))
+
+		deleted, err = restored.DeleteRemovedBlobsBefore(date.Add(time.Hour + time.Second))
+		assert.NoError(t, err)
+		assert.Equal(t, []Id{a.Id()}, deleted)
+	})
+
+	t.Run("records removed blobs that are restored", func(t *testing.T) {
+		st.Time = date.Add(3 * time.Hour)
+
+		err := store.RestoreBlob(a.Id())
+		assert.NoError(t, err)
+
+		st.Time = date.Add(4 * time.Hour)
+
+		info, err := store.Backup(dir)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, info.Sequence)
+		assert.Equal(t, 1, info.Restored)
+		// Restored blobs are committed again, so blobs removed before they
+		// were backed up are included too
+		assert.Equal(t, 1, info.Blobs)
+
+		restored := createTestStore()
+
+		_, err = restored.RestoreBackup(dir)
+		assert.NoError(t, err)
+
+		assert.Equal(t, "a", readBlob(t, restored, a.Id()))
+		assert.Equal(t, "b", readBlob(t, restored, b.Id()))
+		assert.Equal(t, "c", readBlob(t, restored, c.Id()))
+
+		// Restoring again doesn't change anything
+		_, err = restored.RestoreBackup(dir)
+		assert.NoError(t, err)
+
+		usage, err := restored.Usage()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), usage.Blobs)
+	})
+
+	t.Run("includes blobs imported since the previous backup", func(t *testing.T) {
+		store := createTestStore(WithSystemTime(st))
+		dir := t.TempDir()
+
+		st.Time = date.Add(5 * time.Hour)
+
+		_, err := store.Backup(dir)
+		assert.NoError(t, err)
+
+		// The imported blob keeps the creation time from before the backup
+		src := createTestStore(WithSystemTime(&SystemTimeMock{Time: date}))
+		imported, err := src.Create(strings.NewReader("imported"))
+		assert.NoError(t, err)
+
+		var archive bytes.Buffer
+		err = src.Export(&archive)
+		assert.NoError(t, err)
+
+		_, err = store.Import(&archive)
+		assert.NoError(t, err)
+
+		info, err := store.Backup(dir)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, info.Sequence)
+		assert.Equal(t, 1, info.Blobs)
+
+		restored := createTestStore()
+
+		_, err = restored.RestoreBackup(dir)
+		assert.NoError(t, err)
+
+		assert.Equal(t, "imported", readBlob(t, restored, imported.Id()))
+	})
+
+	t.Run("includes blobs committed with a clock behind the previous backup", func(t *testing.T) {
+		store := createTestStore(WithSystemTime(st))
+		dir := t.TempDir()
+
+		st.Time = date.Add(6 * time.Hour)
+
+		_, err := store.Backup(dir)
+		assert.NoError(t, err)
+
+		st.Time = date.Add(5 * time.Hour)
+
+		late, err := store.Create(strings.NewReader("late"))
+		assert.NoError(t, err)
+
+		info, err := store.Backup(dir)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, info.Blobs)
+
+		// Blobs are only included by the backup following their commit
+		info, err = store.Backup(dir)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, info.Blobs)
+
+		restored := createTestStore()
+
+		_, err = restored.RestoreBackup(dir)
+		assert.NoError(t, err)
+
+		assert.Equal(t, "late", readBlob(t, restored, late.Id()))
+	})
+
+	t.Run("includes blobs appended to or truncated since the previous backup", func(t *testing.T) {
+		store := createTestStore(WithChunkSize(10), WithChunksPerTransaction(2), WithDeduplication())
+		dir := t.TempDir()
+
+		log, err := store.Create(strings.NewReader("first entry of the log\n"))
+		assert.NoError(t, err)
+		truncated, err := store.Create(strings.NewReader("content to truncate"))
+		assert.NoError(t, err)
+
+		_, err = store.Backup(dir)
+		assert.NoError(t, err)
+
+		_, err = store.AppendBlob(log.Id(), strings.NewReader("second entry\n"))
+		assert.NoError(t, err)
+		err = store.TruncateBlob(truncated.Id(), 7)
+		assert.NoError(t, err)
+
+		info, err := store.Backup(dir)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, info.Blobs)
+
+		restored := createTestStore(WithChunksPerTransaction(2), WithDeduplication())
+
+		_, err = restored.RestoreBackup(dir)
+		assert.NoError(t, err)
+
+		assert.Equal(t, "first entry of the log\nsecond entry\n", readBlob(t, restored, log.Id()))
+		assert.Equal(t, "content", readBlob(t, restored, truncated.Id()))
+
+		usage, err := restored.Usage()
+		assert.NoError(t, err)
+		assert.Equal(t, Usage{Bytes: 43, Blobs: 2}, usage)
+	})
+
+	t.Run("includes blobs removed, restored and appended between backups", func(t *testing.T) {
+		store := createTestStore(WithChunkSize(10))
+		dir := t.TempDir()
+
+		blob, err := store.Create(strings.NewReader("first entry\n"))
+		assert.NoError(t, err)
+
+		_, err = store.Backup(dir)
+		assert.NoError(t, err)
+
+		err = store.RemoveBlob(blob.Id())
+		assert.NoError(t, err)
+
+		_, err = store.Backup(dir)
+		assert.NoError(t, err)
+
+		err = store.RestoreBlob(blob.Id())
+		assert.NoError(t, err)
+		_, err = store.AppendBlob(blob.Id(), strings.NewReader("second entry\n"))
+		assert.NoError(t, err)
+
+		info, err := store.Backup(dir)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, info.Restored)
+		assert.Equal(t, 1, info.Blobs)
+
+		restored := createTestStore()
+
+		_, err = restored.RestoreBackup(dir)
+		assert.NoError(t, err)
+
+		assert.Equal(t, "first entry\nsecond entry\n", readBlob(t, restored, blob.Id()))
+
+		usage, err := restored.Usage()
+		assert.NoError(t, err)
+		assert.Equal(t, Usage{Bytes: 25, Blobs: 1}, usage)
+	})
+
+	t.Run("fails when there are no backups", func(t *testing.T) {
+		_, err := createTestStore().RestoreBackup(t.TempDir())
+		assert.Error(t, err)
+	})
+}
@@ -1,19 +1,22 @@
 package blobs
 
 import (
+	"context"
 	"io"
 	"time"
 
 	"github.com/apple/foundationdb/bindings/go/src/fdb"
 	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
 )
 
 // The blob type.
 type Blob struct {
 	db                   fdb.Database
 	dir                  directory.DirectorySubspace
-	chunkSize            int
 	chunksPerTransaction int
+	chunksDir            directory.DirectorySubspace
+	chunkEncoding
 }
 
 // Returns the id of the blob.
@@ -25,33 +28,128 @@ func (blob *Blob) Id() Id {
 
 // Returns the length of the content of the blob.
 func (blob *Blob) Len() (uint64, error) {
-	return readTransact(blob.db, func(tr fdb.ReadTransaction) (uint64, error) {
-		data, error := tr.Get(blob.dir.Sub("len")).Get()
+	return readTransact(blob.db, blob.LenTx)
+}
+
+// Like [Blob.Len], but reads the length on the given transaction.
+func (blob *Blob) LenTx(tr fdb.ReadTransaction) (uint64, error) {
+	data, err := tr.Get(blob.dir.Sub("len")).Get()
+	if err != nil {
+		return 0, err
+	}
 
-		return decodeUInt64(data), error
-	})
+	return decodeUInt64(data), nil
 }
 
 // Returns the time the blob was created at.
 func (blob *Blob) CreatedAt() (time.Time, error) {
-	data, err := readTransact(blob.db, func(tr fdb.ReadTransaction) ([]byte, error) {
-		return tr.Get(blob.dir.Sub("createdAt")).Get()
+	return readTransact(blob.db, blob.CreatedAtTx)
+}
+
+// Like [Blob.CreatedAt], but reads the creation time on the given transaction.
+func (blob *Blob) CreatedAtTx(tr fdb.ReadTransaction) (time.Time, error) {
+	data, err := tr.Get(blob.dir.Sub("createdAt")).Get()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Unix(int64(decodeUInt64(data)), 0), nil
+}
+
+// Returns the time the content of the blob was last appended to or truncated,
+// or the time it was created at if it was never modified.
+func (blob *Blob) ModifiedAt() (time.Time, error) {
+	return readTransact(blob.db, blob.ModifiedAtTx)
+}
+
+// Like [Blob.ModifiedAt], but reads the modification time on the given
+// transaction.
+func (blob *Blob) ModifiedAtTx(tr fdb.ReadTransaction) (time.Time, error) {
+	return readModifiedAt(tr, blob.dir)
+}
+
+// Reads the modification time of the blob stored in the given directory,
+// falling back to the creation time.
+func readModifiedAt(tr fdb.ReadTransaction, dir subspace.Subspace) (time.Time, error) {
+	modifiedAt := tr.Get(dir.Sub("modifiedAt"))
+	createdAt := tr.Get(dir.Sub("createdAt"))
+
+	data, err := modifiedAt.Get()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if data == nil {
+		data, err = createdAt.Get()
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
 
-	})
+	if data == nil {
+		return time.Time{}, nil
+	}
+
+	return time.Unix(int64(decodeUInt64(data)), 0), nil
+}
+
+// Reads the number of times the blob stored in the given directory was
+// truncated.
+func readTruncations(tr fdb.ReadTransaction, dir subspace.Subspace) (uint64, error) {
+	data, err := tr.Get(dir.Sub("truncations")).Get()
+	if err != nil || data == nil {
+		return 0, err
+	}
 
-	return time.Unix(int64(decodeUInt64(data)), 0), err
+	return decodeUInt64(data), nil
+}
+
+// Returns the size of the chunks the content of the blob is stored in.
+func (blob *Blob) ChunkSize() int {
+	return blob.chunkSize
 }
 
 // Returns a new reader for the content of the blob.
 //
 // New chunks are fetched on demand based on the chunk size and number of chunks
 // per transaction configured for the store.
-func (blob *Blob) Reader() io.Reader {
+//
+// The reader supports seeking, only the chunks covering the requested bytes
+// will be fetched.
+//
+// Chunks are verified against their checksums while reading, and when the
+// content is read from the start to the end it is verified against the
+// checksum of the blob. A [CorruptBlobError] is returned on mismatch.
+//
+// The reader pins the length and checksum of the blob on the first read, so
+// content appended to the blob while reading isn't returned. A reader pinned
+// before the blob was truncated returns a [BlobConflictError] on the next read.
+func (blob *Blob) Reader() io.ReadSeeker {
+	return blob.newReader(context.Background())
+}
+
+// Like [Blob.Reader], but the reader stops with the error of the context when
+// it is done. The context is checked before each transaction.
+func (blob *Blob) ReaderContext(ctx context.Context) io.ReadSeeker {
+	return blob.newReader(ctx)
+}
+
+// Reads len(p) bytes of the content of the blob starting at byte offset off.
+//
+// Only the chunks covering the requested byte range is fetched. It is safe to
+// call ReadAt concurrently.
+func (blob *Blob) ReadAt(p []byte, off int64) (int, error) {
+	return blob.newReader(context.Background()).ReadAt(p, off)
+}
+
+func (blob *Blob) newReader(ctx context.Context) *reader {
 	reader := &reader{
+		ctx:                  ctx,
 		db:                   blob.db,
 		dir:                  blob.dir,
-		chunkSize:            blob.chunkSize,
 		chunksPerTransaction: blob.chunksPerTransaction,
+		chunksDir:            blob.chunksDir,
+		chunkEncoding:        blob.chunkEncoding,
 	}
 
 	return reader
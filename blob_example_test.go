@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"strings"
 )
 
 func ExampleBlob_CreatedAt() {
@@ -53,3 +54,54 @@ func ExampleBlob_Id() {
 
 	fmt.Printf("Blob id: %s", id)
 }
+
+func ExampleBlob_ReadAt() {
+	blob := createTestBlob()
+
+	buf := make([]byte, 4)
+	_, err := blob.ReadAt(buf, 3)
+	if err != nil {
+		log.Fatal("Could not read blob content")
+	}
+
+	fmt.Printf("Blob content at offset 3: %s", buf)
+	// Output: Blob content at offset 3: blob
+}
+
+func ExampleBlob_Metadata() {
+	store := createTestStore()
+
+	blob, err := store.Create(
+		strings.NewReader("My blob content"),
+		WithContentType("text/plain"),
+		WithFilename("blob.txt"),
+		WithAttribute("owner", "jane"),
+	)
+	if err != nil {
+		log.Fatal("Could not create blob")
+	}
+
+	metadata, err := blob.Metadata()
+	if err != nil {
+		log.Fatal("Could not get blob metadata")
+	}
+
+	fmt.Println(metadata.ContentType)
+	fmt.Println(metadata.Filename)
+	fmt.Println(metadata.Attributes["owner"])
+	// Output: text/plain
+	// blob.txt
+	// jane
+}
+
+func ExampleBlob_Checksum() {
+	blob := createTestBlob()
+
+	checksum, err := blob.Checksum()
+	if err != nil {
+		log.Fatal("Could not get blob checksum")
+	}
+
+	fmt.Printf("Blob checksum: %x", checksum)
+	// Output: Blob checksum: 03a1df43705b20738963acbb4dad9a997453c485d90d7c4338a1d9a0f1da8274
+}
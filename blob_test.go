@@ -3,10 +3,13 @@ package blobs
 import (
 	"bytes"
 	"crypto/rand"
+	"errors"
+	"io"
 	"testing"
 	"time"
 
 	"github.com/alecthomas/assert/v2"
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
 )
 
 func TestLen(t *testing.T) {
@@ -49,3 +52,123 @@ func TestCreatedAt(t *testing.T) {
 		assert.True(t, createdAt.Before(time.Now()), "CreatedAt before now")
 	})
 }
+
+func TestReaderSeek(t *testing.T) {
+	s := createTestStore(WithChunkSize(10), WithChunksPerTransaction(2))
+
+	input := make([]byte, 105)
+	_, err := rand.Read(input)
+	assert.NoError(t, err)
+
+	blob, err := s.Create(bytes.NewReader(input))
+	assert.NoError(t, err)
+
+	t.Run("reads from the position seeked to", func(t *testing.T) {
+		offsets := []int64{0, 1, 9, 10, 11, 55, 100, 104, 105}
+
+		for _, offset := range offsets {
+			r := blob.Reader()
+
+			pos, err := r.Seek(offset, io.SeekStart)
+			assert.NoError(t, err)
+			assert.Equal(t, offset, pos)
+
+			data, err := io.ReadAll(r)
+			assert.NoError(t, err)
+
+			assert.Equal(t, input[offset:], data, "offset: %d", offset)
+		}
+	})
+
+	t.Run("supports seeking relative to the current position", func(t *testing.T) {
+		r := blob.Reader()
+
+		buf := make([]byte, 3)
+		_, err := io.ReadFull(r, buf)
+		assert.NoError(t, err)
+
+		pos, err := r.Seek(20, io.SeekCurrent)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(23), pos)
+
+		_, err = io.ReadFull(r, buf)
+		assert.NoError(t, err)
+		assert.Equal(t, input[23:26], buf)
+
+		pos, err = r.Seek(-4, io.SeekCurrent)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(22), pos)
+
+		_, err = io.ReadFull(r, buf)
+		assert.NoError(t, err)
+		assert.Equal(t, input[22:25], buf)
+	})
+
+	t.Run("supports seeking relative to the end", func(t *testing.T) {
+		r := blob.Reader()
+
+		pos, err := r.Seek(-15, io.SeekEnd)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(90), pos)
+
+		data, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, input[90:], data)
+	})
+
+	t.Run("rejects negative positions", func(t *testing.T) {
+		r := blob.Reader()
+
+		_, err := r.Seek(-1, io.SeekStart)
+		assert.EqualError(t, err, "negative position")
+	})
+}
+
+func TestReadAt(t *testing.T) {
+	s := createTestStore(WithChunkSize(10), WithChunksPerTransaction(2))
+
+	input := make([]byte, 105)
+	_, err := rand.Read(input)
+	assert.NoError(t, err)
+
+	blob, err := s.Create(bytes.NewReader(input))
+	assert.NoError(t, err)
+
+	t.Run("reads the requested byte range", func(t *testing.T) {
+		ranges := [][2]int64{{0, 1}, {0, 10}, {5, 20}, {9, 11}, {30, 105}, {104, 105}}
+
+		for _, r := range ranges {
+			buf := make([]byte, r[1]-r[0])
+			n, err := blob.ReadAt(buf, r[0])
+			assert.NoError(t, err)
+
+			assert.Equal(t, len(buf), n)
+			assert.Equal(t, input[r[0]:r[1]], buf, "range: %v", r)
+		}
+	})
+
+	t.Run("returns io.EOF when reading past the end", func(t *testing.T) {
+		buf := make([]byte, 10)
+		n, err := blob.ReadAt(buf, 100)
+		assert.Equal(t, io.EOF, err)
+
+		assert.Equal(t, 5, n)
+		assert.Equal(t, input[100:], buf[:n])
+	})
+
+	t.Run("fails when chunks in the middle of the range are missing", func(t *testing.T) {
+		blob, err := s.Create(bytes.NewReader(input))
+		assert.NoError(t, err)
+
+		err = updateTransact(s.db, func(tr fdb.Transaction) error {
+			tr.Clear(blob.dir.Sub("bytes", 1))
+			tr.Clear(blob.dir.Sub("checksums", 1))
+			return nil
+		})
+		assert.NoError(t, err)
+
+		buf := make([]byte, 20)
+		_, err = blob.ReadAt(buf, 5)
+		assert.True(t, errors.Is(err, CorruptBlobError))
+	})
+}
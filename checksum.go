@@ -0,0 +1,83 @@
+package blobs
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+func chunkChecksum(chunk []byte) []byte {
+	return encodeUInt64(uint64(crc32.Checksum(chunk, castagnoli)))
+}
+
+// Verifies the chunks starting at the given chunk index against their stored
+// checksums.
+//
+// Blobs stored without checksums doesn't have any checksums to verify against.
+func verifyChunks(id Id, startChunk int64, chunks [][]byte, checksumsSpace subspace.Subspace, checksums []fdb.KeyValue) error {
+	if len(checksums) == 0 {
+		return nil
+	}
+
+	if len(checksums) != len(chunks) {
+		return fmt.Errorf("%w: %q is missing chunks", CorruptBlobError, id)
+	}
+
+	err := checkChunkIndexes(id, checksumsSpace, startChunk, checksums)
+	if err != nil {
+		return err
+	}
+
+	for i, chunk := range chunks {
+		if !bytes.Equal(chunkChecksum(chunk), checksums[i].Value) {
+			return fmt.Errorf("%w: checksum mismatch for chunk %d of %q", CorruptBlobError, startChunk+int64(i), id)
+		}
+	}
+
+	return nil
+}
+
+// Checks that the entries read from the given chunk subspace are the
+// consecutive chunks starting at the given chunk index, so a missing chunk
+// doesn't shift the following chunks into its place.
+func checkChunkIndexes(id Id, space subspace.Subspace, startChunk int64, entries []fdb.KeyValue) error {
+	for i, entry := range entries {
+		t, err := space.Unpack(entry.Key)
+		if err != nil {
+			return err
+		}
+
+		chunkIndex := startChunk + int64(i)
+		if index, ok := t[0].(int64); !ok || index != chunkIndex {
+			return fmt.Errorf("%w: chunk %d of %q is missing", CorruptBlobError, chunkIndex, id)
+		}
+	}
+
+	return nil
+}
+
+// Returns the SHA-256 digest of the content of the blob.
+//
+// The digest is calculated when the blob is uploaded, so it can be compared to
+// a digest of known content without reading the blob. The digest is updated
+// when content is appended to or truncated from the blob. Blobs stored before
+// checksums were introduced returns a nil digest.
+//
+// The digest of encrypted blobs is stored encrypted with the data key of the
+// blob, like its content.
+func (blob *Blob) Checksum() ([]byte, error) {
+	data, err := readTransact(blob.db, func(tr fdb.ReadTransaction) ([]byte, error) {
+		return tr.Get(blob.dir.Sub("checksum")).Get()
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return blob.openValue(blob.Id(), "checksum", data)
+}
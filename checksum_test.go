@@ -0,0 +1,102 @@
+package blobs
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+)
+
+func TestChecksum(t *testing.T) {
+	store := createTestStore(WithChunkSize(10))
+
+	t.Run("returns the SHA-256 digest of the content", func(t *testing.T) {
+		input := make([]byte, 95)
+		_, err := rand.Read(input)
+		assert.NoError(t, err)
+
+		blob, err := store.Create(bytes.NewReader(input))
+		assert.NoError(t, err)
+
+		checksum, err := blob.Checksum()
+		assert.NoError(t, err)
+
+		want := sha256.Sum256(input)
+		assert.Equal(t, want[:], checksum)
+	})
+}
+
+func TestCorruption(t *testing.T) {
+	store := createTestStore(WithChunkSize(10))
+
+	createBlob := func(t *testing.T) *Blob {
+		input := make([]byte, 35)
+		_, err := rand.Read(input)
+		assert.NoError(t, err)
+
+		blob, err := store.Create(bytes.NewReader(input))
+		assert.NoError(t, err)
+
+		return blob
+	}
+
+	t.Run("returns an error when reading a corrupt chunk", func(t *testing.T) {
+		blob := createBlob(t)
+
+		err := updateTransact(store.db, func(tr fdb.Transaction) error {
+			tr.Set(blob.dir.Sub("bytes", 2), []byte("corrupted!"))
+			return nil
+		})
+		assert.NoError(t, err)
+
+		_, err = io.ReadAll(blob.Reader())
+		assert.True(t, errors.Is(err, CorruptBlobError))
+		assert.EqualError(t, err, fmt.Sprintf("blob is corrupt: checksum mismatch for chunk 2 of %q", blob.Id()))
+
+		_, err = blob.ReadAt(make([]byte, 5), 22)
+		assert.True(t, errors.Is(err, CorruptBlobError))
+
+		_, err = blob.ReadAt(make([]byte, 5), 0)
+		assert.NoError(t, err)
+	})
+
+	t.Run("returns an error when the content doesn't match the blob checksum", func(t *testing.T) {
+		blob := createBlob(t)
+
+		err := updateTransact(store.db, func(tr fdb.Transaction) error {
+			tr.Set(blob.dir.Sub("checksum"), make([]byte, sha256.Size))
+			return nil
+		})
+		assert.NoError(t, err)
+
+		blob, err = store.Blob(blob.Id())
+		assert.NoError(t, err)
+
+		_, err = io.ReadAll(blob.Reader())
+		assert.EqualError(t, err, fmt.Sprintf("blob is corrupt: checksum mismatch for %q", blob.Id()))
+	})
+
+	t.Run("supports reading blobs stored without checksums", func(t *testing.T) {
+		blob := createBlob(t)
+
+		err := updateTransact(store.db, func(tr fdb.Transaction) error {
+			tr.Clear(blob.dir.Sub("checksum"))
+			tr.ClearRange(blob.dir.Sub("checksums"))
+			return nil
+		})
+		assert.NoError(t, err)
+
+		blob, err = store.Blob(blob.Id())
+		assert.NoError(t, err)
+
+		data, err := io.ReadAll(blob.Reader())
+		assert.NoError(t, err)
+		assert.Equal(t, 35, len(data))
+	})
+}
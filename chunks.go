@@ -0,0 +1,121 @@
+package blobs
+
+import (
+	"crypto/sha256"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
+)
+
+// Stores the chunk with the given index under its content hash and references it
+// from the blob directory.
+//
+// The chunk data is only written if no other blob references it already.
+func (store *Store) putChunk(tr fdb.Transaction, blobDir subspace.Subspace, chunkIndex int64, chunk []byte) error {
+	hash := sha256.Sum256(chunk)
+	refsKey := store.chunksDir.Sub("refs", hash[:])
+
+	data, err := tr.Get(refsKey).Get()
+
+	if err != nil {
+		return err
+	}
+
+	if data == nil {
+		tr.Set(store.chunksDir.Sub("data", hash[:]), chunk)
+	}
+
+	tr.Add(refsKey, encodeUInt64(1))
+	tr.Set(blobDir.Sub("hashes", chunkIndex), hash[:])
+
+	return nil
+}
+
+// Releases up to limit of the references the given blob directory has to
+// content addressed chunks, and clears the released references. Returns the
+// number of released references, fewer than limit when all are released.
+func (store *Store) releaseSomeChunks(tr fdb.Transaction, blobDir subspace.Subspace, limit int) (int, error) {
+	entries, err := tr.GetRange(blobDir.Sub("hashes"), fdb.RangeOptions{Limit: limit}).GetSliceWithError()
+
+	if err != nil {
+		return 0, err
+	}
+
+	for _, entry := range entries {
+		err := store.releaseChunk(tr, entry.Value)
+
+		if err != nil {
+			return 0, err
+		}
+
+		tr.Clear(entry.Key)
+	}
+
+	return len(entries), nil
+}
+
+// Releases the content addressed chunks of the blob directory from the given
+// chunk index to the end.
+func (store *Store) releaseChunksFrom(tr fdb.Transaction, blobDir subspace.Subspace, startChunk int64) error {
+	hashesSpace := blobDir.Sub("hashes")
+	_, end := hashesSpace.FDBRangeKeys()
+	released := fdb.KeyRange{Begin: hashesSpace.Sub(startChunk), End: end}
+
+	entries, err := tr.GetRange(released, fdb.RangeOptions{}).GetSliceWithError()
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		err := store.releaseChunk(tr, entry.Value)
+		if err != nil {
+			return err
+		}
+	}
+
+	tr.ClearRange(released)
+
+	return nil
+}
+
+// Releases a reference to the chunk with the given hash, the chunk is deleted
+// when it is no longer referenced.
+func (store *Store) releaseChunk(tr fdb.Transaction, hash []byte) error {
+	refsKey := store.chunksDir.Sub("refs", hash)
+
+	data, err := tr.Get(refsKey).Get()
+
+	if err != nil {
+		return err
+	}
+
+	if data == nil || decodeUInt64(data) <= 1 {
+		tr.Clear(refsKey)
+		tr.Clear(store.chunksDir.Sub("data", hash))
+	} else {
+		tr.Set(refsKey, encodeUInt64(decodeUInt64(data)-1))
+	}
+
+	return nil
+}
+
+// Resolves the content of the chunks referenced by the given hashes.
+func resolveChunks(tr fdb.ReadTransaction, chunksDir subspace.Subspace, hashes []fdb.KeyValue) ([][]byte, error) {
+	futures := make([]fdb.FutureByteSlice, len(hashes))
+	for i, entry := range hashes {
+		futures[i] = tr.Get(chunksDir.Sub("data", entry.Value))
+	}
+
+	chunks := make([][]byte, len(hashes))
+	for i, future := range futures {
+		data, err := future.Get()
+
+		if err != nil {
+			return nil, err
+		}
+
+		chunks[i] = data
+	}
+
+	return chunks, nil
+}
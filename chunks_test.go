@@ -0,0 +1,134 @@
+package blobs
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+)
+
+func countStoredChunks(t *testing.T, store *Store) int {
+	entries, err := readTransact(store.db, func(tr fdb.ReadTransaction) ([]fdb.KeyValue, error) {
+		return tr.GetRange(store.chunksDir.Sub("data"), fdb.RangeOptions{}).GetSliceWithError()
+	})
+	assert.NoError(t, err)
+
+	return len(entries)
+}
+
+func TestDeduplication(t *testing.T) {
+	t.Run("identical blobs only stores their chunks once", func(t *testing.T) {
+		store := createTestStore(WithChunkSize(10), WithDeduplication())
+
+		input := make([]byte, 95)
+		_, err := rand.Read(input)
+		assert.NoError(t, err)
+
+		for i := 0; i < 3; i++ {
+			blob, err := store.Create(bytes.NewReader(input))
+			assert.NoError(t, err)
+
+			data, err := io.ReadAll(blob.Reader())
+			assert.NoError(t, err)
+			assert.Equal(t, input, data)
+		}
+
+		assert.Equal(t, 10, countStoredChunks(t, store))
+	})
+
+	t.Run("blobs sharing chunks only stores the shared chunks once", func(t *testing.T) {
+		store := createTestStore(WithChunkSize(10), WithDeduplication())
+
+		input := make([]byte, 40)
+		_, err := rand.Read(input)
+		assert.NoError(t, err)
+
+		_, err = store.Create(bytes.NewReader(input))
+		assert.NoError(t, err)
+
+		other := append(append([]byte{}, input[:20]...), make([]byte, 20)...)
+		blob, err := store.Create(bytes.NewReader(other))
+		assert.NoError(t, err)
+
+		data, err := io.ReadAll(blob.Reader())
+		assert.NoError(t, err)
+		assert.Equal(t, other, data)
+
+		// 4 chunks for the first blob, 1 zero chunk for the second
+		assert.Equal(t, 5, countStoredChunks(t, store))
+	})
+
+	t.Run("chunks are released when blobs are deleted", func(t *testing.T) {
+		store := createTestStore(WithChunkSize(10), WithDeduplication())
+
+		input := make([]byte, 25)
+		_, err := rand.Read(input)
+		assert.NoError(t, err)
+
+		first, err := store.Create(bytes.NewReader(input))
+		assert.NoError(t, err)
+		second, err := store.Create(bytes.NewReader(input))
+		assert.NoError(t, err)
+
+		err = store.RemoveBlob(first.Id())
+		assert.NoError(t, err)
+		_, err = store.DeleteRemovedBlobsBefore(time.Now().Add(time.Minute))
+		assert.NoError(t, err)
+
+		assert.Equal(t, 3, countStoredChunks(t, store))
+
+		blob, err := store.Blob(second.Id())
+		assert.NoError(t, err)
+		data, err := io.ReadAll(blob.Reader())
+		assert.NoError(t, err)
+		assert.Equal(t, input, data)
+
+		err = store.RemoveBlob(second.Id())
+		assert.NoError(t, err)
+		_, err = store.DeleteRemovedBlobsBefore(time.Now().Add(time.Minute))
+		assert.NoError(t, err)
+
+		assert.Equal(t, 0, countStoredChunks(t, store))
+	})
+
+	t.Run("chunks are released when uploads are deleted", func(t *testing.T) {
+		store := createTestStore(WithChunkSize(10), WithDeduplication())
+
+		_, err := store.Upload(bytes.NewReader(make([]byte, 30)))
+		assert.NoError(t, err)
+
+		_, err = store.DeleteUploadsStartedBefore(time.Now().Add(time.Minute))
+		assert.NoError(t, err)
+
+		assert.Equal(t, 0, countStoredChunks(t, store))
+	})
+
+	t.Run("supports reading blobs stored without deduplication", func(t *testing.T) {
+		db := fdbConnect()
+		ns := testNamespace()
+
+		plain, err := NewStore(db, ns, WithChunkSize(10))
+		assert.NoError(t, err)
+
+		input := make([]byte, 25)
+		_, err = rand.Read(input)
+		assert.NoError(t, err)
+
+		created, err := plain.Create(bytes.NewReader(input))
+		assert.NoError(t, err)
+
+		store, err := NewStore(db, ns, WithDeduplication())
+		assert.NoError(t, err)
+
+		blob, err := store.Blob(created.Id())
+		assert.NoError(t, err)
+
+		data, err := io.ReadAll(blob.Reader())
+		assert.NoError(t, err)
+		assert.Equal(t, input, data)
+	})
+}
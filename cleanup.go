@@ -0,0 +1,431 @@
+package blobs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
+)
+
+// Names of the time ordered cleanup indexes.
+//
+// Each index holds keys of the form (index, unix timestamp, id), so expired
+// entries are found with a single range read instead of scanning all removed
+// blobs or uploads.
+const (
+	removedIndex = "removed"
+	uploadsIndex = "uploads"
+)
+
+// Cleanup option type.
+type CleanupOption func(cleanup *cleanupOptions) error
+
+type cleanupOptions struct {
+	batchSize int
+	progress  func(deleted []Id)
+}
+
+// Sets the maximum number of removed blobs or uploads deleted in a single
+// transaction.
+//
+// Defaults to 100.
+func WithCleanupBatchSize(batchSize int) CleanupOption {
+	return func(cleanup *cleanupOptions) error {
+		if batchSize < 1 {
+			return errors.New("invalid batch size, batch size needs to be greater than zero")
+		}
+		cleanup.batchSize = batchSize
+		return nil
+	}
+}
+
+// Calls the progress function with the ids deleted by each committed batch.
+func WithCleanupProgress(progress func(deleted []Id)) CleanupOption {
+	return func(cleanup *cleanupOptions) error {
+		cleanup.progress = progress
+		return nil
+	}
+}
+
+func newCleanupOptions(opts []CleanupOption) (*cleanupOptions, error) {
+	options := &cleanupOptions{batchSize: 100}
+
+	for _, opt := range opts {
+		err := opt(options)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return options, nil
+}
+
+// Returns the cleanup index key of the blob or upload with the given id.
+func (store *Store) cleanupKey(index string, unixTimestamp int64, id Id) subspace.Subspace {
+	return store.cleanupDir.Sub(index, unixTimestamp, string(id))
+}
+
+// Adds the blob or upload with the given id to a cleanup index.
+func (store *Store) addToCleanupIndex(tr fdb.Transaction, index string, unixTimestamp int64, id Id) {
+	tr.Set(store.cleanupKey(index, unixTimestamp, id), []byte{})
+}
+
+// Removes the blob or upload stored in the given directory from a cleanup
+// index, the timestamp it is indexed by is read from the timestamp key.
+func (store *Store) removeFromCleanupIndex(tr fdb.Transaction, index string, dir subspace.Subspace, timestampKey string, id Id) error {
+	data, err := tr.Get(dir.Sub(timestampKey)).Get()
+	if err != nil {
+		return err
+	}
+
+	if data != nil {
+		tr.Clear(store.cleanupKey(index, int64(decodeUInt64(data)), id))
+	}
+
+	return nil
+}
+
+// Indexes removed blobs and uploads created before the cleanup indexes were
+// introduced.
+//
+// This is done once per store, in batches across multiple transactions. The
+// indexing is idempotent, so a failed indexing starts over on the next cleanup.
+func (store *Store) buildCleanupIndexes(ctx context.Context, batchSize int) error {
+	indexedKey := store.cleanupDir.Sub("indexed")
+
+	indexed, err := readTransact(store.db, func(tr fdb.ReadTransaction) ([]byte, error) {
+		return tr.Get(indexedKey).Get()
+	})
+
+	if err != nil || indexed != nil {
+		return err
+	}
+
+	indexes := []struct {
+		index        string
+		dir          directory.DirectorySubspace
+		timestampKey string
+	}{
+		{removedIndex, store.removedDir, "deletedAt"},
+		{uploadsIndex, store.uploadsDir, "uploadStartedAt"},
+	}
+
+	for _, index := range indexes {
+		options := &listOptions{limit: batchSize}
+
+		for {
+			err := ctx.Err()
+			if err != nil {
+				return err
+			}
+
+			cursor, err := transact(store.db, func(tr fdb.Transaction) (string, error) {
+				names, dirs, cursor, err := listPage(tr, index.dir, options)
+				if err != nil {
+					return "", err
+				}
+
+				timestamps := make([]fdb.FutureByteSlice, len(names))
+				for i := range names {
+					timestamps[i] = tr.Get(dirs[i].Sub(index.timestampKey))
+				}
+
+				for i, name := range names {
+					data, err := timestamps[i].Get()
+					if err != nil {
+						return "", err
+					}
+
+					var unixTimestamp int64
+					if data != nil {
+						unixTimestamp = int64(decodeUInt64(data))
+					}
+
+					store.addToCleanupIndex(tr, index.index, unixTimestamp, Id(name))
+				}
+
+				return cursor, nil
+			})
+
+			if err != nil {
+				return err
+			}
+
+			if cursor == "" {
+				break
+			}
+
+			options.cursor = cursor
+		}
+	}
+
+	return updateTransact(store.db, func(tr fdb.Transaction) error {
+		tr.Set(indexedKey, encodeUInt64(1))
+		return nil
+	})
+}
+
+// Name of the subdirectory of the cleanup directory holding deleted entries
+// whose references to content addressed chunks are still being released.
+const releasingDirName = "releasing"
+
+// Opens the directory holding deleted entries whose chunks are being released.
+func (store *Store) openReleasingDir(tr fdb.Transaction) (directory.DirectorySubspace, error) {
+	return store.cleanupDir.CreateOrOpen(tr, []string{releasingDirName}, nil)
+}
+
+// Releases the references of deleted entries to content addressed chunks, at
+// most chunks per transaction references in each transaction. The entries are
+// removed when all their references are released.
+func (store *Store) releaseDeletedChunks(ctx context.Context) error {
+	for {
+		err := ctx.Err()
+		if err != nil {
+			return err
+		}
+
+		more, err := transact(store.db, func(tr fdb.Transaction) (bool, error) {
+			releasingDir, err := store.openReleasingDir(tr)
+			if err != nil {
+				return false, err
+			}
+
+			names, dirs, _, err := listPage(tr, releasingDir, &listOptions{limit: 1})
+			if err != nil || len(names) == 0 {
+				return false, err
+			}
+
+			released, err := store.releaseSomeChunks(tr, dirs[0], store.chunksPerTransaction)
+			if err != nil {
+				return false, err
+			}
+
+			if released < store.chunksPerTransaction {
+				_, err = removeEntry(tr, releasingDir, names[0])
+			}
+
+			return true, err
+		})
+
+		if err != nil || !more {
+			return err
+		}
+	}
+}
+
+// Deletes the entry with the given id from the directory and releases its
+// references to content addressed chunks.
+//
+// Entries referencing more than chunks per transaction chunks are moved to the
+// releasing directory instead and true is returned, their chunks are then
+// released across multiple transactions by [Store.releaseDeletedChunks].
+func (store *Store) deleteEntry(tr fdb.Transaction, dir, entryDir directory.DirectorySubspace, id Id) (bool, error) {
+	hashes, err := tr.GetRange(entryDir.Sub("hashes"), fdb.RangeOptions{
+		Limit: store.chunksPerTransaction + 1,
+	}).GetSliceWithError()
+
+	if err != nil {
+		return false, err
+	}
+
+	if len(hashes) > store.chunksPerTransaction {
+		releasingDir, err := store.openReleasingDir(tr)
+		if err != nil {
+			return false, err
+		}
+
+		_, err = moveEntry(tr, dir, entryDir, releasingDir, string(id))
+
+		return true, err
+	}
+
+	for _, hash := range hashes {
+		err := store.releaseChunk(tr, hash.Value)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	_, err = removeEntry(tr, dir, string(id))
+
+	return false, err
+}
+
+// Deletes the entries of the directory indexed by the given cleanup index with
+// a timestamp before the given date.
+//
+// The entries are deleted in batches, each batch in its own transaction. As the
+// index entries are cleared together with the entries they point to, a cleanup
+// that fails continues where it stopped when it is run again.
+//
+// A batch releases at most chunks per transaction references to content
+// addressed chunks. Entries referencing more chunks than that are moved out of
+// the directory, and their chunks are released across multiple transactions
+// before the next batch.
+//
+// The length of the deleted entries is subtracted from the given usage counter.
+func (store *Store) deleteExpired(ctx context.Context, index string, dir directory.DirectorySubspace, usageCounter string, date time.Time, opts []CleanupOption) ([]Id, error) {
+	options, err := newCleanupOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = store.buildCleanupIndexes(ctx, options.batchSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// Continue releasing the chunks of entries deleted by a failed cleanup
+	err = store.releaseDeletedChunks(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Timestamps are stored with a resolution of seconds, so a timestamp is
+	// before the date when it is before the date rounded up to whole seconds
+	endTimestamp := date.Unix()
+	if date.Nanosecond() > 0 {
+		endTimestamp++
+	}
+
+	indexSubspace := store.cleanupDir.Sub(index)
+	begin, _ := indexSubspace.FDBRangeKeys()
+	expired := fdb.KeyRange{Begin: begin, End: indexSubspace.Sub(endTimestamp)}
+
+	var deletedIds []Id
+
+	for {
+		err := ctx.Err()
+		if err != nil {
+			return deletedIds, err
+		}
+
+		batch, err := transact(store.db, func(tr fdb.Transaction) (cleanupBatch, error) {
+			return store.deleteExpiredBatch(tr, indexSubspace, dir, usageCounter, expired, options.batchSize)
+		})
+
+		if err != nil {
+			return deletedIds, err
+		}
+
+		deletedIds = append(deletedIds, batch.deleted...)
+
+		if batch.releasing {
+			err = store.releaseDeletedChunks(ctx)
+			if err != nil {
+				return deletedIds, err
+			}
+		}
+
+		if options.progress != nil && len(batch.deleted) > 0 {
+			options.progress(batch.deleted)
+		}
+
+		if !batch.more {
+			return deletedIds, nil
+		}
+	}
+}
+
+// The result of deleting a batch of expired entries.
+type cleanupBatch struct {
+	deleted []Id
+	// If there might be more expired entries
+	more bool
+	// If deleted entries were moved to have their chunks released
+	releasing bool
+}
+
+func (store *Store) deleteExpiredBatch(tr fdb.Transaction, indexSubspace subspace.Subspace, dir directory.DirectorySubspace, usageCounter string, expired fdb.KeyRange, batchSize int) (cleanupBatch, error) {
+	var batch cleanupBatch
+
+	entries, err := tr.GetRange(expired, fdb.RangeOptions{Limit: batchSize}).GetSliceWithError()
+	if err != nil {
+		return batch, err
+	}
+
+	budget := store.chunksPerTransaction
+
+	for i, entry := range entries {
+		t, err := indexSubspace.Unpack(entry.Key)
+		if err != nil {
+			return batch, err
+		}
+
+		id := t[1].(string)
+
+		entryDir, err := dir.Open(tr, []string{id}, nil)
+		if errors.Is(err, directory.ErrDirNotExists) {
+			// The entry was committed, aborted or deleted without clearing
+			// the index entry
+			tr.Clear(entry.Key)
+			continue
+		}
+
+		if err != nil {
+			return batch, err
+		}
+
+		hashes, err := tr.GetRange(entryDir.Sub("hashes"), fdb.RangeOptions{Limit: budget + 1}).GetSliceWithError()
+		if err != nil {
+			return batch, err
+		}
+
+		if len(hashes) > budget && i > 0 {
+			// Leave the entry for the next batch
+			batch.more = true
+			return batch, nil
+		}
+
+		tr.Clear(entry.Key)
+
+		length, err := readLen(tr, entryDir)
+		if err != nil {
+			return batch, err
+		}
+
+		if len(hashes) > budget {
+			releasingDir, err := store.openReleasingDir(tr)
+			if err != nil {
+				return batch, err
+			}
+
+			_, err = moveEntry(tr, dir, entryDir, releasingDir, id)
+			if err != nil {
+				return batch, err
+			}
+
+			batch.deleted = append(batch.deleted, Id(id))
+			batch.releasing = true
+			store.addUsage(tr, usageCounter, -length)
+
+			batch.more = true
+			return batch, nil
+		}
+
+		for _, hash := range hashes {
+			err := store.releaseChunk(tr, hash.Value)
+			if err != nil {
+				return batch, err
+			}
+		}
+		budget -= len(hashes)
+
+		deleted, err := removeEntry(tr, dir, id)
+		if err != nil {
+			return batch, err
+		}
+
+		if deleted {
+			batch.deleted = append(batch.deleted, Id(id))
+			store.addUsage(tr, usageCounter, -length)
+		}
+	}
+
+	batch.more = len(entries) == batchSize
+
+	return batch, nil
+}
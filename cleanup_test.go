@@ -0,0 +1,126 @@
+package blobs
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+)
+
+func TestBatchedCleanup(t *testing.T) {
+	date, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+
+	st := &SystemTimeMock{}
+
+	store := createTestStore(
+		WithChunkSize(100),
+		WithSystemTime(st),
+	)
+
+	removeBlobs := func(n int) {
+		for i := 0; i < n; i++ {
+			blob, err := store.Create(strings.NewReader("content"))
+			assert.NoError(t, err)
+			err = store.RemoveBlob(blob.Id())
+			assert.NoError(t, err)
+		}
+	}
+
+	t.Run("deletes expired blobs in batches and reports progress", func(t *testing.T) {
+		st.Time = date.AddDate(0, -2, 0)
+		removeBlobs(5)
+		st.Time = date
+		removeBlobs(2)
+
+		var batches [][]Id
+		deleted, err := store.DeleteRemovedBlobsBefore(date.AddDate(0, -1, 0),
+			WithCleanupBatchSize(2),
+			WithCleanupProgress(func(ids []Id) {
+				batches = append(batches, ids)
+			}),
+		)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 5, len(deleted))
+		assert.Equal(t, 3, len(batches))
+		assert.Equal(t, deleted[:2], batches[0])
+
+		deleted, err = store.DeleteRemovedBlobsBefore(date.Add(time.Second))
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(deleted))
+	})
+
+	t.Run("committed and aborted uploads are not deleted", func(t *testing.T) {
+		st.Time = date.AddDate(0, -2, 0)
+		_, err := store.Create(strings.NewReader("content"))
+		assert.NoError(t, err)
+		token, err := store.Upload(strings.NewReader("upload"))
+		assert.NoError(t, err)
+		err = store.AbortUpload(token)
+		assert.NoError(t, err)
+		_, err = store.Upload(strings.NewReader("upload"))
+		assert.NoError(t, err)
+
+		deleted, err := store.DeleteUploadsStartedBefore(date)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(deleted))
+	})
+
+	t.Run("indexes removed blobs without index entries", func(t *testing.T) {
+		st.Time = date.AddDate(0, -2, 0)
+		removeBlobs(3)
+
+		_, err := store.db.Transact(func(tr fdb.Transaction) (any, error) {
+			tr.ClearRange(store.cleanupDir)
+			return nil, nil
+		})
+		assert.NoError(t, err)
+
+		deleted, err := store.DeleteRemovedBlobsBefore(date, WithCleanupBatchSize(2))
+		assert.NoError(t, err)
+		assert.Equal(t, 3, len(deleted))
+	})
+
+	t.Run("releases the chunks of large blobs across transactions", func(t *testing.T) {
+		store := createTestStore(
+			WithChunkSize(10),
+			WithChunksPerTransaction(2),
+			WithDeduplication(),
+			WithSystemTime(st),
+		)
+
+		st.Time = date.AddDate(0, -2, 0)
+
+		kept, err := store.Create(strings.NewReader("0123456789"))
+		assert.NoError(t, err)
+
+		var removed []Id
+		for _, content := range []string{"0123456789abcdefghijklmnopqrstuvwxyz", "short", "0123456789ABCDEFGHIJ"} {
+			blob, err := store.Create(strings.NewReader(content))
+			assert.NoError(t, err)
+			err = store.RemoveBlob(blob.Id())
+			assert.NoError(t, err)
+			removed = append(removed, blob.Id())
+		}
+
+		deleted, err := store.DeleteRemovedBlobsBefore(date)
+		assert.NoError(t, err)
+		assert.Equal(t, removed, deleted)
+
+		refs, err := readTransact(store.db, func(tr fdb.ReadTransaction) ([]fdb.KeyValue, error) {
+			return tr.GetRange(store.chunksDir.Sub("refs"), fdb.RangeOptions{}).GetSliceWithError()
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(refs))
+		assert.Equal(t, uint64(1), decodeUInt64(refs[0].Value))
+
+		assert.Equal(t, "0123456789", readBlob(t, store, kept.Id()))
+	})
+
+	t.Run("rejects invalid batch sizes", func(t *testing.T) {
+		_, err := store.DeleteRemovedBlobsBefore(date, WithCleanupBatchSize(0))
+		assert.EqualError(t, err, "invalid batch size, batch size needs to be greater than zero")
+	})
+}
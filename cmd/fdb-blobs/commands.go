@@ -0,0 +1,435 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	blobs "github.com/sunesimonsen/fdb-blobs"
+)
+
+func put(env env, args []string) error {
+	flags := newFlagSet(env, "put")
+	contentType := flags.String("content-type", "", "the content type of the blob")
+	filename := flags.String("filename", "", "the filename of the blob, defaults to the name of the file")
+
+	err := parseFlags(flags, args, 0, 1)
+	if err != nil {
+		return err
+	}
+
+	r := env.stdin
+
+	if path := flags.Arg(0); path != "" && path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		r = file
+
+		if *filename == "" {
+			*filename = filepath.Base(path)
+		}
+	}
+
+	store, err := env.openStore()
+	if err != nil {
+		return err
+	}
+
+	var opts []blobs.UploadOption
+	if *contentType != "" {
+		opts = append(opts, blobs.WithContentType(*contentType))
+	}
+	if *filename != "" {
+		opts = append(opts, blobs.WithFilename(*filename))
+	}
+
+	blob, err := store.Create(r, opts...)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(env.stdout, blob.Id())
+
+	return nil
+}
+
+func get(env env, args []string) error {
+	flags := newFlagSet(env, "get")
+	output := flags.String("o", "", "the file to write the content to, defaults to stdout")
+	offset := flags.Int64("offset", 0, "the byte offset to start reading from")
+	length := flags.Int64("length", -1, "the number of bytes to read, defaults to the rest of the blob")
+	workers := flags.Int("workers", 4, "the number of transactions fetching content concurrently")
+
+	err := parseFlags(flags, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	if *offset < 0 {
+		return usageError{msg: "the offset can't be negative"}
+	}
+
+	store, err := env.openStore()
+	if err != nil {
+		return err
+	}
+
+	blob, err := store.Blob(blobs.Id(flags.Arg(0)))
+	if err != nil {
+		return err
+	}
+
+	opts := []blobs.ReadAheadOption{blobs.WithWorkers(*workers)}
+	if *length >= 0 {
+		// Only the requested range is fetched ahead
+		opts = append(opts, blobs.WithReadAheadEnd(*offset+*length))
+	}
+
+	r, err := blob.ReadAheadReader(opts...)
+	if err != nil {
+		return usageError{msg: err.Error()}
+	}
+	defer r.Close()
+
+	_, err = r.Seek(*offset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	var content io.Reader = r
+	if *length >= 0 {
+		content = io.LimitReader(r, *length)
+	}
+
+	if *output == "" {
+		_, err = io.Copy(env.stdout, content)
+		return err
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(file, content)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+func stat(env env, args []string) error {
+	flags := newFlagSet(env, "stat")
+
+	err := parseFlags(flags, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	store, err := env.openStore()
+	if err != nil {
+		return err
+	}
+
+	blob, err := store.Blob(blobs.Id(flags.Arg(0)))
+	if err != nil {
+		return err
+	}
+
+	length, err := blob.Len()
+	if err != nil {
+		return err
+	}
+
+	createdAt, err := blob.CreatedAt()
+	if err != nil {
+		return err
+	}
+
+	checksum, err := blob.Checksum()
+	if err != nil {
+		return err
+	}
+
+	metadata, err := blob.Metadata()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(env.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Id:\t%s\n", blob.Id())
+	fmt.Fprintf(w, "Length:\t%d\n", length)
+	fmt.Fprintf(w, "Created:\t%s\n", createdAt.Format(time.RFC3339))
+	fmt.Fprintf(w, "Chunk size:\t%d\n", blob.ChunkSize())
+	fmt.Fprintf(w, "Checksum:\t%s\n", orNone(hex.EncodeToString(checksum)))
+	fmt.Fprintf(w, "Content type:\t%s\n", orNone(metadata.ContentType))
+	fmt.Fprintf(w, "Filename:\t%s\n", orNone(metadata.Filename))
+
+	keys := make([]string, 0, len(metadata.Attributes))
+	for key := range metadata.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		fmt.Fprintf(w, "Attribute %s:\t%s\n", key, metadata.Attributes[key])
+	}
+
+	return w.Flush()
+}
+
+func orNone(value string) string {
+	if value == "" {
+		return "-"
+	}
+
+	return value
+}
+
+func ls(env env, args []string) error {
+	flags := newFlagSet(env, "ls")
+	limit := flags.Int("limit", 100, "the number of blobs read per transaction")
+	descending := flags.Bool("desc", false, "list the blobs in descending order")
+
+	err := parseFlags(flags, args, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	store, err := env.openStore()
+	if err != nil {
+		return err
+	}
+
+	opts := []blobs.ListOption{blobs.WithLimit(*limit), blobs.WithBlobInfo()}
+	if *descending {
+		opts = append(opts, blobs.WithDescendingOrder())
+	}
+
+	w := tabwriter.NewWriter(env.stdout, 0, 4, 2, ' ', 0)
+
+	var cursor string
+	for {
+		// An empty cursor starts from the first page
+		pageOpts := append([]blobs.ListOption{blobs.WithCursor(cursor)}, opts...)
+
+		page, err := store.ListBlobs(pageOpts...)
+		if err != nil {
+			return err
+		}
+
+		for _, info := range page.Blobs {
+			fmt.Fprintf(w, "%s\t%d\t%s\n", info.Id, info.Len, info.CreatedAt.Format(time.RFC3339))
+		}
+
+		if page.Cursor == "" {
+			return w.Flush()
+		}
+
+		cursor = page.Cursor
+	}
+}
+
+func rm(env env, args []string) error {
+	flags := newFlagSet(env, "rm")
+
+	err := parseFlags(flags, args, 1, -1)
+	if err != nil {
+		return err
+	}
+
+	store, err := env.openStore()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range flags.Args() {
+		err := store.RemoveBlob(blobs.Id(id))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func restore(env env, args []string) error {
+	flags := newFlagSet(env, "restore")
+
+	err := parseFlags(flags, args, 1, -1)
+	if err != nil {
+		return err
+	}
+
+	store, err := env.openStore()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range flags.Args() {
+		err := store.RestoreBlob(blobs.Id(id))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Parses a time given as an RFC 3339 timestamp, or as a duration before now.
+func parseTime(value string, now time.Time) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return t, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return t, fmt.Errorf("invalid time %q, use a RFC 3339 timestamp or a duration like 24h", value)
+	}
+
+	return now.Add(-d), nil
+}
+
+func gc(env env, args []string) error {
+	flags := newFlagSet(env, "gc")
+	removedBefore := flags.String("removed-before", "", "delete blobs removed before this time, a RFC 3339 timestamp or a duration like 24h")
+	uploadsBefore := flags.String("uploads-before", "", "delete uploads started before this time, a RFC 3339 timestamp or a duration like 24h")
+
+	err := parseFlags(flags, args, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	if *removedBefore == "" && *uploadsBefore == "" {
+		flags.Usage()
+		return usageError{msg: "either -removed-before or -uploads-before is required"}
+	}
+
+	now := time.Now()
+
+	var removedDate, uploadsDate time.Time
+
+	if *removedBefore != "" {
+		removedDate, err = parseTime(*removedBefore, now)
+		if err != nil {
+			return usageError{msg: err.Error()}
+		}
+	}
+
+	if *uploadsBefore != "" {
+		uploadsDate, err = parseTime(*uploadsBefore, now)
+		if err != nil {
+			return usageError{msg: err.Error()}
+		}
+	}
+
+	store, err := env.openStore()
+	if err != nil {
+		return err
+	}
+
+	if *removedBefore != "" {
+		deleted, err := store.DeleteRemovedBlobsBefore(removedDate)
+		fmt.Fprintf(env.stdout, "Deleted %d removed blobs\n", len(deleted))
+		if err != nil {
+			return err
+		}
+	}
+
+	if *uploadsBefore != "" {
+		deleted, err := store.DeleteUploadsStartedBefore(uploadsDate)
+		fmt.Fprintf(env.stdout, "Deleted %d uploads\n", len(deleted))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func du(env env, args []string) error {
+	flags := newFlagSet(env, "du")
+
+	err := parseFlags(flags, args, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	store, err := env.openStore()
+	if err != nil {
+		return err
+	}
+
+	usage, err := store.Usage()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(env.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Blobs:\t%d\t%d bytes\n", usage.Blobs, usage.Bytes)
+	fmt.Fprintf(w, "Uploads:\t\t%d bytes\n", usage.UploadBytes)
+	fmt.Fprintf(w, "Removed:\t\t%d bytes\n", usage.RemovedBytes)
+	fmt.Fprintf(w, "Total:\t\t%d bytes\n", usage.TotalBytes())
+
+	return w.Flush()
+}
+
+func verify(env env, args []string) error {
+	flags := newFlagSet(env, "verify")
+	repair := flags.Bool("repair", false, "repair the problems that can be repaired")
+
+	err := parseFlags(flags, args, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	store, err := env.openStore()
+	if err != nil {
+		return err
+	}
+
+	var opts []blobs.VerifyOption
+	if *repair {
+		opts = append(opts, blobs.WithRepair())
+	}
+
+	report, err := store.Verify(opts...)
+
+	unrepaired := 0
+	for _, problem := range report.Problems {
+		if problem.Repaired {
+			fmt.Fprintf(env.stdout, "%s (repaired)\n", problem)
+		} else {
+			fmt.Fprintln(env.stdout, problem)
+			unrepaired++
+		}
+	}
+
+	for _, id := range report.Unverified {
+		fmt.Fprintf(env.stdout, "%q was modified while verifying it and is not verified\n", id)
+	}
+
+	fmt.Fprintf(env.stdout, "Verified %d blobs, %d uploads and %d removed blobs, found %d problems\n", report.Blobs, report.Uploads, report.RemovedBlobs, len(report.Problems))
+
+	if err != nil {
+		return err
+	}
+
+	if unrepaired > 0 {
+		return fmt.Errorf("%d problems are not repaired", unrepaired)
+	}
+
+	return nil
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/oklog/ulid/v2"
+)
+
+// Returns an env for a new namespace, that captures the output of the
+// commands.
+func testEnv(t *testing.T) (env, *bytes.Buffer) {
+	apiVersion, err := strconv.Atoi(os.Getenv("FDB_API_VERSION"))
+	if err != nil {
+		t.Fatal("cannot parse FDB_API_VERSION from env")
+	}
+
+	stdout := &bytes.Buffer{}
+
+	env := env{
+		clusterFile: os.Getenv("FDB_CLUSTER_FILE"),
+		namespace:   "test-" + ulid.Make().String(),
+		apiVersion:  apiVersion,
+		stdin:       strings.NewReader(""),
+		stdout:      stdout,
+		stderr:      io.Discard,
+	}
+	env.newStore = env.connect
+
+	return env, stdout
+}
+
+// Runs the command and returns the output.
+func run(t *testing.T, env env, stdout *bytes.Buffer, cmd func(env, []string) error, args ...string) string {
+	stdout.Reset()
+	err := cmd(env, args)
+	assert.NoError(t, err)
+	return stdout.String()
+}
+
+// Stores the content with the put command and returns the id of the blob.
+func putContent(t *testing.T, env env, stdout *bytes.Buffer, content string, args ...string) string {
+	env.stdin = strings.NewReader(content)
+	return strings.TrimSpace(run(t, env, stdout, put, args...))
+}
+
+func TestCommands(t *testing.T) {
+	t.Run("stores and reads blobs", func(t *testing.T) {
+		env, stdout := testEnv(t)
+
+		id := putContent(t, env, stdout, "0123456789", "-content-type", "text/plain")
+
+		assert.Equal(t, "0123456789", run(t, env, stdout, get, id))
+		assert.Equal(t, "345", run(t, env, stdout, get, "-offset", "3", "-length", "3", id))
+
+		output := run(t, env, stdout, stat, id)
+		assert.Contains(t, output, "Length:        10\n")
+		assert.Contains(t, output, "Content type:  text/plain\n")
+	})
+
+	t.Run("writes the content to a file", func(t *testing.T) {
+		env, stdout := testEnv(t)
+
+		id := putContent(t, env, stdout, "content")
+
+		path := filepath.Join(t.TempDir(), "content")
+		run(t, env, stdout, get, "-o", path, id)
+
+		data, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		assert.Equal(t, "content", string(data))
+	})
+
+	t.Run("lists, removes and restores blobs", func(t *testing.T) {
+		env, stdout := testEnv(t)
+
+		first := putContent(t, env, stdout, "first")
+		second := putContent(t, env, stdout, "second")
+
+		output := run(t, env, stdout, ls, "-limit", "1")
+		assert.Equal(t, 2, strings.Count(output, "\n"))
+		assert.Contains(t, output, first)
+		assert.Contains(t, output, second)
+
+		run(t, env, stdout, rm, first)
+
+		output = run(t, env, stdout, ls)
+		assert.NotContains(t, output, first)
+
+		output = run(t, env, stdout, du)
+		assert.Contains(t, output, "Removed:     5 bytes\n")
+
+		run(t, env, stdout, restore, first)
+
+		output = run(t, env, stdout, ls)
+		assert.Contains(t, output, first)
+	})
+
+	t.Run("verifies the store", func(t *testing.T) {
+		env, stdout := testEnv(t)
+
+		putContent(t, env, stdout, "content")
+
+		output := run(t, env, stdout, verify)
+		assert.Equal(t, "Verified 1 blobs, 0 uploads and 0 removed blobs, found 0 problems\n", output)
+	})
+
+	t.Run("stores blobs with the given store options", func(t *testing.T) {
+		env, stdout := testEnv(t)
+		env.chunkSize = 4
+		env.dedup = true
+		env.compression = "zstd"
+
+		id := putContent(t, env, stdout, "0123456789")
+
+		assert.Equal(t, "0123456789", run(t, env, stdout, get, id))
+		assert.Contains(t, run(t, env, stdout, stat, id), "Chunk size:    4\n")
+	})
+
+	t.Run("encrypts blobs with the keys of the keys file", func(t *testing.T) {
+		env, stdout := testEnv(t)
+
+		key := make([]byte, 32)
+		_, err := rand.Read(key)
+		assert.NoError(t, err)
+
+		env.keysFile = filepath.Join(t.TempDir(), "keys")
+		err = os.WriteFile(env.keysFile, []byte("# keys\nkey-1 "+hex.EncodeToString(key)+"\n"), 0600)
+		assert.NoError(t, err)
+
+		id := putContent(t, env, stdout, "secret")
+		assert.Equal(t, "secret", run(t, env, stdout, get, id))
+
+		env.keysFile = ""
+		err = get(env, []string{id})
+		assert.EqualError(t, err, "blob is encrypted, but the store has no key provider")
+	})
+
+	t.Run("rejects invalid store options", func(t *testing.T) {
+		env, _ := testEnv(t)
+		env.compression = "lz4"
+
+		err := du(env, nil)
+		assert.True(t, errors.As(err, &usageError{}))
+		assert.EqualError(t, err, `unknown compression "lz4", use gzip, zstd or snappy`)
+	})
+
+	t.Run("returns an error for invalid flags", func(t *testing.T) {
+		env, _ := testEnv(t)
+
+		err := ls(env, []string{"-unknown"})
+		assert.True(t, errors.As(err, &usageError{}))
+		assert.EqualError(t, err, "flag provided but not defined: -unknown")
+	})
+
+	t.Run("returns an error for a wrong number of arguments", func(t *testing.T) {
+		env, _ := testEnv(t)
+
+		err := get(env, nil)
+		assert.EqualError(t, err, "wrong number of arguments")
+	})
+}
+
+func TestParseTime(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339, "2023-01-02T00:00:00Z")
+
+	t.Run("parses timestamps", func(t *testing.T) {
+		date, err := parseTime("2023-01-01T12:00:00Z", now)
+		assert.NoError(t, err)
+		assert.Equal(t, now.Add(-12*time.Hour), date)
+	})
+
+	t.Run("parses durations before now", func(t *testing.T) {
+		date, err := parseTime("24h", now)
+		assert.NoError(t, err)
+		assert.Equal(t, now.Add(-24*time.Hour), date)
+	})
+
+	t.Run("rejects invalid times", func(t *testing.T) {
+		_, err := parseTime("yesterday", now)
+		assert.EqualError(t, err, `invalid time "yesterday", use a RFC 3339 timestamp or a duration like 24h`)
+	})
+}
@@ -0,0 +1,321 @@
+// Command fdb-blobs operates a blob store in FoundationDB.
+//
+// Usage:
+//
+//	fdb-blobs [flags] <command> [command flags] [arguments]
+//
+// The commands are:
+//
+//	put      create a blob from a file or stdin
+//	get      write the content of a blob to stdout or a file
+//	stat     show information about a blob
+//	ls       list blobs
+//	rm       remove blobs
+//	restore  restore removed blobs
+//	gc       delete removed blobs and abandoned uploads
+//	du       show the usage of the store
+//	verify   check the integrity of the store
+//
+// Run fdb-blobs <command> -h for the flags of a command.
+//
+// The global flags select the store and the options new blobs are stored with,
+// like the chunk size, deduplication, compression and encryption. Encrypted
+// blobs can only be read with the keys they were encrypted with.
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	blobs "github.com/sunesimonsen/fdb-blobs"
+)
+
+// The settings given as global flags, and the input and output of the
+// commands.
+type env struct {
+	clusterFile string
+	namespace   string
+	apiVersion  int
+	chunkSize   int
+	dedup       bool
+	compression string
+	keysFile    string
+	keyId       string
+
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+
+	// Creates the store with the given namespace and options, connecting to
+	// the cluster unless it is replaced
+	newStore func(namespace string, opts ...blobs.Option) (*blobs.Store, error)
+}
+
+// Opens the store, this is done after the flags of a command are parsed so
+// invalid arguments are reported without connecting to the cluster.
+func (env env) openStore() (*blobs.Store, error) {
+	if env.namespace == "" {
+		return nil, usageError{msg: "the namespace flag is required"}
+	}
+
+	opts, err := env.storeOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	return env.newStore(env.namespace, opts...)
+}
+
+// Connects to the cluster and creates the store with the given namespace and
+// options.
+func (env env) connect(namespace string, opts ...blobs.Option) (*blobs.Store, error) {
+	err := fdb.APIVersion(env.apiVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := fdb.OpenDatabase(env.clusterFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return blobs.NewStore(db, namespace, opts...)
+}
+
+// The codecs that can be selected with the compression flag.
+var codecs = map[string]blobs.Codec{
+	"gzip":   blobs.GzipCodec{},
+	"zstd":   blobs.ZstdCodec{},
+	"snappy": blobs.SnappyCodec{},
+}
+
+// Returns the store options given by the global flags.
+func (env env) storeOptions() ([]blobs.Option, error) {
+	var opts []blobs.Option
+
+	if env.chunkSize != 0 {
+		opts = append(opts, blobs.WithChunkSize(env.chunkSize))
+	}
+
+	if env.dedup {
+		opts = append(opts, blobs.WithDeduplication())
+	}
+
+	if env.compression != "" {
+		codec, ok := codecs[env.compression]
+		if !ok {
+			return nil, usageError{msg: fmt.Sprintf("unknown compression %q, use gzip, zstd or snappy", env.compression)}
+		}
+
+		opts = append(opts, blobs.WithCompression(codec))
+	}
+
+	if env.keysFile != "" {
+		keyProvider, err := readKeysFile(env.keysFile, env.keyId)
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, blobs.WithEncryption(keyProvider))
+	} else if env.keyId != "" {
+		return nil, usageError{msg: "the key-id flag requires the keys-file flag"}
+	}
+
+	return opts, nil
+}
+
+// Reads the key encryption keys from a file with a key per line, given as the
+// key id followed by the hex encoded key. Empty lines and lines starting with #
+// are ignored.
+//
+// New blobs are encrypted with the key with the given id, defaulting to the
+// first key of the file.
+func readKeysFile(path string, keyId string) (*blobs.AESKeyProvider, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	keyProvider := &blobs.AESKeyProvider{Keys: map[string][]byte{}, CurrentKeyId: keyId}
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected a key id and a hex encoded key", path, line)
+		}
+
+		key, err := hex.DecodeString(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid key: %w", path, line, err)
+		}
+
+		keyProvider.Keys[fields[0]] = key
+
+		if keyProvider.CurrentKeyId == "" {
+			keyProvider.CurrentKeyId = fields[0]
+		}
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := keyProvider.Keys[keyProvider.CurrentKeyId]; !ok {
+		return nil, usageError{msg: fmt.Sprintf("the key %q isn't in %s", keyProvider.CurrentKeyId, path)}
+	}
+
+	return keyProvider, nil
+}
+
+type command struct {
+	name  string
+	usage string
+	run   func(env env, args []string) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"put", "put [-content-type type] [-filename name] [file]", put},
+		{"get", "get [-o file] [-offset n] [-length n] [-workers n] id", get},
+		{"stat", "stat id", stat},
+		{"ls", "ls [-limit n] [-desc]", ls},
+		{"rm", "rm id...", rm},
+		{"restore", "restore id...", restore},
+		{"gc", "gc [-removed-before time] [-uploads-before time]", gc},
+		{"du", "du", du},
+		{"verify", "verify [-repair]", verify},
+	}
+}
+
+func lookupCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+
+	return command{}, false
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: fdb-blobs [flags] <command> [command flags] [arguments]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %s\n", cmd.usage)
+	}
+	fmt.Fprintf(out, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	env := env{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}
+
+	flag.StringVar(&env.clusterFile, "cluster-file", os.Getenv("FDB_CLUSTER_FILE"), "the FoundationDB cluster file, defaults to $FDB_CLUSTER_FILE or the default cluster file")
+	flag.StringVar(&env.namespace, "namespace", os.Getenv("FDB_BLOBS_NAMESPACE"), "the namespace of the store, defaults to $FDB_BLOBS_NAMESPACE")
+	flag.IntVar(&env.apiVersion, "api-version", 710, "the FoundationDB API version")
+	flag.IntVar(&env.chunkSize, "chunk-size", 0, "the chunk size of new blobs, defaults to the chunk size of the store")
+	flag.BoolVar(&env.dedup, "dedup", false, "store the chunks of new blobs content addressed, deduplicating identical chunks")
+	flag.StringVar(&env.compression, "compression", "", "compress the chunks of new blobs with gzip, zstd or snappy")
+	flag.StringVar(&env.keysFile, "keys-file", os.Getenv("FDB_BLOBS_KEYS_FILE"), "a file with a key id and a hex encoded AES key per line, used to encrypt new blobs and decrypt encrypted blobs, defaults to $FDB_BLOBS_KEYS_FILE")
+	flag.StringVar(&env.keyId, "key-id", "", "the id of the key encrypting new blobs, defaults to the first key of the keys file")
+
+	flag.Usage = usage
+	flag.Parse()
+
+	env.newStore = env.connect
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := lookupCommand(flag.Arg(0))
+	if !ok {
+		fmt.Fprintf(os.Stderr, "fdb-blobs: unknown command %q\n\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+
+	err := cmd.run(env, flag.Args()[1:])
+
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+
+	var usageErr usageError
+	if errors.As(err, &usageErr) {
+		if !usageErr.reported {
+			fmt.Fprintf(os.Stderr, "fdb-blobs: %s\n", usageErr.msg)
+		}
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fdb-blobs: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// Error for invalid arguments.
+type usageError struct {
+	msg string
+	// If the error was reported together with the usage already
+	reported bool
+}
+
+func (err usageError) Error() string {
+	return err.msg
+}
+
+// Returns a flag set for the command with the given name, that prints the
+// usage of the command on invalid flags.
+func newFlagSet(env env, name string) *flag.FlagSet {
+	cmd, _ := lookupCommand(name)
+
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(env.stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: fdb-blobs %s\n", cmd.usage)
+		flags.PrintDefaults()
+	}
+
+	return flags
+}
+
+// Parses the flags of a command, and checks the number of remaining arguments
+// is between min and max, a negative max allows any number of arguments.
+func parseFlags(flags *flag.FlagSet, args []string, min, max int) error {
+	err := flags.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return err
+	}
+
+	if err != nil {
+		// The flag set has printed the error and usage already
+		return usageError{msg: err.Error(), reported: true}
+	}
+
+	if flags.NArg() < min || (max >= 0 && flags.NArg() > max) {
+		flags.Usage()
+		return usageError{msg: "wrong number of arguments"}
+	}
+
+	return nil
+}
@@ -0,0 +1,255 @@
+package blobs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Interface for codecs used to compress chunks.
+//
+// The name of the codec is stored with each blob, so it needs to be unique and
+// stable across releases.
+type Codec interface {
+	Name() string
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+var (
+	codecsMutex sync.RWMutex
+	codecs      = map[string]Codec{}
+)
+
+func init() {
+	RegisterCodec(GzipCodec{})
+	RegisterCodec(ZstdCodec{})
+	RegisterCodec(SnappyCodec{})
+}
+
+// Registers a codec, making blobs compressed with the codec readable.
+//
+// Codecs given to [WithCompression] are registered automatically, but blobs
+// compressed with a custom codec can only be read by processes that have
+// registered it. Registering a codec with the name of an already registered
+// codec replaces it.
+func RegisterCodec(codec Codec) {
+	codecsMutex.Lock()
+	defer codecsMutex.Unlock()
+
+	codecs[codec.Name()] = codec
+}
+
+// Implemented by codecs that can stop decompressing data expanding beyond a
+// limit, so corrupt chunks can't be expanded without bounds.
+type limitedDecompressor interface {
+	decompressLimited(data []byte, limit int) ([]byte, error)
+}
+
+var errDecompressionLimit = errors.New("decompressed data exceeds the chunk size")
+
+func lookupCodec(name string) (Codec, error) {
+	codecsMutex.RLock()
+	defer codecsMutex.RUnlock()
+
+	codec, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown codec %q", name)
+	}
+
+	return codec, nil
+}
+
+// Codec compressing chunks with gzip.
+type GzipCodec struct{}
+
+// Returns "gzip".
+func (codec GzipCodec) Name() string {
+	return "gzip"
+}
+
+// Compresses the data with gzip.
+func (codec GzipCodec) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	w := gzip.NewWriter(&buf)
+
+	_, err := w.Write(data)
+	if err != nil {
+		return nil, err
+	}
+
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Decompresses gzip compressed data.
+//
+// Data decompressing to more than the maximum chunk size is rejected.
+func (codec GzipCodec) Decompress(data []byte) ([]byte, error) {
+	return codec.decompressLimited(data, maxValueSize)
+}
+
+func (codec GzipCodec) decompressLimited(data []byte, limit int) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.Close()
+
+	decompressed, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(decompressed) > limit {
+		return nil, errDecompressionLimit
+	}
+
+	return decompressed, nil
+}
+
+// Codec compressing chunks with zstd.
+type ZstdCodec struct{}
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+	zstdErr     error
+)
+
+// The encoder and decoder are safe for concurrent use, so they are shared by
+// all blobs.
+func zstdCoders() (*zstd.Encoder, *zstd.Decoder, error) {
+	zstdOnce.Do(func() {
+		zstdEncoder, zstdErr = zstd.NewWriter(nil)
+		if zstdErr != nil {
+			return
+		}
+		zstdDecoder, zstdErr = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxValueSize+1))
+	})
+
+	return zstdEncoder, zstdDecoder, zstdErr
+}
+
+// Returns "zstd".
+func (codec ZstdCodec) Name() string {
+	return "zstd"
+}
+
+// Compresses the data with zstd.
+func (codec ZstdCodec) Compress(data []byte) ([]byte, error) {
+	encoder, _, err := zstdCoders()
+	if err != nil {
+		return nil, err
+	}
+
+	return encoder.EncodeAll(data, nil), nil
+}
+
+// Decompresses zstd compressed data.
+//
+// Data decompressing to more than the maximum chunk size is rejected.
+func (codec ZstdCodec) Decompress(data []byte) ([]byte, error) {
+	_, decoder, err := zstdCoders()
+	if err != nil {
+		return nil, err
+	}
+
+	return decoder.DecodeAll(data, nil)
+}
+
+func (codec ZstdCodec) decompressLimited(data []byte, limit int) ([]byte, error) {
+	decompressed, err := codec.Decompress(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(decompressed) > limit {
+		return nil, errDecompressionLimit
+	}
+
+	return decompressed, nil
+}
+
+// Codec compressing chunks with snappy.
+type SnappyCodec struct{}
+
+// Returns "snappy".
+func (codec SnappyCodec) Name() string {
+	return "snappy"
+}
+
+// Compresses the data with snappy.
+func (codec SnappyCodec) Compress(data []byte) ([]byte, error) {
+	return snappy.Encode(nil, data), nil
+}
+
+// Decompresses snappy compressed data.
+//
+// Data decompressing to more than the maximum chunk size is rejected.
+func (codec SnappyCodec) Decompress(data []byte) ([]byte, error) {
+	return codec.decompressLimited(data, maxValueSize)
+}
+
+func (codec SnappyCodec) decompressLimited(data []byte, limit int) ([]byte, error) {
+	// The decoded length is read from the header before anything is allocated
+	n, err := snappy.DecodedLen(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if n > limit {
+		return nil, errDecompressionLimit
+	}
+
+	return snappy.Decode(nil, data)
+}
+
+// Decompresses stored chunks starting at the given chunk index.
+//
+// Chunks that can't be decompressed or expand beyond the chunk size are
+// reported as a [CorruptBlobError].
+func decompressChunks(codec Codec, id Id, startChunk int64, chunkSize int, chunks [][]byte) ([][]byte, error) {
+	decompressed := make([][]byte, len(chunks))
+
+	if chunkSize <= 0 || chunkSize > maxValueSize {
+		chunkSize = maxValueSize
+	}
+
+	for i, chunk := range chunks {
+		chunkIndex := startChunk + int64(i)
+
+		var data []byte
+		var err error
+
+		if limited, ok := codec.(limitedDecompressor); ok {
+			data, err = limited.decompressLimited(chunk, chunkSize)
+		} else {
+			data, err = codec.Decompress(chunk)
+			if err == nil && len(data) > chunkSize {
+				err = errDecompressionLimit
+			}
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: can't decompress chunk %d of %q: %v", CorruptBlobError, chunkIndex, id, err)
+		}
+
+		decompressed[i] = data
+	}
+
+	return decompressed, nil
+}
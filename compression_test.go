@@ -0,0 +1,209 @@
+package blobs
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+)
+
+type reverseCodec struct{}
+
+func (codec reverseCodec) Name() string {
+	return "test-reverse"
+}
+
+func (codec reverseCodec) Compress(data []byte) ([]byte, error) {
+	reversed := make([]byte, len(data))
+	for i, b := range data {
+		reversed[len(data)-1-i] = b
+	}
+	return reversed, nil
+}
+
+func (c reverseCodec) Decompress(data []byte) ([]byte, error) {
+	return c.Compress(data)
+}
+
+func storedBytes(t *testing.T, blob *Blob) int {
+	entries, err := readTransact(blob.db, func(tr fdb.ReadTransaction) ([]fdb.KeyValue, error) {
+		return tr.GetRange(blob.dir.Sub("bytes"), fdb.RangeOptions{}).GetSliceWithError()
+	})
+	assert.NoError(t, err)
+
+	size := 0
+	for _, entry := range entries {
+		size += len(entry.Value)
+	}
+
+	return size
+}
+
+func TestCompression(t *testing.T) {
+	t.Run("compresses the stored chunks", func(t *testing.T) {
+		for _, codec := range []Codec{GzipCodec{}, ZstdCodec{}, SnappyCodec{}} {
+			store := createTestStore(WithChunkSize(1000), WithCompression(codec))
+
+			input := strings.Repeat(`{"level":"info","msg":"compressible"}`, 100)
+
+			blob, err := store.Create(strings.NewReader(input))
+			assert.NoError(t, err)
+
+			assert.True(t, storedBytes(t, blob) < len(input)/2, "stored bytes are compressed with %s", codec.Name())
+
+			data, err := io.ReadAll(blob.Reader())
+			assert.NoError(t, err)
+			assert.Equal(t, input, string(data), "codec: %s", codec.Name())
+		}
+	})
+
+	t.Run("fails when compressed chunks exceed the value size limit", func(t *testing.T) {
+		store := createTestStore(WithChunkSize(maxValueSize), WithCompression(GzipCodec{}))
+
+		input := make([]byte, maxValueSize)
+		_, err := rand.Read(input)
+		assert.NoError(t, err)
+
+		_, err = store.Create(bytes.NewReader(input))
+		assert.True(t, errors.Is(err, ChunkTooLargeError))
+
+		usage, err := store.Usage()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), usage.UploadBytes)
+	})
+
+	t.Run("allows creating and extracting blobs of different sizes", func(t *testing.T) {
+		store := createTestStore(WithChunkSize(100), WithCompression(GzipCodec{}))
+		lengths := []int{0, 10, 100, 101, 2000}
+
+		for _, length := range lengths {
+			input := make([]byte, length)
+			_, err := rand.Read(input)
+			assert.NoError(t, err)
+
+			blob, err := store.Create(bytes.NewReader(input))
+			assert.NoError(t, err)
+
+			data, err := io.ReadAll(blob.Reader())
+			assert.NoError(t, err)
+			assert.Equal(t, input, data, "length: %d", length)
+
+			buf := make([]byte, length/2)
+			_, err = blob.ReadAt(buf, int64(length/4))
+			assert.NoError(t, err)
+			assert.Equal(t, input[length/4:length/4+length/2], buf, "length: %d", length)
+		}
+	})
+
+	t.Run("fails for chunks expanding beyond the chunk size", func(t *testing.T) {
+		for _, codec := range []Codec{GzipCodec{}, ZstdCodec{}, SnappyCodec{}} {
+			store := createTestStore(WithChunkSize(100), WithCompression(codec))
+
+			blob, err := store.Create(strings.NewReader("content"))
+			assert.NoError(t, err)
+
+			bomb, err := codec.Compress(make([]byte, 1<<20))
+			assert.NoError(t, err)
+
+			err = updateTransact(store.db, func(tr fdb.Transaction) error {
+				tr.Set(blob.dir.Sub("bytes", 0), bomb)
+				return nil
+			})
+			assert.NoError(t, err)
+
+			_, err = io.ReadAll(blob.Reader())
+			assert.True(t, errors.Is(err, CorruptBlobError), "codec: %s", codec.Name())
+		}
+	})
+
+	t.Run("fails for chunks that can't be decompressed", func(t *testing.T) {
+		for _, codec := range []Codec{GzipCodec{}, ZstdCodec{}, SnappyCodec{}} {
+			store := createTestStore(WithChunkSize(100), WithCompression(codec))
+
+			blob, err := store.Create(strings.NewReader("content"))
+			assert.NoError(t, err)
+
+			err = updateTransact(store.db, func(tr fdb.Transaction) error {
+				tr.Set(blob.dir.Sub("bytes", 0), []byte("garbage"))
+				return nil
+			})
+			assert.NoError(t, err)
+
+			_, err = io.ReadAll(blob.Reader())
+			assert.True(t, errors.Is(err, CorruptBlobError), "codec: %s", codec.Name())
+		}
+	})
+
+	t.Run("supports custom codecs", func(t *testing.T) {
+		store := createTestStore(WithChunkSize(10), WithCompression(reverseCodec{}))
+
+		blob, err := store.Create(strings.NewReader("Hello, world!"))
+		assert.NoError(t, err)
+
+		data, err := io.ReadAll(blob.Reader())
+		assert.NoError(t, err)
+		assert.Equal(t, "Hello, world!", string(data))
+	})
+
+	t.Run("supports compression of content addressed chunks", func(t *testing.T) {
+		store := createTestStore(WithChunkSize(10), WithCompression(GzipCodec{}), WithDeduplication())
+
+		for i := 0; i < 2; i++ {
+			blob, err := store.Create(strings.NewReader("Hello, world!"))
+			assert.NoError(t, err)
+
+			data, err := io.ReadAll(blob.Reader())
+			assert.NoError(t, err)
+			assert.Equal(t, "Hello, world!", string(data))
+		}
+	})
+
+	t.Run("supports reading blobs stored with a different codec than the store", func(t *testing.T) {
+		db := fdbConnect()
+		ns := testNamespace()
+
+		plain, err := NewStore(db, ns)
+		assert.NoError(t, err)
+		first, err := plain.Create(strings.NewReader("uncompressed"))
+		assert.NoError(t, err)
+
+		compressed, err := NewStore(db, ns, WithCompression(GzipCodec{}))
+		assert.NoError(t, err)
+		second, err := compressed.Create(strings.NewReader("compressed"))
+		assert.NoError(t, err)
+
+		for _, id := range []Id{first.Id(), second.Id()} {
+			blob, err := plain.Blob(id)
+			assert.NoError(t, err)
+
+			_, err = io.ReadAll(blob.Reader())
+			assert.NoError(t, err)
+		}
+	})
+
+	t.Run("returns an error for blobs stored with an unknown codec", func(t *testing.T) {
+		store := createTestStore()
+
+		blob, err := store.Create(strings.NewReader("content"))
+		assert.NoError(t, err)
+
+		err = updateTransact(store.db, func(tr fdb.Transaction) error {
+			tr.Set(blob.dir.Sub("codec"), []byte("unknown"))
+			return nil
+		})
+		assert.NoError(t, err)
+
+		_, err = store.Blob(blob.Id())
+		assert.EqualError(t, err, `unknown codec "unknown"`)
+	})
+
+	t.Run("rejects nil codecs", func(t *testing.T) {
+		_, err := NewStore(fdbConnect(), testNamespace(), WithCompression(nil))
+		assert.EqualError(t, err, "invalid codec, codec can't be nil")
+	})
+}
@@ -0,0 +1,108 @@
+package blobs
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+// Reader that cancels a context after a given number of bytes has been read.
+type cancellingReader struct {
+	r      io.Reader
+	after  int
+	read   int
+	cancel context.CancelFunc
+}
+
+func (cr *cancellingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.read += n
+	if cr.after <= cr.read {
+		cr.cancel()
+	}
+	return n, err
+}
+
+func TestContext(t *testing.T) {
+	store := createTestStore(WithChunkSize(10), WithChunksPerTransaction(2))
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	t.Run("operations returns the error of a cancelled context", func(t *testing.T) {
+		_, err := store.CreateContext(cancelled, strings.NewReader("content"))
+		assert.Equal(t, context.Canceled, err)
+
+		_, err = store.UploadContext(cancelled, strings.NewReader("content"))
+		assert.Equal(t, context.Canceled, err)
+
+		blob, err := store.Create(strings.NewReader("content"))
+		assert.NoError(t, err)
+
+		_, err = store.BlobContext(cancelled, blob.Id())
+		assert.Equal(t, context.Canceled, err)
+
+		err = store.RemoveBlobContext(cancelled, blob.Id())
+		assert.Equal(t, context.Canceled, err)
+
+		_, err = store.DeleteRemovedBlobsBeforeContext(cancelled, time.Now())
+		assert.Equal(t, context.Canceled, err)
+
+		_, err = store.DeleteUploadsStartedBeforeContext(cancelled, time.Now())
+		assert.Equal(t, context.Canceled, err)
+	})
+
+	t.Run("cancelling an upload deletes the partial upload", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		r := &cancellingReader{r: bytes.NewReader(make([]byte, 200)), after: 50, cancel: cancel}
+
+		_, err := store.CreateContext(ctx, r)
+		assert.Equal(t, context.Canceled, err)
+
+		ids, err := store.uploadsDir.List(store.db, []string{})
+		assert.NoError(t, err)
+		assert.Equal(t, 0, len(ids))
+	})
+
+	t.Run("cancelling an append keeps the committed content", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		token, err := store.StartUpload()
+		assert.NoError(t, err)
+
+		r := &cancellingReader{r: bytes.NewReader(make([]byte, 200)), after: 50, cancel: cancel}
+
+		written, err := store.AppendUploadContext(ctx, token, r)
+		assert.Equal(t, context.Canceled, err)
+
+		uploaded, err := store.UploadLen(token)
+		assert.NoError(t, err)
+		assert.Equal(t, written, uploaded)
+		assert.True(t, 0 < uploaded && uploaded < 200, "partially uploaded")
+	})
+
+	t.Run("readers stops reading when the context is done", func(t *testing.T) {
+		blob, err := store.Create(bytes.NewReader(make([]byte, 200)))
+		assert.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		r := blob.ReaderContext(ctx)
+
+		buf := make([]byte, 20)
+		_, err = io.ReadFull(r, buf)
+		assert.NoError(t, err)
+
+		cancel()
+
+		_, err = io.ReadAll(r)
+		assert.Equal(t, context.Canceled, err)
+	})
+}
@@ -0,0 +1,386 @@
+package blobs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
+)
+
+// The keys describing the content of a blob, copied as is to copies of the
+// blob.
+var contentKeys = []string{"len", "chunkSize", "contentAddressed", "codec", "keyId", "dataKey", "checksum", "digestState"}
+
+// The stored form of a blob apart from its chunks.
+type blobHeader struct {
+	values map[string][]byte
+	// The values of the modified keys, used to detect modifications while
+	// copying. They aren't copied.
+	modified map[string][]byte
+	metadata Metadata
+}
+
+func readBlobHeader(tr fdb.ReadTransaction, dir subspace.Subspace) (blobHeader, error) {
+	header := blobHeader{values: map[string][]byte{}, modified: map[string][]byte{}}
+
+	keys := append(append([]string{}, contentKeys...), modifiedKeys...)
+	futures := make([]fdb.FutureByteSlice, len(keys))
+	for i, key := range keys {
+		futures[i] = tr.Get(dir.Sub(key))
+	}
+
+	for i, future := range futures {
+		data, err := future.Get()
+		if err != nil {
+			return header, err
+		}
+
+		if data == nil {
+			continue
+		}
+
+		if i < len(contentKeys) {
+			header.values[keys[i]] = data
+		} else {
+			header.modified[keys[i]] = data
+		}
+	}
+
+	var err error
+	header.metadata, err = readMetadata(tr, dir)
+
+	return header, err
+}
+
+// Returns the number of chunks needed for the length of the blob, or -1 when
+// the header has no chunk size.
+//
+// Blobs stored by earlier versions end with an empty chunk when the length is a
+// multiple of the chunk size, that chunk isn't counted.
+func (header blobHeader) chunkCount() int64 {
+	data := header.values["chunkSize"]
+	if data == nil || decodeUInt64(data) == 0 {
+		return -1
+	}
+
+	chunkSize := int64(decodeUInt64(data))
+
+	var length int64
+	if data := header.values["len"]; data != nil {
+		length = int64(decodeUInt64(data))
+	}
+
+	return (length + chunkSize - 1) / chunkSize
+}
+
+// A stored chunk as it is copied between blobs.
+type storedChunk struct {
+	index    int64
+	payload  []byte
+	checksum []byte
+}
+
+// Creates a new blob with the same content and metadata as the blob with the
+// given id.
+//
+// The stored chunks are copied inside FoundationDB in batches of the configured
+// chunks per transaction, without decoding them. Content addressed chunks are
+// referenced by the copy instead of being duplicated.
+//
+// The copy gets a new id and creation time. If the blob is modified or removed
+// while it is copied, the copy is deleted and a [BlobConflictError] or
+// [BlobNotFoundError] is returned.
+func (store *Store) CopyBlob(id Id) (Id, error) {
+	return store.CopyBlobContext(context.Background(), id)
+}
+
+// Like [Store.CopyBlob], but stops copying with the error of the context when it
+// is done. The partial copy is deleted when the context is done.
+func (store *Store) CopyBlobContext(ctx context.Context, id Id) (Id, error) {
+	return store.copyBlob(ctx, id, store)
+}
+
+// Like [Store.CopyBlob], but creates the copy in another store.
+//
+// The other store can use another namespace or database. Data keys of
+// encrypted blobs are rewrapped with the key provider of the other store, so it
+// needs a key provider to receive encrypted blobs.
+func (store *Store) CopyBlobTo(id Id, dst *Store) (Id, error) {
+	return store.CopyBlobToContext(context.Background(), id, dst)
+}
+
+// Like [Store.CopyBlobTo], but stops copying with the error of the context when
+// it is done. The partial copy is deleted when the context is done.
+func (store *Store) CopyBlobToContext(ctx context.Context, id Id, dst *Store) (Id, error) {
+	return store.copyBlob(ctx, id, dst)
+}
+
+func (store *Store) copyBlob(ctx context.Context, id Id, dst *Store) (Id, error) {
+	err := ctx.Err()
+	if err != nil {
+		return "", err
+	}
+
+	blobDir, err := store.openBlobDir(store.db, id)
+	if err != nil {
+		return "", err
+	}
+
+	header, err := readTransact(store.db, func(tr fdb.ReadTransaction) (blobHeader, error) {
+		return readBlobHeader(tr, blobDir)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if header.values["dataKey"] != nil && dst != store {
+		err := store.rewrapHeaderDataKey(header, dst)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// The copy is made as an upload in the destination, so a failed copy is
+	// deleted like any other abandoned upload
+	copyId := dst.idGenerator.NextId()
+
+	uploadDir, err := dst.uploadsDir.Create(dst.db, []string{string(copyId)}, nil)
+	if err != nil {
+		return "", err
+	}
+
+	token := UploadToken{dir: uploadDir}
+
+	var length int64
+	if data := header.values["len"]; data != nil {
+		length = int64(decodeUInt64(data))
+	}
+
+	err = updateTransact(dst.db, func(tr fdb.Transaction) error {
+		err := dst.checkQuota(tr, length)
+		if err != nil {
+			return err
+		}
+
+		dst.addUsage(tr, uploadBytesCounter, length)
+
+		unixTimestamp := dst.systemTime.Now().Unix()
+		tr.Set(uploadDir.Sub("uploadStartedAt"), encodeUInt64(uint64(unixTimestamp)))
+		dst.addToCleanupIndex(tr, uploadsIndex, unixTimestamp, copyId)
+		indexEntry(tr, dst.uploadsDir, uploadDir, string(copyId))
+
+		for key, value := range header.values {
+			tr.Set(uploadDir.Sub(key), value)
+		}
+
+		writeMetadata(tr, uploadDir, header.metadata)
+
+		return nil
+	})
+
+	if err == nil {
+		var copied int64
+		contentAddressed := header.values["contentAddressed"] != nil
+		copied, err = store.copyChunks(ctx, blobDir, dst, uploadDir, contentAddressed, header.chunkCount())
+
+		if err == nil {
+			err = store.checkCopiedBlob(id, blobDir, header, copied)
+		}
+	}
+
+	if err != nil {
+		return "", dst.abortFailedUpload(token, err)
+	}
+
+	return transact(dst.db, func(tr fdb.Transaction) (Id, error) {
+		return dst.CommitUpload(tr, token)
+	})
+}
+
+// Unwraps the data key of the header with the key provider of the store and
+// wraps it with the key provider of the destination.
+func (store *Store) rewrapHeaderDataKey(header blobHeader, dst *Store) error {
+	if store.keyProvider == nil {
+		return errors.New("blob is encrypted, but the store has no key provider")
+	}
+
+	if dst.keyProvider == nil {
+		return errors.New("blob is encrypted, but the destination store has no key provider")
+	}
+
+	dataKey, err := store.keyProvider.UnwrapKey(string(header.values["keyId"]), header.values["dataKey"])
+	if err != nil {
+		return err
+	}
+
+	keyId, wrappedKey, err := dst.keyProvider.WrapKey(dataKey)
+	if err != nil {
+		return err
+	}
+
+	header.values["keyId"] = []byte(keyId)
+	header.values["dataKey"] = wrappedKey
+
+	return nil
+}
+
+// The keys that change whenever the content of a blob is modified.
+var modifiedKeys = []string{"len", "checksum", "digestState", "truncations", "committedVersion"}
+
+// Checks that the blob still exists and wasn't modified while its chunks were
+// copied across multiple transactions, and that the copied number of chunks
+// matches the length of the blob.
+func (store *Store) checkCopiedBlob(id Id, blobDir subspace.Subspace, header blobHeader, copied int64) error {
+	conflictError := fmt.Errorf("%w: blob %q was modified while it was copied", BlobConflictError, id)
+
+	current, err := readTransact(store.db, func(tr fdb.ReadTransaction) (blobHeader, error) {
+		err := store.checkBlobExists(tr, id)
+		if err != nil {
+			return blobHeader{}, err
+		}
+
+		return readBlobHeader(tr, blobDir)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for _, key := range modifiedKeys {
+		if !bytes.Equal(current.modified[key], header.modified[key]) {
+			return conflictError
+		}
+	}
+
+	if expected := header.chunkCount(); expected >= 0 && copied != expected {
+		return fmt.Errorf("%w: copied %d chunks of %q, but its length needs %d", CorruptBlobError, copied, id, expected)
+	}
+
+	return nil
+}
+
+// Copies the stored chunks of the blob directory to the upload directory of the
+// destination, a batch of chunks per transaction, and returns the number of
+// copied chunks.
+//
+// Only the given number of chunks are copied, chunks beyond the length of the
+// blob are skipped. A negative chunk count copies all stored chunks.
+func (store *Store) copyChunks(ctx context.Context, blobDir directory.DirectorySubspace, dst *Store, uploadDir subspace.Subspace, contentAddressed bool, chunkCount int64) (int64, error) {
+	chunksKey := "bytes"
+	if contentAddressed {
+		chunksKey = "hashes"
+	}
+
+	var end fdb.KeyConvertible
+	if chunkCount >= 0 {
+		end = blobDir.Sub(chunksKey, chunkCount)
+	} else {
+		_, end = blobDir.Sub(chunksKey).FDBRangeKeys()
+	}
+
+	var nextChunk, copied int64
+
+	for {
+		err := ctx.Err()
+		if err != nil {
+			return copied, err
+		}
+
+		chunks, err := readTransact(store.db, func(tr fdb.ReadTransaction) ([]storedChunk, error) {
+			return store.readStoredChunks(tr, blobDir, chunksKey, nextChunk, end)
+		})
+
+		if err != nil {
+			return copied, err
+		}
+
+		if len(chunks) == 0 {
+			return copied, nil
+		}
+
+		err = updateTransact(dst.db, func(tr fdb.Transaction) error {
+			for _, chunk := range chunks {
+				if contentAddressed {
+					err := dst.putChunk(tr, uploadDir, chunk.index, chunk.payload)
+					if err != nil {
+						return err
+					}
+				} else {
+					tr.Set(uploadDir.Sub("bytes", chunk.index), chunk.payload)
+				}
+
+				if chunk.checksum != nil {
+					tr.Set(uploadDir.Sub("checksums", chunk.index), chunk.checksum)
+				}
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return copied, err
+		}
+
+		copied += int64(len(chunks))
+
+		if len(chunks) < store.chunksPerTransaction {
+			return copied, nil
+		}
+
+		nextChunk = chunks[len(chunks)-1].index + 1
+	}
+}
+
+// Reads a batch of stored chunks, starting at the given chunk index, without
+// decoding them.
+func (store *Store) readStoredChunks(tr fdb.ReadTransaction, blobDir directory.DirectorySubspace, chunksKey string, startChunk int64, end fdb.KeyConvertible) ([]storedChunk, error) {
+	chunksSpace := blobDir.Sub(chunksKey)
+
+	entries, err := tr.GetRange(fdb.KeyRange{Begin: chunksSpace.Sub(startChunk), End: end}, fdb.RangeOptions{
+		Limit: store.chunksPerTransaction,
+	}).GetSliceWithError()
+
+	if err != nil {
+		return nil, err
+	}
+
+	chunks := make([]storedChunk, len(entries))
+	checksums := make([]fdb.FutureByteSlice, len(entries))
+
+	for i, entry := range entries {
+		t, err := chunksSpace.Unpack(entry.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		chunks[i].index = t[0].(int64)
+		chunks[i].payload = entry.Value
+		checksums[i] = tr.Get(blobDir.Sub("checksums", chunks[i].index))
+	}
+
+	if chunksKey == "hashes" {
+		payloads, err := resolveChunks(tr, store.chunksDir, entries)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range chunks {
+			chunks[i].payload = payloads[i]
+		}
+	}
+
+	for i := range chunks {
+		data, err := checksums[i].Get()
+		if err != nil {
+			return nil, err
+		}
+
+		chunks[i].checksum = data
+	}
+
+	return chunks, nil
+}
@@ -0,0 +1,234 @@
+package blobs
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+)
+
+func readBlob(t *testing.T, store *Store, id Id) string {
+	blob, err := store.Blob(id)
+	assert.NoError(t, err)
+
+	data, err := io.ReadAll(blob.Reader())
+	assert.NoError(t, err)
+
+	return string(data)
+}
+
+func TestCopyBlob(t *testing.T) {
+	input := strings.Repeat("content ", 100)
+
+	t.Run("copies the content and metadata of the blob", func(t *testing.T) {
+		store := createTestStore(WithChunkSize(100), WithChunksPerTransaction(2))
+
+		blob, err := store.Create(strings.NewReader(input), WithFilename("doc.txt"), WithAttribute("kind", "draft"))
+		assert.NoError(t, err)
+
+		id, err := store.CopyBlob(blob.Id())
+		assert.NoError(t, err)
+		assert.NotEqual(t, blob.Id(), id)
+
+		assert.Equal(t, input, readBlob(t, store, id))
+
+		copied, err := store.Blob(id)
+		assert.NoError(t, err)
+
+		metadata, err := copied.Metadata()
+		assert.NoError(t, err)
+		assert.Equal(t, "doc.txt", metadata.Filename)
+		assert.Equal(t, map[string]string{"kind": "draft"}, metadata.Attributes)
+
+		checksum, err := blob.Checksum()
+		assert.NoError(t, err)
+		copiedChecksum, err := copied.Checksum()
+		assert.NoError(t, err)
+		assert.Equal(t, checksum, copiedChecksum)
+	})
+
+	t.Run("copies of deduplicated blobs outlive the original", func(t *testing.T) {
+		store := createTestStore(WithChunkSize(100), WithDeduplication())
+
+		blob, err := store.Create(strings.NewReader(input))
+		assert.NoError(t, err)
+
+		id, err := store.CopyBlob(blob.Id())
+		assert.NoError(t, err)
+
+		err = store.RemoveBlob(blob.Id())
+		assert.NoError(t, err)
+		_, err = store.DeleteRemovedBlobsBefore(time.Now().Add(time.Minute))
+		assert.NoError(t, err)
+
+		assert.Equal(t, input, readBlob(t, store, id))
+	})
+
+	t.Run("copies encrypted blobs to another store", func(t *testing.T) {
+		store := createTestStore(
+			WithChunkSize(100),
+			WithEncryption(&AESKeyProvider{
+				Keys:         map[string][]byte{"key-1": testKey(t)},
+				CurrentKeyId: "key-1",
+			}),
+			WithCompression(GzipCodec{}),
+		)
+		other := createTestStore(
+			WithDeduplication(),
+			WithEncryption(&AESKeyProvider{
+				Keys:         map[string][]byte{"key-2": testKey(t)},
+				CurrentKeyId: "key-2",
+			}),
+		)
+
+		content := make([]byte, 1234)
+		_, err := rand.Read(content)
+		assert.NoError(t, err)
+
+		blob, err := store.Create(strings.NewReader(string(content)))
+		assert.NoError(t, err)
+
+		id, err := store.CopyBlobTo(blob.Id(), other)
+		assert.NoError(t, err)
+
+		assert.Equal(t, string(content), readBlob(t, other, id))
+	})
+
+	t.Run("encrypted blobs can't be copied to a store without key provider", func(t *testing.T) {
+		store := createTestStore(WithEncryption(&AESKeyProvider{
+			Keys:         map[string][]byte{"key-1": testKey(t)},
+			CurrentKeyId: "key-1",
+		}))
+		other := createTestStore()
+
+		blob, err := store.Create(strings.NewReader(input))
+		assert.NoError(t, err)
+
+		_, err = store.CopyBlobTo(blob.Id(), other)
+		assert.EqualError(t, err, "blob is encrypted, but the destination store has no key provider")
+	})
+
+	t.Run("copies empty blobs", func(t *testing.T) {
+		store := createTestStore()
+		other := createTestStore()
+
+		blob, err := store.Create(strings.NewReader(""))
+		assert.NoError(t, err)
+
+		id, err := store.CopyBlob(blob.Id())
+		assert.NoError(t, err)
+		assert.Equal(t, "", readBlob(t, store, id))
+
+		id, err = store.CopyBlobTo(blob.Id(), other)
+		assert.NoError(t, err)
+		assert.Equal(t, "", readBlob(t, other, id))
+	})
+
+	t.Run("skips the empty chunk ending blobs stored by earlier versions", func(t *testing.T) {
+		store := createTestStore(WithChunkSize(100), WithChunksPerTransaction(2))
+		other := createTestStore()
+
+		blob, err := store.Create(strings.NewReader(input))
+		assert.NoError(t, err)
+
+		empty, err := store.Create(strings.NewReader(""))
+		assert.NoError(t, err)
+
+		// Earlier versions stored an empty chunk at the end of the content
+		err = updateTransact(store.db, func(tr fdb.Transaction) error {
+			tr.Set(blob.dir.Sub("bytes", 8), []byte{})
+			tr.Set(empty.dir.Sub("bytes", 0), []byte{})
+			return nil
+		})
+		assert.NoError(t, err)
+
+		id, err := store.CopyBlob(blob.Id())
+		assert.NoError(t, err)
+		assert.Equal(t, input, readBlob(t, store, id))
+
+		id, err = store.CopyBlobTo(blob.Id(), other)
+		assert.NoError(t, err)
+		assert.Equal(t, input, readBlob(t, other, id))
+
+		id, err = store.CopyBlob(empty.Id())
+		assert.NoError(t, err)
+		assert.Equal(t, "", readBlob(t, store, id))
+	})
+
+	t.Run("fails when chunks are missing", func(t *testing.T) {
+		store := createTestStore(WithChunkSize(100), WithChunksPerTransaction(2))
+
+		blob, err := store.Create(strings.NewReader(input))
+		assert.NoError(t, err)
+
+		err = updateTransact(store.db, func(tr fdb.Transaction) error {
+			tr.Clear(blob.dir.Sub("bytes", 7))
+			return nil
+		})
+		assert.NoError(t, err)
+
+		_, err = store.CopyBlob(blob.Id())
+		assert.True(t, errors.Is(err, CorruptBlobError))
+
+		usage, err := store.Usage()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), usage.UploadBytes)
+	})
+
+	t.Run("fails when the blob is modified while it is copied", func(t *testing.T) {
+		store := createTestStore(WithChunkSize(100))
+
+		blob, err := store.Create(strings.NewReader(input))
+		assert.NoError(t, err)
+
+		header, err := readTransact(store.db, func(tr fdb.ReadTransaction) (blobHeader, error) {
+			return readBlobHeader(tr, blob.dir)
+		})
+		assert.NoError(t, err)
+
+		_, err = store.AppendBlob(blob.Id(), strings.NewReader("more"))
+		assert.NoError(t, err)
+
+		err = store.checkCopiedBlob(blob.Id(), blob.dir, header, 8)
+		assert.True(t, errors.Is(err, BlobConflictError))
+
+		err = store.RemoveBlob(blob.Id())
+		assert.NoError(t, err)
+
+		err = store.checkCopiedBlob(blob.Id(), blob.dir, header, 8)
+		assert.True(t, errors.Is(err, BlobNotFoundError))
+	})
+
+	t.Run("fails when the blob is truncated and appended back while it is copied", func(t *testing.T) {
+		store := createTestStore(WithChunkSize(100))
+
+		blob, err := store.Create(strings.NewReader(input))
+		assert.NoError(t, err)
+
+		header, err := readTransact(store.db, func(tr fdb.ReadTransaction) (blobHeader, error) {
+			return readBlobHeader(tr, blob.dir)
+		})
+		assert.NoError(t, err)
+
+		// The blob ends up with the same length and content
+		err = store.TruncateBlob(blob.Id(), uint64(len(input)-8))
+		assert.NoError(t, err)
+		_, err = store.AppendBlob(blob.Id(), strings.NewReader("content "))
+		assert.NoError(t, err)
+
+		err = store.checkCopiedBlob(blob.Id(), blob.dir, header, 8)
+		assert.True(t, errors.Is(err, BlobConflictError))
+	})
+
+	t.Run("fails for unknown blobs", func(t *testing.T) {
+		store := createTestStore()
+
+		_, err := store.CopyBlob("missing")
+		assert.EqualError(t, err, `blob not found: "missing"`)
+	})
+}
@@ -1,11 +1,13 @@
 package blobs
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/apple/foundationdb/bindings/go/src/fdb"
 	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
 )
 
 type pathSegments []string
@@ -22,3 +24,92 @@ func createDirectory(db fdb.Database, parentDir directory.Directory, path ...str
 	}
 	return dir, err
 }
+
+// Blobs, uploads and removed blobs are directories of their own. They are
+// indexed by name in the subspace of their parent directory, mapped to their
+// prefix, as the directory layer can only list all subdirectories at once.
+func entriesSubspace(dir directory.DirectorySubspace) subspace.Subspace {
+	return dir.Sub("entries")
+}
+
+// Adds the entry directory with the given name to the index of the directory.
+func indexEntry(tr fdb.Transaction, dir, entryDir directory.DirectorySubspace, name string) {
+	tr.Set(entriesSubspace(dir).Sub(name), entryDir.Bytes())
+}
+
+// Moves the entry directory with the given name from the directory to the
+// destination directory.
+func moveEntry(tr fdb.Transaction, dir, entryDir, dstDir directory.DirectorySubspace, name string) (directory.DirectorySubspace, error) {
+	dst, err := entryDir.MoveTo(tr, append(dstDir.GetPath(), name))
+	if err != nil {
+		return dst, err
+	}
+
+	tr.Clear(entriesSubspace(dir).Sub(name))
+	indexEntry(tr, dstDir, dst, name)
+
+	return dst, nil
+}
+
+// Removes the entry directory with the given name from the directory.
+func removeEntry(tr fdb.Transaction, dir directory.DirectorySubspace, name string) (bool, error) {
+	tr.Clear(entriesSubspace(dir).Sub(name))
+	return dir.Remove(tr, []string{name})
+}
+
+// Indexes the entries of the directory created before entries were indexed.
+//
+// This is done once per directory. The names are listed in a single
+// transaction, and the entries are then indexed in batches across multiple
+// transactions. Entries that are gone by the time their batch is indexed are
+// skipped.
+func indexEntries(db fdb.Database, dir directory.DirectorySubspace, batchSize int) error {
+	indexedKey := dir.Sub("indexed")
+
+	indexed, err := readTransact(db, func(tr fdb.ReadTransaction) ([]byte, error) {
+		return tr.Get(indexedKey).Get()
+	})
+
+	if err != nil || indexed != nil {
+		return err
+	}
+
+	names, err := dir.List(db, []string{})
+	if err != nil {
+		return err
+	}
+
+	for len(names) > 0 {
+		batch := names
+		if len(batch) > batchSize {
+			batch = batch[:batchSize]
+		}
+		names = names[len(batch):]
+
+		err := updateTransact(db, func(tr fdb.Transaction) error {
+			for _, name := range batch {
+				entryDir, err := dir.Open(tr, []string{name}, nil)
+				if errors.Is(err, directory.ErrDirNotExists) {
+					continue
+				}
+
+				if err != nil {
+					return err
+				}
+
+				indexEntry(tr, dir, entryDir, name)
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return updateTransact(db, func(tr fdb.Transaction) error {
+		tr.Set(indexedKey, encodeUInt64(1))
+		return nil
+	})
+}
@@ -0,0 +1,265 @@
+package blobs
+
+import (
+	"crypto/cipher"
+	"fmt"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
+)
+
+// How the chunks of a blob is stored, this is saved with each blob.
+type chunkEncoding struct {
+	chunkSize        int
+	contentAddressed bool
+	codec            Codec
+	aead             cipher.AEAD
+}
+
+// Encodes the content of the chunk with the given index for storage.
+func (enc chunkEncoding) encode(chunkIndex int64, chunk []byte) ([]byte, error) {
+	payload := chunk
+
+	if enc.codec != nil {
+		compressed, err := enc.codec.Compress(payload)
+		if err != nil {
+			return nil, err
+		}
+		payload = compressed
+	}
+
+	if enc.aead != nil {
+		payload = seal(enc.aead, payload, chunkAdditionalData(chunkIndex))
+	}
+
+	return payload, nil
+}
+
+// Decodes stored chunks starting at the given chunk index into their content.
+func (enc chunkEncoding) decode(id Id, startChunk int64, chunks [][]byte) ([][]byte, error) {
+	var err error
+
+	if enc.aead != nil {
+		chunks, err = decryptChunks(enc.aead, id, startChunk, chunks)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if enc.codec != nil {
+		chunks, err = decompressChunks(enc.codec, id, startChunk, enc.chunkSize, chunks)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return chunks, nil
+}
+
+// Returns the checksum stored for the chunk with the given content and stored
+// payload.
+//
+// The checksum of encrypted chunks is computed over the payload, so it doesn't
+// reveal anything about the content.
+func (enc chunkEncoding) storedChecksum(chunk, payload []byte) []byte {
+	if enc.aead != nil {
+		return chunkChecksum(payload)
+	}
+
+	return chunkChecksum(chunk)
+}
+
+// Returns the chunks the stored checksums are computed over, the payloads of
+// encrypted chunks and the content of other chunks.
+func (enc chunkEncoding) checksummedChunks(payloads, chunks [][]byte) [][]byte {
+	if enc.aead != nil {
+		return payloads
+	}
+
+	return chunks
+}
+
+// Seals a value describing the content of an encrypted blob, like its checksum
+// or digest state, with the data key of the blob. Values of blobs that aren't encrypted
+// are stored as they are.
+//
+// The name of the value is used as additional data, so sealed values can't be
+// swapped.
+func (enc chunkEncoding) sealValue(name string, value []byte) []byte {
+	if enc.aead == nil || value == nil {
+		return value
+	}
+
+	return seal(enc.aead, value, []byte(name))
+}
+
+// Opens a value sealed with [chunkEncoding.sealValue].
+func (enc chunkEncoding) openValue(id Id, name string, value []byte) ([]byte, error) {
+	if enc.aead == nil || value == nil {
+		return value, nil
+	}
+
+	data, err := open(enc.aead, value, []byte(name))
+	if err != nil {
+		return nil, fmt.Errorf("%w: can't decrypt the %s of %q", CorruptBlobError, name, id)
+	}
+
+	return data, nil
+}
+
+// Reads the chunk encoding stored in the given blob directory.
+func (store *Store) readChunkEncoding(tr fdb.ReadTransaction, dir subspace.Subspace) (chunkEncoding, error) {
+	var enc chunkEncoding
+
+	chunkSize := tr.Get(dir.Sub("chunkSize"))
+	contentAddressed := tr.Get(dir.Sub("contentAddressed"))
+	codec := tr.Get(dir.Sub("codec"))
+	keyId := tr.Get(dir.Sub("keyId"))
+	dataKey := tr.Get(dir.Sub("dataKey"))
+
+	data, err := chunkSize.Get()
+	if err != nil {
+		return enc, err
+	}
+	if data != nil {
+		enc.chunkSize = int(decodeUInt64(data))
+	}
+
+	data, err = contentAddressed.Get()
+	if err != nil {
+		return enc, err
+	}
+	enc.contentAddressed = data != nil
+
+	data, err = codec.Get()
+	if err != nil {
+		return enc, err
+	}
+	if data != nil {
+		enc.codec, err = lookupCodec(string(data))
+		if err != nil {
+			return enc, err
+		}
+	}
+
+	wrappedKey, err := dataKey.Get()
+	if err != nil {
+		return enc, err
+	}
+	if wrappedKey != nil {
+		data, err = keyId.Get()
+		if err != nil {
+			return enc, err
+		}
+
+		enc.aead, err = store.unwrapDataKey(data, wrappedKey)
+		if err != nil {
+			return enc, err
+		}
+	}
+
+	return enc, nil
+}
+
+// Writes the chunk encoding of the store with the given chunk size to the given
+// blob directory.
+func (store *Store) writeChunkEncoding(tr fdb.Transaction, dir subspace.Subspace, chunkSize int, keyId string, wrappedKey []byte) {
+	tr.Set(dir.Sub("chunkSize"), encodeUInt64(uint64(chunkSize)))
+
+	if store.deduplicate {
+		tr.Set(dir.Sub("contentAddressed"), encodeUInt64(1))
+	}
+
+	if store.codec != nil {
+		tr.Set(dir.Sub("codec"), []byte(store.codec.Name()))
+	}
+
+	if wrappedKey != nil {
+		tr.Set(dir.Sub("keyId"), []byte(keyId))
+		tr.Set(dir.Sub("dataKey"), wrappedKey)
+	}
+}
+
+// Returns the largest chunk size the store can write. Encrypted chunks leave
+// room for the nonce and tag.
+//
+// Compression can grow chunks of incompressible content beyond the chunk size,
+// that is checked when the chunks are written.
+func (store *Store) maxChunkSize() int {
+	if store.keyProvider != nil {
+		return maxValueSize - encryptionOverhead
+	}
+
+	return maxValueSize
+}
+
+// Encodes and writes the chunk with the given index to the blob directory.
+//
+// Returns a [ChunkTooLargeError] if the encoded chunk exceeds the value size
+// limit of FoundationDB.
+func (store *Store) writeChunk(tr fdb.Transaction, dir subspace.Subspace, enc chunkEncoding, chunkIndex int64, chunk []byte) error {
+	payload, err := enc.encode(chunkIndex, chunk)
+	if err != nil {
+		return err
+	}
+
+	if len(payload) > maxValueSize {
+		return fmt.Errorf("%w: chunk %d is %d bytes when encoded, the limit is %d bytes", ChunkTooLargeError, chunkIndex, len(payload), maxValueSize)
+	}
+
+	if enc.contentAddressed {
+		hash, err := tr.Get(dir.Sub("hashes", chunkIndex)).Get()
+		if err != nil {
+			return err
+		}
+
+		if hash != nil {
+			// Overwriting a chunk releases the previous content
+			err := store.releaseChunk(tr, hash)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = store.putChunk(tr, dir, chunkIndex, payload)
+		if err != nil {
+			return err
+		}
+	} else {
+		tr.Set(dir.Sub("bytes", chunkIndex), payload)
+	}
+
+	tr.Set(dir.Sub("checksums", chunkIndex), enc.storedChecksum(chunk, payload))
+
+	return nil
+}
+
+// Reads and decodes the chunk with the given index from the blob directory.
+func (store *Store) readChunk(tr fdb.ReadTransaction, id Id, dir subspace.Subspace, enc chunkEncoding, chunkIndex int64) ([]byte, error) {
+	var payload []byte
+	var err error
+
+	if enc.contentAddressed {
+		hash, err := tr.Get(dir.Sub("hashes", chunkIndex)).Get()
+		if err != nil {
+			return nil, err
+		}
+
+		payload, err = tr.Get(store.chunksDir.Sub("data", hash)).Get()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		payload, err = tr.Get(dir.Sub("bytes", chunkIndex)).Get()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	chunks, err := enc.decode(id, chunkIndex, [][]byte{payload})
+	if err != nil {
+		return nil, err
+	}
+
+	return chunks[0], nil
+}
@@ -0,0 +1,249 @@
+package blobs
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
+)
+
+const dataKeySize = 32
+
+const rewrapBatchSize = 100
+
+// Interface for providers wrapping the data keys blobs are encrypted with.
+//
+// Each blob is encrypted with its own data key. The data key is wrapped by the
+// key provider, usually by encrypting it with a key encryption key kept in a key
+// management system, and the wrapped key is stored with the blob.
+type KeyProvider interface {
+	// Wraps the data key, returning the id of the key encryption key used and
+	// the wrapped data key.
+	WrapKey(dataKey []byte) (keyId string, wrappedKey []byte, err error)
+	// Unwraps a data key wrapped by the key encryption key with the given id.
+	UnwrapKey(keyId string, wrappedKey []byte) ([]byte, error)
+}
+
+// Key provider wrapping data keys with AES-GCM using locally held key
+// encryption keys.
+//
+// New data keys are wrapped with the key with the current key id, all keys are
+// used for unwrapping. Rotating keys is done by adding a new key, making it the
+// current key and rewrapping the data keys using [Store.RewrapDataKeys].
+type AESKeyProvider struct {
+	// The key encryption keys by id, each key needs to be 16, 24 or 32 bytes.
+	Keys map[string][]byte
+	// The id of the key used to wrap new data keys.
+	CurrentKeyId string
+}
+
+func (kp *AESKeyProvider) aead(keyId string) (cipher.AEAD, error) {
+	key, ok := kp.Keys[keyId]
+	if !ok {
+		return nil, fmt.Errorf("unknown key encryption key %q", keyId)
+	}
+
+	return newAEAD(key)
+}
+
+// Wraps the data key with the current key encryption key.
+func (kp *AESKeyProvider) WrapKey(dataKey []byte) (string, []byte, error) {
+	aead, err := kp.aead(kp.CurrentKeyId)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return kp.CurrentKeyId, seal(aead, dataKey, []byte(kp.CurrentKeyId)), nil
+}
+
+// Unwraps the data key with the key encryption key with the given id.
+func (kp *AESKeyProvider) UnwrapKey(keyId string, wrappedKey []byte) ([]byte, error) {
+	aead, err := kp.aead(keyId)
+	if err != nil {
+		return nil, err
+	}
+
+	return open(aead, wrappedKey, []byte(keyId))
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// Encrypts the plaintext with a random nonce, that is prepended to the result.
+func seal(aead cipher.AEAD, plaintext, additionalData []byte) []byte {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+
+	_, err := rand.Read(nonce)
+	if err != nil {
+		panic(err)
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, additionalData)
+}
+
+func open(aead cipher.AEAD, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("invalid ciphertext, too short")
+	}
+
+	nonce := ciphertext[:aead.NonceSize()]
+
+	return aead.Open(nil, nonce, ciphertext[aead.NonceSize():], additionalData)
+}
+
+// The chunk index is used as additional data, so chunks can't be reordered.
+func chunkAdditionalData(chunkIndex int64) []byte {
+	return encodeUInt64(uint64(chunkIndex))
+}
+
+// Generates a new data key and returns a cipher for it together with the
+// wrapped key.
+func newDataKey(keyProvider KeyProvider) (cipher.AEAD, string, []byte, error) {
+	dataKey := make([]byte, dataKeySize)
+
+	_, err := rand.Read(dataKey)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	keyId, wrappedKey, err := keyProvider.WrapKey(dataKey)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	aead, err := newAEAD(dataKey)
+
+	return aead, keyId, wrappedKey, err
+}
+
+func (store *Store) unwrapDataKey(keyId, wrappedKey []byte) (cipher.AEAD, error) {
+	if store.keyProvider == nil {
+		return nil, errors.New("blob is encrypted, but the store has no key provider")
+	}
+
+	dataKey, err := store.keyProvider.UnwrapKey(string(keyId), wrappedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return newAEAD(dataKey)
+}
+
+func decryptChunks(aead cipher.AEAD, id Id, startChunk int64, chunks [][]byte) ([][]byte, error) {
+	decrypted := make([][]byte, len(chunks))
+
+	for i, chunk := range chunks {
+		chunkIndex := startChunk + int64(i)
+
+		data, err := open(aead, chunk, chunkAdditionalData(chunkIndex))
+		if err != nil {
+			return nil, fmt.Errorf("%w: can't decrypt chunk %d of %q", CorruptBlobError, chunkIndex, id)
+		}
+
+		decrypted[i] = data
+	}
+
+	return decrypted, nil
+}
+
+func (store *Store) rewrapDataKey(tr fdb.Transaction, dir subspace.Subspace) (bool, error) {
+	keyIdFuture := tr.Get(dir.Sub("keyId"))
+	wrappedKey, err := tr.Get(dir.Sub("dataKey")).Get()
+	if err != nil {
+		return false, err
+	}
+
+	keyId, err := keyIdFuture.Get()
+	if err != nil {
+		return false, err
+	}
+
+	if wrappedKey == nil {
+		// The blob isn't encrypted
+		return false, nil
+	}
+
+	dataKey, err := store.keyProvider.UnwrapKey(string(keyId), wrappedKey)
+	if err != nil {
+		return false, err
+	}
+
+	newKeyId, newWrappedKey, err := store.keyProvider.WrapKey(dataKey)
+	if err != nil {
+		return false, err
+	}
+
+	tr.Set(dir.Sub("keyId"), []byte(newKeyId))
+	tr.Set(dir.Sub("dataKey"), newWrappedKey)
+
+	return true, nil
+}
+
+// Rewraps the data keys of all encrypted blobs, removed blobs and uploads
+// using the key provider of the store, and returns the number of rewrapped keys.
+//
+// This is used to rotate key encryption keys without re-uploading the content
+// of the blobs. The blobs are listed and their data keys rewrapped a page at a
+// time, each page in its own transaction.
+func (store *Store) RewrapDataKeys() (int, error) {
+	if store.keyProvider == nil {
+		return 0, errors.New("the store has no key provider")
+	}
+
+	var rewrapped int
+
+	for _, dir := range []directory.DirectorySubspace{store.blobsDir, store.removedDir, store.uploadsDir} {
+		options := &listOptions{limit: rewrapBatchSize}
+
+		for {
+			var count int
+
+			cursor, err := transact(store.db, func(tr fdb.Transaction) (string, error) {
+				count = 0
+
+				_, subdirs, cursor, err := listPage(tr, dir, options)
+				if err != nil {
+					return "", err
+				}
+
+				for _, subdir := range subdirs {
+					ok, err := store.rewrapDataKey(tr, subdir)
+					if err != nil {
+						return "", err
+					}
+
+					if ok {
+						count++
+					}
+				}
+
+				return cursor, nil
+			})
+
+			if err != nil {
+				return rewrapped, err
+			}
+
+			rewrapped += count
+
+			if cursor == "" {
+				break
+			}
+
+			options.cursor = cursor
+		}
+	}
+
+	return rewrapped, nil
+}
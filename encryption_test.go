@@ -0,0 +1,222 @@
+package blobs
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+)
+
+func testKey(t *testing.T) []byte {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	assert.NoError(t, err)
+	return key
+}
+
+func TestEncryption(t *testing.T) {
+	keyProvider := &AESKeyProvider{
+		Keys:         map[string][]byte{"key-1": testKey(t)},
+		CurrentKeyId: "key-1",
+	}
+
+	t.Run("stores the content encrypted", func(t *testing.T) {
+		store := createTestStore(WithChunkSize(100), WithEncryption(keyProvider))
+
+		input := strings.Repeat("plaintext ", 50)
+		blob, err := store.Create(strings.NewReader(input))
+		assert.NoError(t, err)
+
+		entries, err := readTransact(store.db, func(tr fdb.ReadTransaction) ([]fdb.KeyValue, error) {
+			return tr.GetRange(blob.dir.Sub("bytes"), fdb.RangeOptions{}).GetSliceWithError()
+		})
+		assert.NoError(t, err)
+
+		for _, entry := range entries {
+			assert.False(t, bytes.Contains(entry.Value, []byte("plaintext")))
+		}
+
+		data, err := io.ReadAll(blob.Reader())
+		assert.NoError(t, err)
+		assert.Equal(t, input, string(data))
+	})
+
+	t.Run("doesn't store values derived from the content", func(t *testing.T) {
+		store := createTestStore(WithChunkSize(100), WithEncryption(keyProvider))
+
+		input := []byte(strings.Repeat("plaintext ", 25))
+		blob, err := store.Create(bytes.NewReader(input))
+		assert.NoError(t, err)
+
+		digest := sha256.Sum256(input)
+		derived := [][]byte{digest[:]}
+		for off := 0; off < len(input); off += 100 {
+			chunk := input[off:]
+			if len(chunk) > 100 {
+				chunk = chunk[:100]
+			}
+			derived = append(derived, chunk, chunkChecksum(chunk))
+		}
+
+		entries, err := readTransact(store.db, func(tr fdb.ReadTransaction) ([]fdb.KeyValue, error) {
+			return tr.GetRange(blob.dir, fdb.RangeOptions{}).GetSliceWithError()
+		})
+		assert.NoError(t, err)
+
+		for _, entry := range entries {
+			for _, value := range derived {
+				assert.False(t, bytes.Contains(entry.Value, value), "%s is derived from the content", fdb.Printable(entry.Key))
+			}
+		}
+
+		checksum, err := blob.Checksum()
+		assert.NoError(t, err)
+		assert.Equal(t, digest[:], checksum)
+
+		data, err := io.ReadAll(blob.Reader())
+		assert.NoError(t, err)
+		assert.Equal(t, input, data)
+	})
+
+	t.Run("allows creating and extracting blobs of different sizes", func(t *testing.T) {
+		store := createTestStore(
+			WithChunkSize(100),
+			WithEncryption(keyProvider),
+			WithCompression(GzipCodec{}),
+		)
+		lengths := []int{0, 10, 100, 101, 2000}
+
+		for _, length := range lengths {
+			input := make([]byte, length)
+			_, err := rand.Read(input)
+			assert.NoError(t, err)
+
+			blob, err := store.Create(bytes.NewReader(input))
+			assert.NoError(t, err)
+
+			data, err := io.ReadAll(blob.Reader())
+			assert.NoError(t, err)
+			assert.Equal(t, input, data, "length: %d", length)
+		}
+	})
+
+	t.Run("detects reordered chunks", func(t *testing.T) {
+		store := createTestStore(WithChunkSize(10), WithEncryption(keyProvider))
+
+		blob, err := store.Create(strings.NewReader("0123456789abcdefghij"))
+		assert.NoError(t, err)
+
+		err = updateTransact(store.db, func(tr fdb.Transaction) error {
+			first, err := tr.Get(blob.dir.Sub("bytes", 0)).Get()
+			if err != nil {
+				return err
+			}
+			second, err := tr.Get(blob.dir.Sub("bytes", 1)).Get()
+			if err != nil {
+				return err
+			}
+			tr.Set(blob.dir.Sub("bytes", 0), second)
+			tr.Set(blob.dir.Sub("bytes", 1), first)
+			return nil
+		})
+		assert.NoError(t, err)
+
+		_, err = io.ReadAll(blob.Reader())
+		assert.True(t, errors.Is(err, CorruptBlobError))
+	})
+
+	t.Run("requires a key provider to read encrypted blobs", func(t *testing.T) {
+		db := fdbConnect()
+		ns := testNamespace()
+
+		store, err := NewStore(db, ns, WithEncryption(keyProvider))
+		assert.NoError(t, err)
+
+		blob, err := store.Create(strings.NewReader("secret"))
+		assert.NoError(t, err)
+
+		plain, err := NewStore(db, ns)
+		assert.NoError(t, err)
+
+		_, err = plain.Blob(blob.Id())
+		assert.EqualError(t, err, "blob is encrypted, but the store has no key provider")
+	})
+
+	t.Run("supports rotating key encryption keys", func(t *testing.T) {
+		keyProvider := &AESKeyProvider{
+			Keys:         map[string][]byte{"old": testKey(t)},
+			CurrentKeyId: "old",
+		}
+
+		store := createTestStore(WithEncryption(keyProvider))
+
+		blob, err := store.Create(strings.NewReader("secret"))
+		assert.NoError(t, err)
+
+		keyProvider.Keys["new"] = testKey(t)
+		keyProvider.CurrentKeyId = "new"
+
+		rewrapped, err := store.RewrapDataKeys()
+		assert.NoError(t, err)
+		assert.Equal(t, 1, rewrapped)
+
+		delete(keyProvider.Keys, "old")
+
+		blob, err = store.Blob(blob.Id())
+		assert.NoError(t, err)
+
+		data, err := io.ReadAll(blob.Reader())
+		assert.NoError(t, err)
+		assert.Equal(t, "secret", string(data))
+	})
+
+	t.Run("rewraps data keys across multiple pages of blobs", func(t *testing.T) {
+		keyProvider := &AESKeyProvider{
+			Keys:         map[string][]byte{"old": testKey(t)},
+			CurrentKeyId: "old",
+		}
+
+		store := createTestStore(WithEncryption(keyProvider))
+
+		ids := make([]Id, rewrapBatchSize+1)
+		for i := range ids {
+			blob, err := store.Create(strings.NewReader("secret"))
+			assert.NoError(t, err)
+			ids[i] = blob.Id()
+		}
+
+		keyProvider.Keys["new"] = testKey(t)
+		keyProvider.CurrentKeyId = "new"
+
+		rewrapped, err := store.RewrapDataKeys()
+		assert.NoError(t, err)
+		assert.Equal(t, len(ids), rewrapped)
+
+		delete(keyProvider.Keys, "old")
+
+		for _, id := range ids {
+			blob, err := store.Blob(id)
+			assert.NoError(t, err)
+
+			data, err := io.ReadAll(blob.Reader())
+			assert.NoError(t, err)
+			assert.Equal(t, "secret", string(data))
+		}
+	})
+
+	t.Run("rejects chunk sizes leaving no room for the nonce and tag", func(t *testing.T) {
+		_, err := NewStore(fdbConnect(), testNamespace(), WithChunkSize(maxValueSize), WithEncryption(keyProvider))
+		assert.EqualError(t, err, "invalid chunkSize 100000 > 99972, encrypted chunks need room for the nonce and tag")
+	})
+
+	t.Run("rejects nil key providers", func(t *testing.T) {
+		_, err := NewStore(fdbConnect(), testNamespace(), WithEncryption(nil))
+		assert.EqualError(t, err, "invalid key provider, key provider can't be nil")
+	})
+}
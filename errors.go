@@ -4,3 +4,31 @@ import "errors"
 
 // Error for when a blob can't be found.
 var BlobNotFoundError = errors.New("blob not found")
+
+// Error for when the stored content of a blob doesn't match its checksums.
+var CorruptBlobError = errors.New("blob is corrupt")
+
+// Error for when an upload can't be found.
+var UploadNotFoundError = errors.New("upload not found")
+
+// Error for when an upload is appended to concurrently.
+var UploadConflictError = errors.New("upload conflict")
+
+// Error for when a blob is appended to or truncated concurrently.
+var BlobConflictError = errors.New("blob conflict")
+
+// Error for when a version of a versioned key can't be found.
+var VersionNotFoundError = errors.New("version not found")
+
+// Error for when a version other than the latest version of a versioned key is
+// modified.
+var VersionNotLatestError = errors.New("version is not the latest version")
+
+// Error for when content would make a store exceed its quota.
+var QuotaExceededError = errors.New("quota exceeded")
+
+// Error for when a key doesn't name a blob.
+var KeyNotFoundError = errors.New("key not found")
+
+// Error for when an encoded chunk exceeds the value size limit of FoundationDB.
+var ChunkTooLargeError = errors.New("chunk too large")
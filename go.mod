@@ -5,6 +5,8 @@ go 1.20
 require (
 	github.com/alecthomas/assert/v2 v2.2.2
 	github.com/apple/foundationdb/bindings/go v0.0.0-20221208173428-5c644f20e3c5
+	github.com/golang/snappy v0.0.4
+	github.com/klauspost/compress v1.16.7
 	github.com/oklog/ulid/v2 v2.1.0
 )
 
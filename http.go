@@ -0,0 +1,89 @@
+package blobs
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type httpHandler struct {
+	store *Store
+}
+
+// Returns a http handler serving the content of the blobs in the store.
+//
+// The blob id is taken from the request path, so the handler is usually mounted
+// using [http.StripPrefix]:
+//
+//	http.Handle("/blobs/", http.StripPrefix("/blobs/", store.HTTPHandler()))
+//
+// The handler supports GET and HEAD requests, including range requests and
+// conditional requests. The Content-Length is based on the length of the blob,
+// the Last-Modified header is the time the blob was last modified and the ETag
+// is the stored SHA-256 checksum of the content, so it changes whenever the
+// content changes. Blobs stored without a checksum get an ETag derived from the
+// version the blob was last committed or modified at instead. The Content-Type
+// is taken from the blob metadata when available, otherwise it is sniffed from
+// the content.
+//
+// Requests for blobs that doesn't exist will get a 404 response.
+func (store *Store) HTTPHandler() http.Handler {
+	return &httpHandler{store: store}
+}
+
+func (h *httpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := Id(strings.TrimPrefix(r.URL.Path, "/"))
+
+	if id == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	blob, err := h.store.BlobContext(r.Context(), id)
+
+	if errors.Is(err, BlobNotFoundError) {
+		http.NotFound(w, r)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// The reader is pinned before serving the content, so the headers match
+	// the content served
+	reader := blob.newReader(r.Context())
+	pin, err := reader.ensurePin()
+
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	metadata, err := blob.Metadata()
+
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if metadata.ContentType != "" {
+		w.Header().Set("Content-Type", metadata.ContentType)
+	}
+
+	if pin.checksum != nil {
+		w.Header().Set("ETag", fmt.Sprintf(`"%x"`, pin.checksum))
+	} else if pin.version != nil {
+		w.Header().Set("ETag", fmt.Sprintf(`"v%x"`, pin.version))
+	}
+
+	http.ServeContent(w, r, "", pin.modifiedAt, reader)
+}
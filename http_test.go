@@ -0,0 +1,169 @@
+package blobs
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+)
+
+func TestHTTPHandler(t *testing.T) {
+	store := createTestStore(WithChunkSize(4))
+
+	blob, err := store.Create(strings.NewReader("Hello, world!"))
+	assert.NoError(t, err)
+
+	server := httptest.NewServer(store.HTTPHandler())
+	defer server.Close()
+
+	url := fmt.Sprintf("%s/%s", server.URL, blob.Id())
+	etag := fmt.Sprintf(`"%x"`, sha256.Sum256([]byte("Hello, world!")))
+
+	t.Run("serves the content of the blob", func(t *testing.T) {
+		res, err := http.Get(url)
+		assert.NoError(t, err)
+		defer res.Body.Close()
+
+		body, err := io.ReadAll(res.Body)
+		assert.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "Hello, world!", string(body))
+		assert.Equal(t, "13", res.Header.Get("Content-Length"))
+		assert.Equal(t, etag, res.Header.Get("ETag"))
+	})
+
+	t.Run("supports head requests", func(t *testing.T) {
+		res, err := http.Head(url)
+		assert.NoError(t, err)
+		defer res.Body.Close()
+
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "13", res.Header.Get("Content-Length"))
+	})
+
+	t.Run("supports range requests", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		assert.NoError(t, err)
+		req.Header.Set("Range", "bytes=7-11")
+
+		res, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer res.Body.Close()
+
+		body, err := io.ReadAll(res.Body)
+		assert.NoError(t, err)
+
+		assert.Equal(t, http.StatusPartialContent, res.StatusCode)
+		assert.Equal(t, "world", string(body))
+		assert.Equal(t, "bytes 7-11/13", res.Header.Get("Content-Range"))
+	})
+
+	t.Run("ignores the range when If-Range doesn't match", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		assert.NoError(t, err)
+		req.Header.Set("Range", "bytes=7-11")
+		req.Header.Set("If-Range", `"other"`)
+
+		res, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer res.Body.Close()
+
+		body, err := io.ReadAll(res.Body)
+		assert.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "Hello, world!", string(body))
+	})
+
+	t.Run("responds with not modified for matching etags", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		assert.NoError(t, err)
+		req.Header.Set("If-None-Match", etag)
+
+		res, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer res.Body.Close()
+
+		assert.Equal(t, http.StatusNotModified, res.StatusCode)
+	})
+
+	t.Run("changes the etag and modification time when the blob is modified", func(t *testing.T) {
+		date, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+		st := &SystemTimeMock{Time: date}
+		store := createTestStore(WithChunkSize(4), WithSystemTime(st))
+
+		server := httptest.NewServer(store.HTTPHandler())
+		defer server.Close()
+
+		blob, err := store.Create(strings.NewReader("Hello, world!"))
+		assert.NoError(t, err)
+
+		head := func() *http.Response {
+			res, err := http.Head(fmt.Sprintf("%s/%s", server.URL, blob.Id()))
+			assert.NoError(t, err)
+			res.Body.Close()
+			return res
+		}
+
+		created := head()
+		assert.Equal(t, date.Format(http.TimeFormat), created.Header.Get("Last-Modified"))
+
+		st.Time = date.Add(time.Hour)
+		_, err = store.AppendBlob(blob.Id(), strings.NewReader("!!"))
+		assert.NoError(t, err)
+
+		appended := head()
+		assert.Equal(t, st.Time.Format(http.TimeFormat), appended.Header.Get("Last-Modified"))
+		assert.NotEqual(t, created.Header.Get("ETag"), appended.Header.Get("ETag"))
+
+		err = store.TruncateBlob(blob.Id(), 13)
+		assert.NoError(t, err)
+		_, err = store.AppendBlob(blob.Id(), strings.NewReader("??"))
+		assert.NoError(t, err)
+
+		rewritten := head()
+		assert.NotEqual(t, appended.Header.Get("ETag"), rewritten.Header.Get("ETag"))
+	})
+
+	t.Run("derives the etag from the committed version of blobs without a checksum", func(t *testing.T) {
+		blob, err := store.Create(strings.NewReader("Hello, world!"))
+		assert.NoError(t, err)
+
+		version, err := transact(store.db, func(tr fdb.Transaction) ([]byte, error) {
+			tr.Clear(blob.dir.Sub("checksum"))
+			return tr.Get(blob.dir.Sub(committedVersionKey)).Get()
+		})
+		assert.NoError(t, err)
+
+		res, err := http.Head(fmt.Sprintf("%s/%s", server.URL, blob.Id()))
+		assert.NoError(t, err)
+		res.Body.Close()
+
+		assert.Equal(t, fmt.Sprintf(`"v%x"`, version), res.Header.Get("ETag"))
+	})
+
+	t.Run("responds with not found for missing blobs", func(t *testing.T) {
+		res, err := http.Get(server.URL + "/missing")
+		assert.NoError(t, err)
+		defer res.Body.Close()
+
+		assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	})
+
+	t.Run("rejects other methods", func(t *testing.T) {
+		res, err := http.Post(url, "text/plain", strings.NewReader("content"))
+		assert.NoError(t, err)
+		defer res.Body.Close()
+
+		assert.Equal(t, http.StatusMethodNotAllowed, res.StatusCode)
+		assert.Equal(t, "GET, HEAD", res.Header.Get("Allow"))
+	})
+}
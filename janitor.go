@@ -0,0 +1,330 @@
+package blobs
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+	"github.com/oklog/ulid/v2"
+)
+
+// Janitor periodically deleting removed blobs and abandoned uploads of a store.
+//
+// Multiple janitors can run against the same store, for instance one in every
+// instance of a service. A lease stored in FoundationDB makes sure only one of
+// them does the work at a time.
+type Janitor struct {
+	store            *Store
+	owner            string
+	removedRetention time.Duration
+	uploadsRetention time.Duration
+	interval         time.Duration
+	jitter           time.Duration
+	leaseDuration    time.Duration
+	systemTime       SystemTime
+	report           func(report JanitorReport, err error)
+}
+
+// The outcome of a janitor run.
+type JanitorReport struct {
+	// The number of removed blobs that was deleted.
+	RemovedBlobs int
+	// The number of abandoned uploads that was deleted.
+	Uploads int
+	// If the run was skipped because another janitor holds the lease.
+	Skipped bool
+}
+
+// Janitor option type.
+type JanitorOption func(janitor *Janitor) error
+
+// Sets how long removed blobs are kept before they are deleted.
+//
+// Defaults to 24 hours.
+func WithRemovedBlobsRetention(retention time.Duration) JanitorOption {
+	return func(janitor *Janitor) error {
+		if retention < 0 {
+			return errors.New("invalid retention, retention can't be negative")
+		}
+		janitor.removedRetention = retention
+		return nil
+	}
+}
+
+// Sets how long uploads are kept after they were started before they are
+// deleted as abandoned.
+//
+// Defaults to 24 hours.
+func WithUploadsRetention(retention time.Duration) JanitorOption {
+	return func(janitor *Janitor) error {
+		if retention < 0 {
+			return errors.New("invalid retention, retention can't be negative")
+		}
+		janitor.uploadsRetention = retention
+		return nil
+	}
+}
+
+// Sets the interval between runs.
+//
+// Defaults to 1 hour.
+func WithInterval(interval time.Duration) JanitorOption {
+	return func(janitor *Janitor) error {
+		if interval <= 0 {
+			return errors.New("invalid interval, interval needs to be greater than zero")
+		}
+		janitor.interval = interval
+		return nil
+	}
+}
+
+// Sets the maximum random delay before each run takes the lease, this spreads
+// the runs of janitors started at the same time.
+//
+// Defaults to no jitter.
+func WithJitter(jitter time.Duration) JanitorOption {
+	return func(janitor *Janitor) error {
+		if jitter < 0 {
+			return errors.New("invalid jitter, jitter can't be negative")
+		}
+		janitor.jitter = jitter
+		return nil
+	}
+}
+
+// Sets how long the lease taken by a run is held, the lease is renewed every
+// third of the lease duration while the run is in progress.
+//
+// Defaults to the interval, so the work is done at most once per interval
+// across all janitors.
+func WithLeaseDuration(leaseDuration time.Duration) JanitorOption {
+	return func(janitor *Janitor) error {
+		if leaseDuration <= 0 {
+			return errors.New("invalid lease duration, lease duration needs to be greater than zero")
+		}
+		janitor.leaseDuration = leaseDuration
+		return nil
+	}
+}
+
+// Provide a system time instance used for the retention periods and the lease.
+//
+// Defaults to the system time of the store.
+func WithJanitorSystemTime(systemTime SystemTime) JanitorOption {
+	return func(janitor *Janitor) error {
+		janitor.systemTime = systemTime
+		return nil
+	}
+}
+
+// Calls the report function after each run started by [Janitor.Run], with
+// the deleted counts and the error of the run.
+func WithJanitorReport(report func(report JanitorReport, err error)) JanitorOption {
+	return func(janitor *Janitor) error {
+		janitor.report = report
+		return nil
+	}
+}
+
+// Constructs a new janitor for the store with a list of options.
+func NewJanitor(store *Store, opts ...JanitorOption) (*Janitor, error) {
+	janitor := &Janitor{
+		store:            store,
+		owner:            ulid.Make().String(),
+		removedRetention: 24 * time.Hour,
+		uploadsRetention: 24 * time.Hour,
+		interval:         time.Hour,
+		systemTime:       store.systemTime,
+	}
+
+	for _, opt := range opts {
+		err := opt(janitor)
+		if err != nil {
+			return janitor, err
+		}
+	}
+
+	if janitor.leaseDuration == 0 {
+		janitor.leaseDuration = janitor.interval
+	}
+
+	return janitor, nil
+}
+
+// Runs the janitor until the context is done, then returns the error of the
+// context.
+//
+// A failing run doesn't stop the janitor, the error is passed to the report
+// function and the work is retried on the next run. A run interrupted by the
+// context is reported too, so the work done before it stopped isn't lost.
+func (janitor *Janitor) Run(ctx context.Context) error {
+	for {
+		err := sleep(ctx, janitor.jitterDelay())
+		if err != nil {
+			return err
+		}
+
+		report, err := janitor.RunOnce(ctx)
+
+		if janitor.report != nil {
+			janitor.report(report, err)
+		}
+
+		err = sleep(ctx, janitor.interval)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Returns a random delay of at most the jitter.
+func (janitor *Janitor) jitterDelay() time.Duration {
+	if janitor.jitter == 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(janitor.jitter) + 1))
+}
+
+// Waits for the given duration, or returns the error of the context if it is
+// done first.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Runs the janitor once, deleting the expired removed blobs and uploads if the
+// lease can be taken.
+//
+// The run is skipped if another janitor holds the lease. If the lease is lost
+// during the run, it stops after the batch in progress.
+func (janitor *Janitor) RunOnce(ctx context.Context) (JanitorReport, error) {
+	var report JanitorReport
+
+	acquired, err := janitor.acquireLease()
+	if err != nil {
+		return report, err
+	}
+
+	if !acquired {
+		report.Skipped = true
+		return report, nil
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	stopRenewing := janitor.renewLease(ctx, cancel)
+	defer stopRenewing()
+
+	now := janitor.systemTime.Now()
+
+	removed, err := janitor.store.DeleteRemovedBlobsBeforeContext(ctx, now.Add(-janitor.removedRetention))
+	report.RemovedBlobs = len(removed)
+	if err != nil {
+		return report, leaseError(ctx, err)
+	}
+
+	uploads, err := janitor.store.DeleteUploadsStartedBeforeContext(ctx, now.Add(-janitor.uploadsRetention))
+	report.Uploads = len(uploads)
+
+	return report, leaseError(ctx, err)
+}
+
+// Renews the lease every third of the lease duration until the returned
+// function is called, independent of how long the batches of the run take.
+//
+// If the lease is lost or can't be renewed, the run is cancelled with the
+// error.
+func (janitor *Janitor) renewLease(ctx context.Context, cancel context.CancelCauseFunc) func() {
+	period := janitor.leaseDuration / 3
+	if period <= 0 {
+		period = janitor.leaseDuration
+	}
+
+	ticker := time.NewTicker(period)
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			acquired, err := janitor.acquireLease()
+			if err == nil && !acquired {
+				err = errors.New("janitor lease was lost")
+			}
+
+			if err != nil {
+				cancel(err)
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-stopped
+	}
+}
+
+// Returns the cause of the context being cancelled instead of the plain
+// cancellation error, so a lost lease is reported as such.
+func leaseError(ctx context.Context, err error) error {
+	if err != nil && errors.Is(err, context.Canceled) {
+		return context.Cause(ctx)
+	}
+
+	return err
+}
+
+// Takes or renews the lease, returns false if another janitor holds it.
+func (janitor *Janitor) acquireLease() (bool, error) {
+	leaseKey := janitor.store.cleanupDir.Sub("lease")
+
+	return transact(janitor.store.db, func(tr fdb.Transaction) (bool, error) {
+		data, err := tr.Get(leaseKey).Get()
+		if err != nil {
+			return false, err
+		}
+
+		now := janitor.systemTime.Now()
+
+		if data != nil {
+			lease, err := tuple.Unpack(data)
+			if err != nil {
+				return false, err
+			}
+
+			owner, _ := lease[0].(string)
+			expiresAt, _ := lease[1].(int64)
+
+			if owner != janitor.owner && now.UnixNano() < expiresAt {
+				return false, nil
+			}
+		}
+
+		tr.Set(leaseKey, tuple.Tuple{janitor.owner, now.Add(janitor.leaseDuration).UnixNano()}.Pack())
+
+		return true, nil
+	})
+}
@@ -0,0 +1,142 @@
+package blobs
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestJanitor(t *testing.T) {
+	date, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+
+	st := &SystemTimeMock{Time: date}
+
+	store := createTestStore(
+		WithChunkSize(100),
+		WithSystemTime(st),
+	)
+
+	newJanitor := func() *Janitor {
+		janitor, err := NewJanitor(store,
+			WithRemovedBlobsRetention(time.Hour),
+			WithUploadsRetention(2*time.Hour),
+			WithInterval(time.Minute),
+		)
+		assert.NoError(t, err)
+		return janitor
+	}
+
+	t.Run("deletes expired removed blobs and uploads", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			blob, err := store.Create(strings.NewReader("content"))
+			assert.NoError(t, err)
+			err = store.RemoveBlob(blob.Id())
+			assert.NoError(t, err)
+		}
+		_, err := store.Upload(strings.NewReader("upload"))
+		assert.NoError(t, err)
+
+		janitor := newJanitor()
+
+		st.Time = date.Add(90 * time.Minute)
+		report, err := janitor.RunOnce(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, JanitorReport{RemovedBlobs: 3}, report)
+
+		st.Time = date.Add(3 * time.Hour)
+		report, err = janitor.RunOnce(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, JanitorReport{Uploads: 1}, report)
+	})
+
+	t.Run("only one janitor holds the lease", func(t *testing.T) {
+		// Let the lease of the previous runs expire
+		st.Time = st.Time.Add(2 * time.Minute)
+
+		first := newJanitor()
+		second := newJanitor()
+
+		report, err := first.RunOnce(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, report.Skipped)
+
+		report, err = second.RunOnce(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, report.Skipped)
+
+		st.Time = st.Time.Add(2 * time.Minute)
+		report, err = second.RunOnce(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, report.Skipped)
+	})
+
+	t.Run("reports runs until the context is done", func(t *testing.T) {
+		// A store of its own, so no lease is held under the mocked time
+		store := createTestStore()
+
+		blob, err := store.Create(strings.NewReader("content"))
+		assert.NoError(t, err)
+		err = store.RemoveBlob(blob.Id())
+		assert.NoError(t, err)
+
+		var total JanitorReport
+		janitor, err := NewJanitor(store,
+			WithRemovedBlobsRetention(0),
+			WithInterval(time.Millisecond),
+			WithJitter(time.Millisecond),
+			WithJanitorReport(func(report JanitorReport, err error) {
+				if !errors.Is(err, context.DeadlineExceeded) {
+					assert.NoError(t, err)
+				}
+				assert.False(t, report.Skipped)
+				total.RemovedBlobs += report.RemovedBlobs
+			}),
+		)
+		assert.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		err = janitor.Run(ctx)
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+		assert.Equal(t, 1, total.RemovedBlobs)
+
+		_, err = store.RemovedBlob(blob.Id())
+		assert.True(t, errors.Is(err, BlobNotFoundError))
+	})
+
+	t.Run("renews the lease while a run is in progress", func(t *testing.T) {
+		store := createTestStore()
+
+		janitor, err := NewJanitor(store, WithLeaseDuration(30*time.Millisecond))
+		assert.NoError(t, err)
+		other, err := NewJanitor(store, WithLeaseDuration(30*time.Millisecond))
+		assert.NoError(t, err)
+
+		acquired, err := janitor.acquireLease()
+		assert.NoError(t, err)
+		assert.True(t, acquired)
+
+		ctx, cancel := context.WithCancelCause(context.Background())
+		defer cancel(nil)
+
+		stopRenewing := janitor.renewLease(ctx, cancel)
+		time.Sleep(100 * time.Millisecond)
+
+		acquired, err = other.acquireLease()
+		assert.NoError(t, err)
+		assert.False(t, acquired)
+
+		stopRenewing()
+		assert.NoError(t, context.Cause(ctx))
+	})
+
+	t.Run("rejects invalid options", func(t *testing.T) {
+		_, err := NewJanitor(store, WithInterval(0))
+		assert.EqualError(t, err, "invalid interval, interval needs to be greater than zero")
+	})
+}
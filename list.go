@@ -0,0 +1,189 @@
+package blobs
+
+import (
+	"errors"
+	"time"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
+)
+
+// Information about a listed blob.
+type BlobInfo struct {
+	Id Id
+	// The length of the blob, only included when listing with [WithBlobInfo].
+	Len uint64
+	// The time the blob was created at, only included when listing with
+	// [WithBlobInfo].
+	CreatedAt time.Time
+}
+
+// A page of listed blobs.
+type BlobPage struct {
+	Blobs []BlobInfo
+	// Cursor for retrieving the next page using [WithCursor], empty when there
+	// are no more blobs.
+	Cursor string
+}
+
+// List option type.
+type ListOption func(list *listOptions) error
+
+type listOptions struct {
+	limit      int
+	cursor     string
+	descending bool
+	info       bool
+}
+
+// Sets the maximum number of blobs in a page.
+//
+// Defaults to 100 blobs.
+func WithLimit(limit int) ListOption {
+	return func(list *listOptions) error {
+		if limit < 1 {
+			return errors.New("invalid limit, limit needs to be greater than zero")
+		}
+		list.limit = limit
+		return nil
+	}
+}
+
+// Continues listing after the page the cursor was returned with.
+func WithCursor(cursor string) ListOption {
+	return func(list *listOptions) error {
+		list.cursor = cursor
+		return nil
+	}
+}
+
+// Lists the blobs in descending order of their ids.
+//
+// Notice that [ULID] ids are ordered by the time they were generated, so blobs
+// created with the default id generator are listed newest first.
+//
+// [ULID]: https://github.com/ulid/spec
+func WithDescendingOrder() ListOption {
+	return func(list *listOptions) error {
+		list.descending = true
+		return nil
+	}
+}
+
+// Includes the length and creation time of each blob, this is read in the same
+// transaction as the ids.
+func WithBlobInfo() ListOption {
+	return func(list *listOptions) error {
+		list.info = true
+		return nil
+	}
+}
+
+// Lists a page of the entries indexed in the given directory.
+//
+// Returns the names and subspaces of the entries, and the cursor for the next
+// page.
+func listPage(tr fdb.ReadTransaction, dir directory.DirectorySubspace, options *listOptions) ([]string, []subspace.Subspace, string, error) {
+	subdirs := entriesSubspace(dir)
+	begin, end := subdirs.FDBRangeKeySelectors()
+
+	if options.cursor != "" {
+		if options.descending {
+			end = fdb.FirstGreaterOrEqual(subdirs.Sub(options.cursor))
+		} else {
+			begin = fdb.FirstGreaterThan(subdirs.Sub(options.cursor))
+		}
+	}
+
+	entries, err := tr.GetRange(fdb.SelectorRange{Begin: begin, End: end}, fdb.RangeOptions{
+		Limit:   options.limit + 1,
+		Reverse: options.descending,
+	}).GetSliceWithError()
+
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	more := len(entries) > options.limit
+	if more {
+		entries = entries[:options.limit]
+	}
+
+	names := make([]string, len(entries))
+	dirs := make([]subspace.Subspace, len(entries))
+
+	for i, entry := range entries {
+		t, err := subdirs.Unpack(entry.Key)
+		if err != nil {
+			return nil, nil, "", err
+		}
+
+		names[i] = t[0].(string)
+		dirs[i] = subspace.FromBytes(entry.Value)
+	}
+
+	var cursor string
+	if more {
+		cursor = names[len(names)-1]
+	}
+
+	return names, dirs, cursor, nil
+}
+
+// Lists the blobs in the store, a page at a time.
+//
+// Blobs are listed in ascending order of their ids by default. The cursor of
+// the returned page is used to retrieve the next page.
+func (store *Store) ListBlobs(opts ...ListOption) (BlobPage, error) {
+	options := &listOptions{limit: 100}
+
+	for _, opt := range opts {
+		err := opt(options)
+		if err != nil {
+			return BlobPage{}, err
+		}
+	}
+
+	return readTransact(store.db, func(tr fdb.ReadTransaction) (BlobPage, error) {
+		var page BlobPage
+
+		names, dirs, cursor, err := listPage(tr, store.blobsDir, options)
+		if err != nil {
+			return page, err
+		}
+
+		page.Cursor = cursor
+		page.Blobs = make([]BlobInfo, len(names))
+
+		lens := make([]fdb.FutureByteSlice, len(names))
+		createdAts := make([]fdb.FutureByteSlice, len(names))
+
+		for i, name := range names {
+			page.Blobs[i].Id = Id(name)
+
+			if options.info {
+				lens[i] = tr.Get(dirs[i].Sub("len"))
+				createdAts[i] = tr.Get(dirs[i].Sub("createdAt"))
+			}
+		}
+
+		if options.info {
+			for i := range names {
+				data, err := lens[i].Get()
+				if err != nil {
+					return page, err
+				}
+				page.Blobs[i].Len = decodeUInt64(data)
+
+				data, err = createdAts[i].Get()
+				if err != nil {
+					return page, err
+				}
+				page.Blobs[i].CreatedAt = time.Unix(int64(decodeUInt64(data)), 0)
+			}
+		}
+
+		return page, nil
+	})
+}
@@ -0,0 +1,126 @@
+package blobs
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+)
+
+func TestListBlobs(t *testing.T) {
+	date, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+	st := &SystemTimeMock{Time: date}
+
+	store := createTestStore(WithIdGenerator(&TestIdgenerator{}), WithSystemTime(st))
+
+	for i := 0; i < 5; i++ {
+		_, err := store.Create(strings.NewReader(strings.Repeat("x", i)))
+		assert.NoError(t, err)
+	}
+
+	// Pending uploads and removed blobs are not listed
+	_, err := store.Upload(strings.NewReader("pending"))
+	assert.NoError(t, err)
+	removed, err := store.Create(strings.NewReader("removed"))
+	assert.NoError(t, err)
+	err = store.RemoveBlob(removed.Id())
+	assert.NoError(t, err)
+
+	ids := func(page BlobPage) []Id {
+		var ids []Id
+		for _, blob := range page.Blobs {
+			ids = append(ids, blob.Id)
+		}
+		return ids
+	}
+
+	t.Run("lists all blobs in ascending order", func(t *testing.T) {
+		page, err := store.ListBlobs()
+		assert.NoError(t, err)
+
+		assert.Equal(t, []Id{"blob:0", "blob:1", "blob:2", "blob:3", "blob:4"}, ids(page))
+		assert.Equal(t, "", page.Cursor)
+	})
+
+	t.Run("lists blobs in pages", func(t *testing.T) {
+		page, err := store.ListBlobs(WithLimit(2))
+		assert.NoError(t, err)
+		assert.Equal(t, []Id{"blob:0", "blob:1"}, ids(page))
+
+		page, err = store.ListBlobs(WithLimit(2), WithCursor(page.Cursor))
+		assert.NoError(t, err)
+		assert.Equal(t, []Id{"blob:2", "blob:3"}, ids(page))
+
+		page, err = store.ListBlobs(WithLimit(2), WithCursor(page.Cursor))
+		assert.NoError(t, err)
+		assert.Equal(t, []Id{"blob:4"}, ids(page))
+		assert.Equal(t, "", page.Cursor)
+	})
+
+	t.Run("doesn't return a cursor when the last page is full", func(t *testing.T) {
+		page, err := store.ListBlobs(WithLimit(5))
+		assert.NoError(t, err)
+		assert.Equal(t, 5, len(page.Blobs))
+		assert.Equal(t, "", page.Cursor)
+	})
+
+	t.Run("lists blobs in descending order", func(t *testing.T) {
+		page, err := store.ListBlobs(WithLimit(3), WithDescendingOrder())
+		assert.NoError(t, err)
+		assert.Equal(t, []Id{"blob:4", "blob:3", "blob:2"}, ids(page))
+
+		page, err = store.ListBlobs(WithLimit(3), WithDescendingOrder(), WithCursor(page.Cursor))
+		assert.NoError(t, err)
+		assert.Equal(t, []Id{"blob:1", "blob:0"}, ids(page))
+		assert.Equal(t, "", page.Cursor)
+	})
+
+	t.Run("includes the length and creation time when requested", func(t *testing.T) {
+		page, err := store.ListBlobs(WithLimit(2), WithCursor("blob:2"), WithBlobInfo())
+		assert.NoError(t, err)
+
+		assert.Equal(t, []BlobInfo{
+			{Id: "blob:3", Len: 3, CreatedAt: date.Local()},
+			{Id: "blob:4", Len: 4, CreatedAt: date.Local()},
+		}, page.Blobs)
+	})
+
+	t.Run("rejects invalid limits", func(t *testing.T) {
+		_, err := store.ListBlobs(WithLimit(0))
+		assert.EqualError(t, err, "invalid limit, limit needs to be greater than zero")
+	})
+}
+
+func TestListBlobsCreatedBeforeEntriesWereIndexed(t *testing.T) {
+	db := fdbConnect()
+	ns := testNamespace()
+
+	store, err := NewStore(db, ns, WithIdGenerator(&TestIdgenerator{}))
+	assert.NoError(t, err)
+
+	_, err = store.Create(strings.NewReader("indexed"))
+	assert.NoError(t, err)
+
+	// A blob written without an index entry, like blobs of older stores
+	_, err = store.blobsDir.Create(db, []string{"legacy"}, nil)
+	assert.NoError(t, err)
+
+	err = updateTransact(db, func(tr fdb.Transaction) error {
+		tr.Clear(store.blobsDir.Sub("indexed"))
+		return nil
+	})
+	assert.NoError(t, err)
+
+	page, err := store.ListBlobs()
+	assert.NoError(t, err)
+	assert.Equal(t, []BlobInfo{{Id: "blob:0"}}, page.Blobs)
+
+	store, err = NewStore(db, ns)
+	assert.NoError(t, err)
+
+	page, err = store.ListBlobs()
+	assert.NoError(t, err)
+	assert.Equal(t, []BlobInfo{{Id: "blob:0"}, {Id: "legacy"}}, page.Blobs)
+}
@@ -0,0 +1,159 @@
+package blobs
+
+import (
+	"errors"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
+)
+
+// Metadata stored with a blob.
+type Metadata struct {
+	// The content type of the blob, empty if not provided.
+	ContentType string
+	// The original filename of the blob, empty if not provided.
+	Filename string
+	// User-defined attributes of the blob.
+	Attributes map[string]string
+}
+
+// Upload option type.
+type UploadOption func(upload *uploadOptions) error
+
+type uploadOptions struct {
+	metadata Metadata
+}
+
+func newUploadOptions(opts []UploadOption) (*uploadOptions, error) {
+	options := &uploadOptions{
+		metadata: Metadata{Attributes: map[string]string{}},
+	}
+
+	for _, opt := range opts {
+		err := opt(options)
+		if err != nil {
+			return options, err
+		}
+	}
+
+	return options, nil
+}
+
+// Sets the content type of the uploaded blob.
+func WithContentType(contentType string) UploadOption {
+	return func(upload *uploadOptions) error {
+		upload.metadata.ContentType = contentType
+		return nil
+	}
+}
+
+// Sets the original filename of the uploaded blob.
+func WithFilename(filename string) UploadOption {
+	return func(upload *uploadOptions) error {
+		upload.metadata.Filename = filename
+		return nil
+	}
+}
+
+// Sets a user-defined attribute on the uploaded blob.
+//
+// The key needs to be non-empty.
+func WithAttribute(key, value string) UploadOption {
+	return func(upload *uploadOptions) error {
+		if key == "" {
+			return errors.New("invalid attribute, key can't be empty")
+		}
+		upload.metadata.Attributes[key] = value
+		return nil
+	}
+}
+
+func writeMetadata(tr fdb.Transaction, dir subspace.Subspace, metadata Metadata) {
+	if metadata.ContentType != "" {
+		tr.Set(dir.Sub("contentType"), []byte(metadata.ContentType))
+	}
+
+	if metadata.Filename != "" {
+		tr.Set(dir.Sub("filename"), []byte(metadata.Filename))
+	}
+
+	for key, value := range metadata.Attributes {
+		tr.Set(dir.Sub("attributes", key), []byte(value))
+	}
+}
+
+func readMetadata(tr fdb.ReadTransaction, dir subspace.Subspace) (Metadata, error) {
+	metadata := Metadata{Attributes: map[string]string{}}
+
+	contentType := tr.Get(dir.Sub("contentType"))
+	filename := tr.Get(dir.Sub("filename"))
+	attributesSpace := dir.Sub("attributes")
+	attributes := tr.GetRange(attributesSpace, fdb.RangeOptions{})
+
+	data, err := contentType.Get()
+	if err != nil {
+		return metadata, err
+	}
+	metadata.ContentType = string(data)
+
+	data, err = filename.Get()
+	if err != nil {
+		return metadata, err
+	}
+	metadata.Filename = string(data)
+
+	entries, err := attributes.GetSliceWithError()
+	if err != nil {
+		return metadata, err
+	}
+
+	for _, entry := range entries {
+		key, err := attributesSpace.Unpack(entry.Key)
+		if err != nil {
+			return metadata, err
+		}
+		metadata.Attributes[key[0].(string)] = string(entry.Value)
+	}
+
+	return metadata, nil
+}
+
+// Returns the metadata of the blob.
+//
+// All of the metadata is read in a single transaction.
+func (blob *Blob) Metadata() (Metadata, error) {
+	return readTransact(blob.db, func(tr fdb.ReadTransaction) (Metadata, error) {
+		return readMetadata(tr, blob.dir)
+	})
+}
+
+// Sets a user-defined attribute on the blob with the given id on a transaction.
+//
+// The key needs to be non-empty.
+func (store *Store) SetAttribute(tr fdb.Transaction, id Id, key, value string) error {
+	if key == "" {
+		return errors.New("invalid attribute, key can't be empty")
+	}
+
+	blobDir, err := store.openBlobDir(tr, id)
+	if err != nil {
+		return err
+	}
+
+	tr.Set(blobDir.Sub("attributes", key), []byte(value))
+
+	return nil
+}
+
+// Removes a user-defined attribute from the blob with the given id on a
+// transaction.
+func (store *Store) RemoveAttribute(tr fdb.Transaction, id Id, key string) error {
+	blobDir, err := store.openBlobDir(tr, id)
+	if err != nil {
+		return err
+	}
+
+	tr.Clear(blobDir.Sub("attributes", key))
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package blobs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+)
+
+func TestMetadata(t *testing.T) {
+	store := createTestStore()
+
+	t.Run("returns the metadata provided at upload time", func(t *testing.T) {
+		blob, err := store.Create(
+			strings.NewReader("content"),
+			WithContentType("text/plain"),
+			WithFilename("notes.txt"),
+			WithAttribute("owner", "jane"),
+			WithAttribute("tags", "a,b"),
+		)
+		assert.NoError(t, err)
+
+		metadata, err := blob.Metadata()
+		assert.NoError(t, err)
+
+		assert.Equal(t, Metadata{
+			ContentType: "text/plain",
+			Filename:    "notes.txt",
+			Attributes:  map[string]string{"owner": "jane", "tags": "a,b"},
+		}, metadata)
+	})
+
+	t.Run("returns empty metadata when none was provided", func(t *testing.T) {
+		blob, err := store.Create(strings.NewReader("content"))
+		assert.NoError(t, err)
+
+		metadata, err := blob.Metadata()
+		assert.NoError(t, err)
+
+		assert.Equal(t, Metadata{Attributes: map[string]string{}}, metadata)
+	})
+
+	t.Run("rejects attributes with empty keys", func(t *testing.T) {
+		_, err := store.Create(strings.NewReader("content"), WithAttribute("", "value"))
+		assert.EqualError(t, err, "invalid attribute, key can't be empty")
+	})
+}
+
+func TestSetAttribute(t *testing.T) {
+	store := createTestStore()
+
+	t.Run("updates attributes on a transaction", func(t *testing.T) {
+		blob, err := store.Create(strings.NewReader("content"), WithAttribute("status", "draft"))
+		assert.NoError(t, err)
+
+		err = updateTransact(store.db, func(tr fdb.Transaction) error {
+			err := store.SetAttribute(tr, blob.Id(), "status", "published")
+			if err != nil {
+				return err
+			}
+			return store.SetAttribute(tr, blob.Id(), "reviewer", "john")
+		})
+		assert.NoError(t, err)
+
+		metadata, err := blob.Metadata()
+		assert.NoError(t, err)
+
+		assert.Equal(t, map[string]string{"status": "published", "reviewer": "john"}, metadata.Attributes)
+	})
+
+	t.Run("removes attributes on a transaction", func(t *testing.T) {
+		blob, err := store.Create(strings.NewReader("content"), WithAttribute("status", "draft"))
+		assert.NoError(t, err)
+
+		err = updateTransact(store.db, func(tr fdb.Transaction) error {
+			return store.RemoveAttribute(tr, blob.Id(), "status")
+		})
+		assert.NoError(t, err)
+
+		metadata, err := blob.Metadata()
+		assert.NoError(t, err)
+
+		assert.Equal(t, map[string]string{}, metadata.Attributes)
+	})
+
+	t.Run("returns an error for a blob that doesn't exists", func(t *testing.T) {
+		err := updateTransact(store.db, func(tr fdb.Transaction) error {
+			return store.SetAttribute(tr, "missing", "status", "published")
+		})
+		assert.EqualError(t, err, "blob not found: \"missing\"")
+	})
+}
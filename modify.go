@@ -0,0 +1,245 @@
+package blobs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"fmt"
+	"io"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
+)
+
+// Checks that the blob with the given id exists.
+func (store *Store) checkBlobExists(rt fdb.ReadTransactor, id Id) error {
+	exists, err := store.blobsDir.Exists(rt, []string{string(id)})
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return fmt.Errorf("%w: %q", BlobNotFoundError, id)
+	}
+
+	return nil
+}
+
+// Appends the content of the reader r to the blob with the given id and returns
+// the new length of the blob.
+//
+// New chunks are stored after the last chunk of the blob, and the length is
+// updated atomically with each batch of chunks per transaction, so readers never
+// see a partially written chunk. Readers that started reading before the append
+// keep reading the content up to the length they started with.
+//
+// Content read from r before an error is kept. Concurrent appends to the same
+// blob fails with a [BlobConflictError], and appending to a version that isn't
+// the latest version of its key fails with a [VersionNotLatestError].
+func (store *Store) AppendBlob(id Id, r io.Reader) (uint64, error) {
+	return store.AppendBlobContext(context.Background(), id, r)
+}
+
+// Like [Store.AppendBlob], but stops appending with the error of the context
+// when it is done. The context is checked before each transaction.
+func (store *Store) AppendBlobContext(ctx context.Context, id Id, r io.Reader) (uint64, error) {
+	err := ctx.Err()
+	if err != nil {
+		return 0, err
+	}
+
+	blobDir, err := store.openBlobDir(store.db, id)
+	if err != nil {
+		return 0, err
+	}
+
+	return store.append(ctx, id, blobDir, r, true)
+}
+
+// Truncates the blob with the given id to the given length.
+//
+// The remaining content is read to compute the new checksum of the blob, then
+// the truncated content is deleted. Content addressed chunks are released in
+// batches of chunks per transaction from the end of the blob, each batch
+// shortening the blob, so if truncating fails the blob can be left shorter than
+// before without a checksum. Truncating it again completes the truncation.
+//
+// Readers of the blob started before it was truncated fail with a
+// [BlobConflictError], as do concurrent modifications of the blob. Truncating a
+// version that isn't the latest version of its key fails with a
+// [VersionNotLatestError].
+func (store *Store) TruncateBlob(id Id, size uint64) error {
+	return store.TruncateBlobContext(context.Background(), id, size)
+}
+
+// Like [Store.TruncateBlob], but stops truncating with the error of the context
+// when it is done. The context is checked before each transaction.
+func (store *Store) TruncateBlobContext(ctx context.Context, id Id, size uint64) error {
+	blob, err := store.BlobContext(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	err = store.checkBlobModifiable(store.db, id)
+	if err != nil {
+		return err
+	}
+
+	r := blob.newReader(ctx)
+
+	pin, err := r.ensurePin()
+	if err != nil {
+		return err
+	}
+
+	length := uint64(pin.len)
+
+	if size > length {
+		return fmt.Errorf("invalid size, can't truncate %q of length %d to %d", id, length, size)
+	}
+
+	if size == length {
+		return nil
+	}
+
+	digest := sha256.New()
+
+	_, err = io.CopyN(digest, r, int64(size))
+	if err != nil {
+		return err
+	}
+
+	digestState, err := digest.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	enc := blob.chunkEncoding
+	chunkSize := uint64(enc.chunkSize)
+	keptChunks := int64((size + chunkSize - 1) / chunkSize)
+	chunks := int64((length + chunkSize - 1) / chunkSize)
+	truncations := pin.truncations
+	conflictError := fmt.Errorf("%w: concurrent modification of blob %q", BlobConflictError, id)
+
+	// Checks that the blob wasn't modified since it was read, and records the
+	// truncation
+	truncate := func(tr fdb.Transaction, newLen uint64) error {
+		err := store.checkBlobModifiable(tr, id)
+		if err != nil {
+			return err
+		}
+
+		data, err := tr.Get(blob.dir.Sub("len")).Get()
+		if err != nil {
+			return err
+		}
+
+		current, err := readTruncations(tr, blob.dir)
+		if err != nil {
+			return err
+		}
+
+		if decodeUInt64(data) != length || current != truncations {
+			return conflictError
+		}
+
+		tr.Set(blob.dir.Sub("len"), encodeUInt64(newLen))
+		tr.Set(blob.dir.Sub("truncations"), encodeUInt64(truncations+1))
+		tr.Set(blob.dir.Sub("modifiedAt"), encodeUInt64(uint64(store.systemTime.Now().Unix())))
+		setCommittedVersion(tr, blob.dir)
+		store.addUsage(tr, bytesCounter, -int64(length-newLen))
+
+		return nil
+	}
+
+	for enc.contentAddressed && chunks-keptChunks > int64(store.chunksPerTransaction) {
+		err := ctx.Err()
+		if err != nil {
+			return err
+		}
+
+		firstChunk := chunks - int64(store.chunksPerTransaction)
+		newLen := uint64(firstChunk) * chunkSize
+
+		err = updateTransact(store.db, func(tr fdb.Transaction) error {
+			err := truncate(tr, newLen)
+			if err != nil {
+				return err
+			}
+
+			err = store.releaseChunksFrom(tr, blob.dir, firstChunk)
+			if err != nil {
+				return err
+			}
+
+			clearChunksFrom(tr, blob.dir, "checksums", firstChunk)
+			tr.Clear(blob.dir.Sub("checksum"))
+			tr.Clear(blob.dir.Sub("digestState"))
+
+			return nil
+		})
+
+		if err != nil {
+			return err
+		}
+
+		length = newLen
+		chunks = firstChunk
+		truncations++
+	}
+
+	err = ctx.Err()
+	if err != nil {
+		return err
+	}
+
+	return updateTransact(store.db, func(tr fdb.Transaction) error {
+		err := truncate(tr, size)
+		if err != nil {
+			return err
+		}
+
+		if size%chunkSize != 0 {
+			// Rewrite the new last chunk without the truncated content
+			chunkIndex := keptChunks - 1
+
+			chunk, err := store.readChunk(tr, id, blob.dir, enc, chunkIndex)
+			if err != nil {
+				return err
+			}
+
+			if uint64(len(chunk)) < size%chunkSize {
+				return fmt.Errorf("%w: %q is missing content", CorruptBlobError, id)
+			}
+
+			err = store.writeChunk(tr, blob.dir, enc, chunkIndex, chunk[:size%chunkSize])
+			if err != nil {
+				return err
+			}
+		}
+
+		if enc.contentAddressed {
+			err = store.releaseChunksFrom(tr, blob.dir, keptChunks)
+			if err != nil {
+				return err
+			}
+		} else {
+			clearChunksFrom(tr, blob.dir, "bytes", keptChunks)
+		}
+
+		clearChunksFrom(tr, blob.dir, "checksums", keptChunks)
+
+		tr.Set(blob.dir.Sub("checksum"), enc.sealValue("checksum", digest.Sum(nil)))
+		tr.Set(blob.dir.Sub("digestState"), enc.sealValue("digestState", digestState))
+
+		return nil
+	})
+}
+
+// Clears the keys of the given chunk subspace of the blob directory from the
+// given chunk index to the end.
+func clearChunksFrom(tr fdb.Transaction, blobDir subspace.Subspace, key string, startChunk int64) {
+	space := blobDir.Sub(key)
+	_, end := space.FDBRangeKeys()
+	tr.ClearRange(fdb.KeyRange{Begin: space.Sub(startChunk), End: end})
+}
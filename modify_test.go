@@ -0,0 +1,187 @@
+package blobs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+)
+
+func TestAppendBlob(t *testing.T) {
+	store := createTestStore(WithChunkSize(10), WithChunksPerTransaction(2))
+
+	t.Run("appends content after the existing content", func(t *testing.T) {
+		blob, err := store.Create(strings.NewReader("first line\n"))
+		assert.NoError(t, err)
+
+		length, err := store.AppendBlob(blob.Id(), strings.NewReader("second line\nthird line\n"))
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(34), length)
+
+		content := "first line\nsecond line\nthird line\n"
+		assert.Equal(t, content, readBlob(t, store, blob.Id()))
+
+		checksum, err := blob.Checksum()
+		assert.NoError(t, err)
+		want := sha256.Sum256([]byte(content))
+		assert.Equal(t, want[:], checksum)
+	})
+
+	t.Run("readers keep reading the length they started with", func(t *testing.T) {
+		blob, err := store.Create(strings.NewReader("0123456789abcde"))
+		assert.NoError(t, err)
+
+		r := blob.Reader()
+		buf := make([]byte, 5)
+		_, err = io.ReadFull(r, buf)
+		assert.NoError(t, err)
+
+		_, err = store.AppendBlob(blob.Id(), strings.NewReader("fghij"))
+		assert.NoError(t, err)
+
+		rest, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, "56789abcde", string(rest))
+	})
+
+	t.Run("keeps the digest state of encrypted blobs encrypted", func(t *testing.T) {
+		store := createTestStore(WithChunkSize(10), WithEncryption(&AESKeyProvider{
+			Keys:         map[string][]byte{"key": testKey(t)},
+			CurrentKeyId: "key",
+		}))
+
+		blob, err := store.Create(strings.NewReader("secret tail"))
+		assert.NoError(t, err)
+
+		digestState, err := readTransact(store.db, func(tr fdb.ReadTransaction) ([]byte, error) {
+			return tr.Get(blob.dir.Sub("digestState")).Get()
+		})
+		assert.NoError(t, err)
+		assert.False(t, bytes.Contains(digestState, []byte("secret tail")))
+
+		_, err = store.AppendBlob(blob.Id(), strings.NewReader(" appended"))
+		assert.NoError(t, err)
+
+		checksum, err := blob.Checksum()
+		assert.NoError(t, err)
+		want := sha256.Sum256([]byte("secret tail appended"))
+		assert.Equal(t, want[:], checksum)
+	})
+
+	t.Run("fails for unknown blobs", func(t *testing.T) {
+		_, err := store.AppendBlob("missing", strings.NewReader("content"))
+		assert.True(t, errors.Is(err, BlobNotFoundError))
+	})
+}
+
+func TestTruncateBlob(t *testing.T) {
+	input := "0123456789abcdefghijklmnopqrstuvwxyz"
+
+	t.Run("releases content addressed chunks in batches", func(t *testing.T) {
+		store := createTestStore(WithChunkSize(2), WithChunksPerTransaction(3), WithDeduplication())
+
+		blob, err := store.Create(strings.NewReader(input))
+		assert.NoError(t, err)
+
+		err = store.TruncateBlob(blob.Id(), 3)
+		assert.NoError(t, err)
+
+		assert.Equal(t, input[:3], readBlob(t, store, blob.Id()))
+
+		refs, err := readTransact(store.db, func(tr fdb.ReadTransaction) ([]fdb.KeyValue, error) {
+			return tr.GetRange(store.chunksDir.Sub("refs"), fdb.RangeOptions{}).GetSliceWithError()
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(refs))
+	})
+
+	for _, dedup := range []bool{false, true} {
+		opts := []Option{WithChunkSize(10)}
+		if dedup {
+			opts = append(opts, WithDeduplication())
+		}
+		store := createTestStore(opts...)
+
+		t.Run("truncates the content", func(t *testing.T) {
+			for _, size := range []uint64{36, 25, 20, 0} {
+				blob, err := store.Create(strings.NewReader(input))
+				assert.NoError(t, err)
+
+				err = store.TruncateBlob(blob.Id(), size)
+				assert.NoError(t, err)
+
+				assert.Equal(t, input[:size], readBlob(t, store, blob.Id()))
+
+				length, err := blob.Len()
+				assert.NoError(t, err)
+				assert.Equal(t, size, length)
+			}
+		})
+
+		t.Run("truncated blobs can be appended to", func(t *testing.T) {
+			blob, err := store.Create(strings.NewReader(input))
+			assert.NoError(t, err)
+
+			err = store.TruncateBlob(blob.Id(), 15)
+			assert.NoError(t, err)
+
+			_, err = store.AppendBlob(blob.Id(), strings.NewReader("!"))
+			assert.NoError(t, err)
+
+			assert.Equal(t, input[:15]+"!", readBlob(t, store, blob.Id()))
+
+			checksum, err := blob.Checksum()
+			assert.NoError(t, err)
+			want := sha256.Sum256([]byte(input[:15] + "!"))
+			assert.Equal(t, want[:], checksum)
+		})
+
+		t.Run("readers started before the blob was truncated fail", func(t *testing.T) {
+			blob, err := store.Create(strings.NewReader(input))
+			assert.NoError(t, err)
+
+			r := blob.Reader()
+			buf := make([]byte, 5)
+			_, err = io.ReadFull(r, buf)
+			assert.NoError(t, err)
+
+			err = store.TruncateBlob(blob.Id(), 25)
+			assert.NoError(t, err)
+			_, err = store.AppendBlob(blob.Id(), strings.NewReader("ABCDEFGHIJK"))
+			assert.NoError(t, err)
+
+			_, err = io.ReadAll(r)
+			assert.True(t, errors.Is(err, BlobConflictError))
+		})
+
+		t.Run("keeps the checksum of the remaining content", func(t *testing.T) {
+			blob, err := store.Create(strings.NewReader(input))
+			assert.NoError(t, err)
+
+			err = store.TruncateBlob(blob.Id(), 17)
+			assert.NoError(t, err)
+
+			checksum, err := blob.Checksum()
+			assert.NoError(t, err)
+			want := sha256.Sum256([]byte(input[:17]))
+			assert.Equal(t, want[:], checksum)
+
+			data, err := io.ReadAll(blob.Reader())
+			assert.NoError(t, err)
+			assert.Equal(t, input[:17], string(data))
+		})
+
+		t.Run("can't truncate to a greater length", func(t *testing.T) {
+			blob, err := store.Create(strings.NewReader("short"))
+			assert.NoError(t, err)
+
+			err = store.TruncateBlob(blob.Id(), 10)
+			assert.Error(t, err)
+		})
+	}
+}
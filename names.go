@@ -0,0 +1,265 @@
+package blobs
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+)
+
+// A key naming a blob.
+type NamedBlob struct {
+	Key string
+	Id  Id
+}
+
+// A page of listed keys.
+type KeyPage struct {
+	Keys []NamedBlob
+	// Cursor for retrieving the next page using [WithCursor], empty when there
+	// are no more keys.
+	Cursor string
+}
+
+// Checks that a key given for a named or versioned blob is valid.
+func checkKey(key string) error {
+	if key == "" {
+		return errors.New("invalid key, key can't be empty")
+	}
+
+	return nil
+}
+
+// Changes the key to name the blob with the given id, and returns the id the key
+// named before.
+//
+// The keys naming a blob are recorded in the blob directory, so they are
+// removed together with the blob.
+func (store *Store) setKey(tr fdb.Transaction, key string, id Id) (Id, error) {
+	previous, err := tr.Get(store.namesDir.Sub(key)).Get()
+	if err != nil {
+		return "", err
+	}
+
+	if previous != nil && Id(previous) != id {
+		err := store.unrecordKey(tr, Id(previous), key)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	blobDir, err := store.openBlobDir(tr, id)
+	if err != nil {
+		return "", err
+	}
+
+	tr.Set(store.namesDir.Sub(key), []byte(id))
+	tr.Set(blobDir.Sub("names", key), []byte{})
+
+	return Id(previous), nil
+}
+
+// Removes the record of the key from the blob with the given id, if the blob
+// still exists.
+func (store *Store) unrecordKey(tr fdb.Transaction, id Id, key string) error {
+	blobDir, err := store.openBlobDir(tr, id)
+	if errors.Is(err, BlobNotFoundError) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	tr.Clear(blobDir.Sub("names", key))
+
+	return nil
+}
+
+// Removes the keys naming the blob with the given id stored in the given
+// directory.
+func (store *Store) removeKeysOf(tr fdb.Transaction, blobDir subspace.Subspace, id Id) error {
+	namesSpace := blobDir.Sub("names")
+
+	entries, err := tr.GetRange(namesSpace, fdb.RangeOptions{}).GetSliceWithError()
+	if err != nil {
+		return err
+	}
+
+	named := make([]fdb.FutureByteSlice, len(entries))
+	keys := make([]string, len(entries))
+
+	for i, entry := range entries {
+		t, err := namesSpace.Unpack(entry.Key)
+		if err != nil {
+			return err
+		}
+
+		keys[i] = t[0].(string)
+		named[i] = tr.Get(store.namesDir.Sub(keys[i]))
+	}
+
+	for i, key := range keys {
+		data, err := named[i].Get()
+		if err != nil {
+			return err
+		}
+
+		if Id(data) == id {
+			tr.Clear(store.namesDir.Sub(key))
+		}
+	}
+
+	tr.ClearRange(namesSpace)
+
+	return nil
+}
+
+// Commits an upload with the given token on a transaction and names the created
+// blob with the given key.
+//
+// Keys are chosen by the caller, for instance hierarchical paths like
+// "tenant/a/report.pdf". If the key already names a blob, it is changed to name
+// the new blob, the previous blob is left as is. Removing a blob removes the
+// keys naming it.
+func (store *Store) CommitUploadAs(tr fdb.Transaction, token UploadToken, key string) (Id, error) {
+	err := checkKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	id, err := store.CommitUpload(tr, token)
+	if err != nil {
+		return id, err
+	}
+
+	_, err = store.setKey(tr, key, id)
+
+	return id, err
+}
+
+// Returns the id of the blob named by the given key.
+//
+// A [KeyNotFoundError] is returned if the key doesn't name a blob.
+func (store *Store) LookupKey(key string) (Id, error) {
+	return readTransact(store.db, func(tr fdb.ReadTransaction) (Id, error) {
+		return store.LookupKeyTx(tr, key)
+	})
+}
+
+// Like [Store.LookupKey], but looks up the key on the given transaction.
+func (store *Store) LookupKeyTx(tr fdb.ReadTransaction, key string) (Id, error) {
+	data, err := tr.Get(store.namesDir.Sub(key)).Get()
+	if err != nil {
+		return "", err
+	}
+
+	if data == nil {
+		return "", fmt.Errorf("%w: %q", KeyNotFoundError, key)
+	}
+
+	return Id(data), nil
+}
+
+// Atomically changes the key to name the blob with the given id on a
+// transaction, and returns the id the key named before.
+//
+// The previous id is empty if the key didn't name a blob. Compare it to the
+// expected id and fail the transaction to make a compare and swap.
+func (store *Store) SwapKey(tr fdb.Transaction, key string, id Id) (Id, error) {
+	err := checkKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	return store.setKey(tr, key, id)
+}
+
+// Removes the key on a transaction and returns the id it named.
+//
+// The blob named by the key is left as is.
+func (store *Store) RemoveKey(tr fdb.Transaction, key string) (Id, error) {
+	id, err := store.LookupKeyTx(tr, key)
+	if err != nil {
+		return "", err
+	}
+
+	tr.Clear(store.namesDir.Sub(key))
+
+	return id, store.unrecordKey(tr, id, key)
+}
+
+// Lists the keys starting with the given prefix, a page at a time.
+//
+// Keys are listed in ascending order by default. The limit, cursor and order of
+// the page is controlled using list options, the blob info option is ignored.
+func (store *Store) ListKeys(prefix string, opts ...ListOption) (KeyPage, error) {
+	options := &listOptions{limit: 100}
+
+	for _, opt := range opts {
+		err := opt(options)
+		if err != nil {
+			return KeyPage{}, err
+		}
+	}
+
+	// Strings are packed null terminated, so leaving out the terminator gives
+	// the prefix of all packed keys starting with the prefix
+	packed := store.namesDir.Pack(tuple.Tuple{prefix})
+	prefixKey := packed[:len(packed)-1]
+
+	end, err := fdb.Strinc(prefixKey)
+	if err != nil {
+		return KeyPage{}, err
+	}
+
+	return readTransact(store.db, func(tr fdb.ReadTransaction) (KeyPage, error) {
+		var page KeyPage
+
+		keyRange := fdb.SelectorRange{
+			Begin: fdb.FirstGreaterOrEqual(prefixKey),
+			End:   fdb.FirstGreaterOrEqual(fdb.Key(end)),
+		}
+
+		if options.cursor != "" {
+			if options.descending {
+				keyRange.End = fdb.FirstGreaterOrEqual(store.namesDir.Sub(options.cursor))
+			} else {
+				keyRange.Begin = fdb.FirstGreaterThan(store.namesDir.Sub(options.cursor))
+			}
+		}
+
+		entries, err := tr.GetRange(keyRange, fdb.RangeOptions{
+			Limit:   options.limit + 1,
+			Reverse: options.descending,
+		}).GetSliceWithError()
+
+		if err != nil {
+			return page, err
+		}
+
+		more := len(entries) > options.limit
+		if more {
+			entries = entries[:options.limit]
+		}
+
+		page.Keys = make([]NamedBlob, len(entries))
+
+		for i, entry := range entries {
+			t, err := store.namesDir.Unpack(entry.Key)
+			if err != nil {
+				return page, err
+			}
+
+			page.Keys[i] = NamedBlob{Key: t[0].(string), Id: Id(entry.Value)}
+		}
+
+		if more {
+			page.Cursor = page.Keys[len(page.Keys)-1].Key
+		}
+
+		return page, nil
+	})
+}
@@ -0,0 +1,121 @@
+package blobs
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+)
+
+func TestNamedKeys(t *testing.T) {
+	store := createTestStore()
+
+	createAs := func(t *testing.T, key, content string) Id {
+		token, err := store.Upload(strings.NewReader(content))
+		assert.NoError(t, err)
+
+		id, err := transact(store.db, func(tr fdb.Transaction) (Id, error) {
+			return store.CommitUploadAs(tr, token, key)
+		})
+		assert.NoError(t, err)
+
+		return id
+	}
+
+	t.Run("looks up blobs by key", func(t *testing.T) {
+		id := createAs(t, "tenant/a/report.pdf", "report")
+
+		found, err := store.LookupKey("tenant/a/report.pdf")
+		assert.NoError(t, err)
+		assert.Equal(t, id, found)
+		assert.Equal(t, "report", readBlob(t, store, found))
+
+		_, err = store.LookupKey("tenant/a/missing.pdf")
+		assert.True(t, errors.Is(err, KeyNotFoundError))
+	})
+
+	t.Run("lists keys by prefix", func(t *testing.T) {
+		createAs(t, "tenant/b/1", "1")
+		createAs(t, "tenant/b/2", "2")
+		createAs(t, "tenant/b/3", "3")
+		createAs(t, "tenant/bb/1", "1")
+
+		page, err := store.ListKeys("tenant/b/", WithLimit(2))
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(page.Keys))
+		assert.Equal(t, "tenant/b/1", page.Keys[0].Key)
+		assert.Equal(t, "tenant/b/2", page.Keys[1].Key)
+
+		page, err = store.ListKeys("tenant/b/", WithLimit(2), WithCursor(page.Cursor))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(page.Keys))
+		assert.Equal(t, "tenant/b/3", page.Keys[0].Key)
+		assert.Equal(t, "", page.Cursor)
+
+		page, err = store.ListKeys("tenant/b", WithDescendingOrder())
+		assert.NoError(t, err)
+		assert.Equal(t, 4, len(page.Keys))
+		assert.Equal(t, "tenant/bb/1", page.Keys[0].Key)
+	})
+
+	t.Run("swaps the id behind a key", func(t *testing.T) {
+		first := createAs(t, "tenant/c/doc", "first")
+		blob, err := store.Create(strings.NewReader("second"))
+		assert.NoError(t, err)
+
+		previous, err := transact(store.db, func(tr fdb.Transaction) (Id, error) {
+			return store.SwapKey(tr, "tenant/c/doc", blob.Id())
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, first, previous)
+
+		found, err := store.LookupKey("tenant/c/doc")
+		assert.NoError(t, err)
+		assert.Equal(t, blob.Id(), found)
+
+		_, err = transact(store.db, func(tr fdb.Transaction) (Id, error) {
+			return store.SwapKey(tr, "tenant/c/doc", "missing")
+		})
+		assert.True(t, errors.Is(err, BlobNotFoundError))
+	})
+
+	t.Run("removes keys", func(t *testing.T) {
+		id := createAs(t, "tenant/d/doc", "content")
+
+		removed, err := transact(store.db, func(tr fdb.Transaction) (Id, error) {
+			return store.RemoveKey(tr, "tenant/d/doc")
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, id, removed)
+
+		_, err = store.LookupKey("tenant/d/doc")
+		assert.True(t, errors.Is(err, KeyNotFoundError))
+	})
+
+	t.Run("removes the keys naming removed blobs", func(t *testing.T) {
+		id := createAs(t, "tenant/e/doc", "content")
+		other := createAs(t, "tenant/e/other", "other")
+
+		_, err := transact(store.db, func(tr fdb.Transaction) (Id, error) {
+			return store.SwapKey(tr, "tenant/e/copy", id)
+		})
+		assert.NoError(t, err)
+
+		_, err = transact(store.db, func(tr fdb.Transaction) (Id, error) {
+			return store.SwapKey(tr, "tenant/e/doc", other)
+		})
+		assert.NoError(t, err)
+
+		err = store.RemoveBlob(id)
+		assert.NoError(t, err)
+
+		_, err = store.LookupKey("tenant/e/copy")
+		assert.True(t, errors.Is(err, KeyNotFoundError))
+
+		named, err := store.LookupKey("tenant/e/doc")
+		assert.NoError(t, err)
+		assert.Equal(t, other, named)
+	})
+}
@@ -1,10 +1,20 @@
 package blobs
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
 
 // Store option type.
 type Option func(store *Store) error
 
+// The value size limit of FoundationDB, which bounds the size of stored chunks.
+const maxValueSize = 100000
+
+// The size AES-GCM adds to encrypted chunks, a 12 byte nonce and a 16 byte tag.
+const encryptionOverhead = 12 + 16
+
 // Sets the chunk size used to store blobs.
 //
 // Defaults to 10000 bytes.
@@ -13,11 +23,16 @@ type Option func(store *Store) error
 // were stored with, as that information is saved with the blob.
 //
 // The chunk size needs to be greater than zero and honour the limits of FoundationDB key value sizes.
+// Encrypted chunks need 28 bytes of the value for the nonce and tag, and chunks
+// that compress to more than the limit fail with a [ChunkTooLargeError].
 func WithChunkSize(chunkSize int) Option {
 	return func(store *Store) error {
 		if chunkSize < 1 {
 			return fmt.Errorf("invalid chunkSize 1 > %d", chunkSize)
 		}
+		if chunkSize > maxValueSize {
+			return fmt.Errorf("invalid chunkSize %d > %d", chunkSize, maxValueSize)
+		}
 		store.chunkSize = chunkSize
 		return nil
 	}
@@ -60,3 +75,105 @@ func WithIdGenerator(idGenerator IdGenerator) Option {
 		return nil
 	}
 }
+
+// Stores chunks content addressed, so identical chunks only takes up space once.
+//
+// Each chunk is stored under its SHA-256 hash and reference counted, blobs just
+// references the chunks they consist of. Identical blobs or blobs sharing chunks
+// will share the stored chunk data. Chunks are released when the blobs
+// referencing them are deleted.
+//
+// Notice it is always possible to read blobs no matter if they were stored
+// content addressed or not, as that information is saved with the blob.
+func WithDeduplication() Option {
+	return func(store *Store) error {
+		store.deduplicate = true
+		return nil
+	}
+}
+
+// Compresses the chunks of new blobs with the given codec.
+//
+// Defaults to no compression. The [GzipCodec], [ZstdCodec] and [SnappyCodec]
+// are built in, other codecs can be provided by implementing the [Codec]
+// interface.
+//
+// Notice it is always possible to read blobs no matter what codec they were
+// stored with, as that information is saved with the blob. The codec is
+// registered using [RegisterCodec], other processes reading blobs compressed
+// with a custom codec needs to register it as well.
+func WithCompression(codec Codec) Option {
+	return func(store *Store) error {
+		if codec == nil {
+			return errors.New("invalid codec, codec can't be nil")
+		}
+		RegisterCodec(codec)
+		store.codec = codec
+		return nil
+	}
+}
+
+// Encrypts the chunks of new blobs with AES-GCM using a data key per blob.
+//
+// Defaults to no encryption. The data key of each blob is wrapped by the given
+// key provider and stored with the blob. Chunks are compressed before they are
+// encrypted, and as each blob has its own data key, encrypted chunks are never
+// shared between blobs when deduplication is enabled.
+//
+// Notice that blobs that wasn't stored encrypted can still be read, but reading
+// encrypted blobs requires a key provider able to unwrap their data keys.
+func WithEncryption(keyProvider KeyProvider) Option {
+	return func(store *Store) error {
+		if keyProvider == nil {
+			return errors.New("invalid key provider, key provider can't be nil")
+		}
+		store.keyProvider = keyProvider
+		return nil
+	}
+}
+
+// Keeps at most the given number of versions of each versioned key, older
+// versions are removed when a new version is committed.
+//
+// Defaults to keeping all versions. Removed versions can be restored until they
+// are deleted, see [Store.RemoveBlob].
+func WithMaxVersions(maxVersions int) Option {
+	return func(store *Store) error {
+		if maxVersions < 1 {
+			return fmt.Errorf("invalid maxVersions 1 > %d", maxVersions)
+		}
+		store.maxVersions = maxVersions
+		return nil
+	}
+}
+
+// Keeps versions of versioned keys for the given duration after they were
+// committed, the latest version of a key is always kept.
+//
+// Defaults to keeping versions forever. Expired versions are removed when a new
+// version is committed or by [Store.PruneVersions].
+func WithVersionMaxAge(maxAge time.Duration) Option {
+	return func(store *Store) error {
+		if maxAge <= 0 {
+			return errors.New("invalid version max age, max age needs to be greater than zero")
+		}
+		store.versionMaxAge = maxAge
+		return nil
+	}
+}
+
+// Limits the total length of the content held by the store, see [Usage].
+//
+// Defaults to no limit. Uploads and appends that would exceed the quota are
+// rejected with a [QuotaExceededError], content stored before the quota was
+// exceeded is kept. Removed blobs count towards the quota until they are
+// deleted.
+func WithQuota(maxBytes uint64) Option {
+	return func(store *Store) error {
+		if maxBytes < 1 {
+			return errors.New("invalid quota, quota needs to be greater than zero")
+		}
+		store.quota = maxBytes
+		return nil
+	}
+}
@@ -97,3 +97,78 @@ func ExampleWithIdGenerator() {
 	// blob:1
 	// blob:2
 }
+
+func ExampleWithDeduplication() {
+	db := fdbConnect()
+
+	store, err := NewStore(db, testNamespace(), WithDeduplication())
+	if err != nil {
+		log.Fatalln("Could not create store")
+	}
+
+	for i := 0; i < 2; i++ {
+		// The content of the second blob is not stored again.
+		blob, err := store.Create(strings.NewReader("Blob content"))
+		if err != nil {
+			log.Fatal("Could not create blob")
+		}
+
+		content, err := io.ReadAll(blob.Reader())
+		if err != nil {
+			log.Fatal("Could not read blob content")
+		}
+
+		fmt.Printf("Blob content: %s\n", content)
+	}
+	// Output: Blob content: Blob content
+	// Blob content: Blob content
+}
+
+func ExampleWithCompression() {
+	db := fdbConnect()
+
+	store, err := NewStore(db, testNamespace(), WithCompression(GzipCodec{}))
+	if err != nil {
+		log.Fatalln("Could not create store")
+	}
+
+	blob, err := store.Create(strings.NewReader("Blob content"))
+	if err != nil {
+		log.Fatal("Could not create blob")
+	}
+
+	content, err := io.ReadAll(blob.Reader())
+	if err != nil {
+		log.Fatal("Could not read blob content")
+	}
+
+	fmt.Printf("Blob content: %s", content)
+	// Output: Blob content: Blob content
+}
+
+func ExampleWithEncryption() {
+	db := fdbConnect()
+
+	keyProvider := &AESKeyProvider{
+		Keys:         map[string][]byte{"key-1": []byte("0123456789abcdef0123456789abcdef")},
+		CurrentKeyId: "key-1",
+	}
+
+	store, err := NewStore(db, testNamespace(), WithEncryption(keyProvider))
+	if err != nil {
+		log.Fatalln("Could not create store")
+	}
+
+	blob, err := store.Create(strings.NewReader("Blob content"))
+	if err != nil {
+		log.Fatal("Could not create blob")
+	}
+
+	content, err := io.ReadAll(blob.Reader())
+	if err != nil {
+		log.Fatal("Could not read blob content")
+	}
+
+	fmt.Printf("Blob content: %s", content)
+	// Output: Blob content: Blob content
+}
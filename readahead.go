@@ -0,0 +1,479 @@
+package blobs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+var readerClosedError = errors.New("reader is closed")
+
+// Read ahead option type.
+type ReadAheadOption func(readAhead *readAheadOptions) error
+
+type readAheadOptions struct {
+	window  int
+	workers int
+	end     int64
+	hasEnd  bool
+}
+
+// Sets the maximum number of batches fetched ahead of the reader, each batch
+// holds chunks per transaction chunks.
+//
+// This bounds the memory used for content fetched ahead to the window times
+// the chunks per transaction times the chunk size of the blob. Defaults to 4
+// batches, or the number of workers if that is higher.
+func WithReadAheadWindow(window int) ReadAheadOption {
+	return func(readAhead *readAheadOptions) error {
+		if window < 1 {
+			return errors.New("invalid window, window needs to be greater than zero")
+		}
+		readAhead.window = window
+		return nil
+	}
+}
+
+// Sets the number of workers fetching batches concurrently, each worker runs a
+// transaction at a time.
+//
+// Defaults to 1 for read ahead readers and 4 for downloads.
+func WithWorkers(workers int) ReadAheadOption {
+	return func(readAhead *readAheadOptions) error {
+		if workers < 1 {
+			return errors.New("invalid workers, workers needs to be greater than zero")
+		}
+		readAhead.workers = workers
+		return nil
+	}
+}
+
+// Stops fetching ahead at the given byte offset, for readers that only read the
+// content up to that offset.
+//
+// Content after the offset is still returned, but it is only fetched a batch at
+// a time when it is read. Defaults to fetching until the end of the blob.
+func WithReadAheadEnd(end int64) ReadAheadOption {
+	return func(readAhead *readAheadOptions) error {
+		if end < 0 {
+			return errors.New("invalid end, end can't be negative")
+		}
+		readAhead.end = end
+		readAhead.hasEnd = true
+		return nil
+	}
+}
+
+func newReadAheadOptions(workers int, opts []ReadAheadOption) (*readAheadOptions, error) {
+	options := &readAheadOptions{workers: workers}
+
+	for _, opt := range opts {
+		err := opt(options)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if options.window == 0 {
+		options.window = 4
+		if options.workers > options.window {
+			options.window = options.workers
+		}
+	}
+
+	if options.window < options.workers {
+		return nil, errors.New("invalid window, window needs to be at least the number of workers")
+	}
+
+	return options, nil
+}
+
+// A batch of content fetched ahead of the reader.
+type fetchedBatch struct {
+	off  int64
+	data []byte
+	err  error
+}
+
+// A batch to fetch, and where to deliver it.
+type fetchJob struct {
+	off    int64
+	result chan fetchedBatch
+}
+
+// Fetches batches of chunks starting at a chunk aligned offset with a number of
+// workers, delivering the batches in order.
+//
+// At most window batches are fetched ahead of the batch last delivered.
+type prefetcher struct {
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	// The offset of the next batch delivered.
+	next  int64
+	slots chan struct{}
+	order chan chan fetchedBatch
+	// The number of batches queued for fetching, only read after stopping.
+	queued int
+}
+
+// Starts fetching the content of the pinned reader br from the chunk aligned
+// offset start up to the offset end.
+func startPrefetcher(ctx context.Context, br *reader, start, end int64, options *readAheadOptions) *prefetcher {
+	ctx, cancel := context.WithCancel(ctx)
+
+	// The fetching reader shares the pin, and only reads chunks so it is safe
+	// to use from multiple workers
+	fetcher := *br
+	fetcher.ctx = ctx
+	fetcher.buf = nil
+	fetcher.digest = nil
+
+	batchLen := int64(br.chunksPerTransaction) * int64(br.chunkSize)
+
+	p := &prefetcher{
+		cancel: cancel,
+		next:   start,
+		slots:  make(chan struct{}, options.window),
+		order:  make(chan chan fetchedBatch, options.window),
+	}
+
+	jobs := make(chan fetchJob)
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer close(jobs)
+		defer close(p.order)
+
+		for off := start; off < end; off += batchLen {
+			select {
+			case p.slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+
+			job := fetchJob{off: off, result: make(chan fetchedBatch, 1)}
+			p.order <- job.result
+			p.queued++
+
+			select {
+			case jobs <- job:
+			case <-ctx.Done():
+				job.result <- fetchedBatch{off: off, err: ctx.Err()}
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < options.workers; i++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+
+			for job := range jobs {
+				size := batchLen
+				if end-job.off < size {
+					size = end - job.off
+				}
+
+				data := make([]byte, size)
+				n, _, err := fetcher.readChunks(data, job.off)
+
+				if err == io.EOF && int64(n) == size {
+					err = nil
+				} else if err == nil && int64(n) < size {
+					err = io.ErrUnexpectedEOF
+				}
+
+				job.result <- fetchedBatch{off: job.off, data: data[:n], err: err}
+			}
+		}()
+	}
+
+	return p
+}
+
+// Returns the next batch in order, or io.EOF when there are no more batches.
+func (p *prefetcher) nextBatch() fetchedBatch {
+	result, ok := <-p.order
+	if !ok {
+		return fetchedBatch{off: p.next, err: io.EOF}
+	}
+
+	batch := <-result
+	<-p.slots
+
+	p.next = batch.off + int64(len(batch.data))
+
+	return batch
+}
+
+// Stops the workers and waits for them to finish.
+func (p *prefetcher) stop() {
+	p.cancel()
+	p.wg.Wait()
+}
+
+// Reader fetching the content of a blob ahead of the reads.
+type readAheadReader struct {
+	// Cancels the context of the reader when it is closed, which stops reads
+	// waiting for batches
+	cancel context.CancelCauseFunc
+	// Guards the fields below, and is held while reading
+	mu       sync.Mutex
+	br       *reader
+	options  *readAheadOptions
+	prefetch *prefetcher
+	closed   bool
+}
+
+// Returns a new reader for the content of the blob that fetches upcoming
+// batches of chunks in background goroutines while the content is read.
+//
+// This improves the throughput of reading large blobs sequentially. The reader
+// verifies the content like [Blob.Reader], and supports seeking, which restarts
+// fetching from the new position. Use [WithReadAheadWindow] to bound the memory
+// used and [WithWorkers] to fetch batches concurrently.
+//
+// The reader needs to be closed to stop the background goroutines. It can be
+// closed while it is being read from another goroutine, which stops the read.
+func (blob *Blob) ReadAheadReader(opts ...ReadAheadOption) (io.ReadSeekCloser, error) {
+	return blob.ReadAheadReaderContext(context.Background(), opts...)
+}
+
+// Like [Blob.ReadAheadReader], but the reader stops with the error of the
+// context when it is done.
+func (blob *Blob) ReadAheadReaderContext(ctx context.Context, opts ...ReadAheadOption) (io.ReadSeekCloser, error) {
+	return blob.newReadAheadReader(ctx, 1, opts)
+}
+
+func (blob *Blob) newReadAheadReader(ctx context.Context, workers int, opts []ReadAheadOption) (*readAheadReader, error) {
+	options, err := newReadAheadOptions(workers, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	return &readAheadReader{cancel: cancel, br: blob.newReader(ctx), options: options}, nil
+}
+
+// Pins the reader and starts fetching from the current position if needed.
+func (r *readAheadReader) start() error {
+	br := r.br
+
+	if r.prefetch != nil {
+		return nil
+	}
+
+	if br.pin == nil {
+		err := br.ctx.Err()
+		if err != nil {
+			return err
+		}
+
+		_, err = br.ensurePin()
+		if err != nil {
+			return err
+		}
+	}
+
+	if br.off >= br.pin.len {
+		return io.EOF
+	}
+
+	start := br.off - br.off%int64(br.chunkSize)
+
+	end := br.pin.len
+	if r.options.hasEnd {
+		if br.off >= r.options.end {
+			// Past the end only the batch being read is fetched
+			end = start + int64(br.chunksPerTransaction)*int64(br.chunkSize)
+		} else if r.options.end < br.pin.len {
+			end = r.options.end
+		}
+
+		if end > br.pin.len {
+			end = br.pin.len
+		}
+	}
+
+	r.prefetch = startPrefetcher(br.ctx, br, start, end, r.options)
+
+	return nil
+}
+
+// Fills the buffer of the reader with the next batch.
+func (r *readAheadReader) fill() error {
+	if r.closed {
+		return readerClosedError
+	}
+
+	for len(r.br.buf) == 0 {
+		err := r.start()
+		if err != nil {
+			return r.closedError(err)
+		}
+
+		batch := r.prefetch.nextBatch()
+
+		if batch.err == io.EOF && r.br.off < r.br.pin.len {
+			// Fetching stopped at the end given by WithReadAheadEnd, and is
+			// restarted from the position
+			r.stop()
+			continue
+		}
+
+		if batch.err != nil {
+			r.stop()
+			return r.closedError(batch.err)
+		}
+
+		// The first batch after seeking starts before the position
+		skip := r.br.off - batch.off
+		if skip < int64(len(batch.data)) {
+			r.br.buf = batch.data[skip:]
+		}
+	}
+
+	return nil
+}
+
+// Returns readerClosedError for errors caused by the reader being closed while
+// it was read.
+func (r *readAheadReader) closedError(err error) error {
+	if err != nil && err != io.EOF && context.Cause(r.br.ctx) == readerClosedError {
+		return readerClosedError
+	}
+
+	return err
+}
+
+func (r *readAheadReader) stop() {
+	if r.prefetch != nil {
+		r.prefetch.stop()
+		r.prefetch = nil
+	}
+}
+
+func (r *readAheadReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	br := r.br
+
+	if len(br.buf) == 0 {
+		err := r.fill()
+		if err != nil {
+			return 0, br.verify(nil, err)
+		}
+	}
+
+	n := copy(p, br.buf)
+	br.buf = br.buf[n:]
+	br.off += int64(n)
+
+	return n, br.verify(p[:n], nil)
+}
+
+// Writes the rest of the content to w, without copying it through an
+// intermediate buffer.
+func (r *readAheadReader) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	br := r.br
+	var written int64
+
+	for {
+		if len(br.buf) == 0 {
+			err := r.fill()
+			if err == io.EOF {
+				err = br.verify(nil, err)
+				if err == io.EOF {
+					err = nil
+				}
+				return written, err
+			}
+
+			if err != nil {
+				return written, err
+			}
+		}
+
+		n, err := w.Write(br.buf)
+		written += int64(n)
+
+		data := br.buf[:n]
+		br.buf = br.buf[n:]
+		br.off += int64(n)
+
+		err = br.verify(data, err)
+		if err != nil {
+			return written, err
+		}
+	}
+}
+
+func (r *readAheadReader) Seek(offset int64, whence int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return r.br.off, readerClosedError
+	}
+
+	abs, err := r.br.Seek(offset, whence)
+	if err != nil {
+		return abs, err
+	}
+
+	// Fetching continues after the buffered content, so it is restarted when
+	// seeking outside of it
+	if r.prefetch != nil && r.prefetch.next != abs+int64(len(r.br.buf)) {
+		r.stop()
+		r.br.buf = nil
+	}
+
+	return abs, nil
+}
+
+// Stops fetching and waits for the background goroutines to finish, reads in
+// progress return an error.
+func (r *readAheadReader) Close() error {
+	// Cancelling stops reads in progress, so the lock is released
+	r.cancel(readerClosedError)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stop()
+	r.closed = true
+	r.br.buf = nil
+
+	return nil
+}
+
+// Writes the content of the blob to w and returns the number of bytes written.
+//
+// The content is fetched in batches of chunks per transaction chunks, which
+// are split across a number of workers fetching concurrently, and written in
+// order. Use [WithWorkers] to set the number of workers and
+// [WithReadAheadWindow] to bound the memory used. The content is verified like
+// it is by [Blob.Reader].
+func (blob *Blob) Download(w io.Writer, opts ...ReadAheadOption) (int64, error) {
+	return blob.DownloadContext(context.Background(), w, opts...)
+}
+
+// Like [Blob.Download], but stops downloading with the error of the context
+// when it is done.
+func (blob *Blob) DownloadContext(ctx context.Context, w io.Writer, opts ...ReadAheadOption) (int64, error) {
+	r, err := blob.newReadAheadReader(ctx, 4, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	return r.WriteTo(w)
+}
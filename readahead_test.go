@@ -0,0 +1,220 @@
+package blobs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+// Waits for the number of goroutines to drop to the given number.
+func waitForGoroutines(t *testing.T, n int) {
+	deadline := time.Now().Add(time.Second)
+
+	for runtime.NumGoroutine() > n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines are running, expected %d", runtime.NumGoroutine(), n)
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestReadAheadReader(t *testing.T) {
+	input := strings.Repeat("0123456789", 105)
+
+	store := createTestStore(WithChunkSize(100), WithChunksPerTransaction(2), WithCompression(GzipCodec{}))
+
+	blob, err := store.Create(strings.NewReader(input))
+	assert.NoError(t, err)
+
+	t.Run("reads the content of the blob", func(t *testing.T) {
+		for _, workers := range []int{1, 3} {
+			r, err := blob.ReadAheadReader(WithWorkers(workers), WithReadAheadWindow(3))
+			assert.NoError(t, err)
+
+			data, err := io.ReadAll(r)
+			assert.NoError(t, err)
+			assert.Equal(t, input, string(data))
+
+			assert.NoError(t, r.Close())
+		}
+	})
+
+	t.Run("restarts fetching when seeking", func(t *testing.T) {
+		r, err := blob.ReadAheadReader()
+		assert.NoError(t, err)
+		defer r.Close()
+
+		buf := make([]byte, 10)
+		_, err = io.ReadFull(r, buf)
+		assert.NoError(t, err)
+
+		_, err = r.Seek(555, io.SeekStart)
+		assert.NoError(t, err)
+
+		data, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, input[555:], string(data))
+
+		_, err = r.Seek(-20, io.SeekEnd)
+		assert.NoError(t, err)
+
+		data, err = io.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, input[len(input)-20:], string(data))
+	})
+
+	t.Run("fails reading after it is closed", func(t *testing.T) {
+		r, err := blob.ReadAheadReader()
+		assert.NoError(t, err)
+
+		buf := make([]byte, 10)
+		_, err = r.Read(buf)
+		assert.NoError(t, err)
+
+		assert.NoError(t, r.Close())
+
+		_, err = io.ReadAll(r)
+		assert.EqualError(t, err, "reader is closed")
+	})
+
+	t.Run("stops the goroutines when it is closed while it is read", func(t *testing.T) {
+		goroutines := runtime.NumGoroutine()
+
+		r, err := blob.ReadAheadReader(WithWorkers(2))
+		assert.NoError(t, err)
+
+		buf := make([]byte, 10)
+		_, err = r.Read(buf)
+		assert.NoError(t, err)
+
+		done := make(chan error)
+		go func() {
+			_, err := io.Copy(io.Discard, iotest.OneByteReader(r))
+			done <- err
+		}()
+
+		assert.NoError(t, r.Close())
+
+		err = <-done
+		if err != nil {
+			assert.EqualError(t, err, "reader is closed")
+		}
+
+		waitForGoroutines(t, goroutines)
+	})
+
+	t.Run("stops reading when the context is done", func(t *testing.T) {
+		goroutines := runtime.NumGoroutine()
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		r, err := blob.ReadAheadReaderContext(ctx, WithWorkers(2))
+		assert.NoError(t, err)
+
+		buf := make([]byte, 10)
+		_, err = r.Read(buf)
+		assert.NoError(t, err)
+
+		cancel()
+
+		_, err = io.ReadAll(r)
+		assert.True(t, errors.Is(err, context.Canceled))
+
+		assert.NoError(t, r.Close())
+
+		waitForGoroutines(t, goroutines)
+	})
+
+	t.Run("fetches content after the end when it is read", func(t *testing.T) {
+		r, err := blob.ReadAheadReader(WithReadAheadEnd(250))
+		assert.NoError(t, err)
+		defer r.Close()
+
+		_, err = r.Seek(150, io.SeekStart)
+		assert.NoError(t, err)
+
+		data, err := io.ReadAll(io.LimitReader(r, 100))
+		assert.NoError(t, err)
+		assert.Equal(t, input[150:250], string(data))
+
+		data, err = io.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, input[250:], string(data))
+	})
+
+	t.Run("only fetches the batch being read after the end", func(t *testing.T) {
+		r, err := blob.newReadAheadReader(context.Background(), 2, []ReadAheadOption{WithReadAheadEnd(250)})
+		assert.NoError(t, err)
+		defer r.Close()
+
+		_, err = r.Seek(300, io.SeekStart)
+		assert.NoError(t, err)
+
+		data := make([]byte, 10)
+		_, err = io.ReadFull(r, data)
+		assert.NoError(t, err)
+		assert.Equal(t, input[300:310], string(data))
+
+		prefetch := r.prefetch
+		r.stop()
+		assert.Equal(t, 1, prefetch.queued)
+	})
+
+	t.Run("validates the options", func(t *testing.T) {
+		_, err := blob.ReadAheadReader(WithWorkers(0))
+		assert.EqualError(t, err, "invalid workers, workers needs to be greater than zero")
+
+		_, err = blob.ReadAheadReader(WithReadAheadEnd(-1))
+		assert.EqualError(t, err, "invalid end, end can't be negative")
+
+		_, err = blob.ReadAheadReader(WithWorkers(4), WithReadAheadWindow(2))
+		assert.EqualError(t, err, "invalid window, window needs to be at least the number of workers")
+	})
+}
+
+func TestDownload(t *testing.T) {
+	input := strings.Repeat("0123456789", 105)
+
+	store := createTestStore(WithChunkSize(100), WithChunksPerTransaction(2))
+
+	blob, err := store.Create(strings.NewReader(input))
+	assert.NoError(t, err)
+
+	t.Run("writes the content of the blob in order", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		n, err := blob.Download(&buf, WithWorkers(3))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len(input)), n)
+		assert.Equal(t, input, buf.String())
+	})
+
+	t.Run("reads the whole content with an end before the end of the blob", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		n, err := blob.Download(&buf, WithReadAheadEnd(10))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len(input)), n)
+		assert.Equal(t, input, buf.String())
+	})
+
+	t.Run("downloads empty blobs", func(t *testing.T) {
+		empty, err := store.Create(strings.NewReader(""))
+		assert.NoError(t, err)
+
+		var buf bytes.Buffer
+
+		n, err := empty.Download(&buf)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), n)
+	})
+}
@@ -1,79 +1,377 @@
 package blobs
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
 	"io"
-	"math"
+	"time"
 
 	"github.com/apple/foundationdb/bindings/go/src/fdb"
 	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
 )
 
 type reader struct {
+	ctx                  context.Context
 	db                   fdb.Database
 	dir                  directory.DirectorySubspace
-	off                  int
+	off                  int64
 	buf                  []byte
-	chunkSize            int
 	chunksPerTransaction int
+	chunksDir            subspace.Subspace
+	pin                  *readerPin
+	digest               hash.Hash
+	digested             int64
+	chunkEncoding
 }
 
-func (br *reader) Read(buf []byte) (int, error) {
-	read := copy(buf, br.buf)
-	br.buf = br.buf[read:]
+// The length, checksum and number of truncations of the blob when the reader
+// started reading. The committed version is only read for blobs without a
+// checksum.
+//
+// Pinning the length gives the reader a consistent view of blobs that are
+// appended to while reading. Truncations rewrite content within the pinned
+// length, so the reader checks that the blob wasn't truncated on every read.
+type readerPin struct {
+	len         int64
+	checksum    []byte
+	version     []byte
+	truncations uint64
+	modifiedAt  time.Time
+}
 
-	// This also take care of io.EOF
-	if len(buf) == read {
-		return read, nil
+func (br *reader) id() Id {
+	path := br.dir.GetPath()
+	return Id(path[len(path)-1])
+}
+
+// Returns the pin of the reader, reading it on the transaction if the reader
+// hasn't been pinned yet.
+//
+// Returns a [BlobConflictError] if the blob was truncated after the reader was
+// pinned.
+func (br *reader) readPin(tr fdb.ReadTransaction) (*readerPin, error) {
+	truncations, err := readTruncations(tr, br.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if br.pin != nil {
+		if truncations != br.pin.truncations {
+			return nil, fmt.Errorf("%w: %q was truncated while it was read", BlobConflictError, br.id())
+		}
+
+		return br.pin, nil
+	}
+
+	checksum := tr.Get(br.dir.Sub("checksum"))
+
+	data, err := tr.Get(br.dir.Sub("len")).Get()
+	if err != nil {
+		return nil, err
+	}
+
+	pin := &readerPin{len: int64(decodeUInt64(data)), truncations: truncations}
+
+	pin.modifiedAt, err = readModifiedAt(tr, br.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = checksum.Get()
+	if err != nil {
+		return nil, err
 	}
 
-	br.dir.Sub("chunkSize")
+	pin.checksum, err = br.openValue(br.id(), "checksum", data)
+	if err != nil {
+		return nil, err
+	}
+
+	if pin.checksum == nil {
+		pin.version, err = tr.Get(br.dir.Sub(committedVersionKey)).Get()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return pin, nil
+}
+
+// Pins the reader if it hasn't been pinned yet, and returns the pin.
+func (br *reader) ensurePin() (*readerPin, error) {
+	pin, err := readTransact(br.db, br.readPin)
+	if err != nil {
+		return nil, err
+	}
+
+	br.setPin(pin)
+
+	return br.pin, nil
+}
+
+func (br *reader) setPin(pin *readerPin) {
+	if br.pin != nil || pin == nil {
+		return
+	}
+
+	br.pin = pin
+
+	if pin.checksum != nil {
+		br.digest = sha256.New()
+		br.digested = 0
+	}
+}
+
+// Reads the chunks covering p starting at the byte offset off in a single
+// transaction. Returns the number of bytes read and the unread rest of the last
+// chunk fetched.
+//
+// Content beyond the pinned length is ignored. If the blob was truncated below
+// the pinned length, [io.ErrUnexpectedEOF] is returned.
+func (br *reader) readChunks(p []byte, off int64) (int, []byte, error) {
+	err := br.ctx.Err()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	chunkSize := int64(br.chunkSize)
+	startChunk := off / chunkSize
+	skip := int(off % chunkSize)
+
 	bytesSpace := br.dir.Sub("bytes")
+	if br.contentAddressed {
+		bytesSpace = br.dir.Sub("hashes")
+	}
+	checksumsSpace := br.dir.Sub("checksums")
+
+	var rest []byte
+	var pin *readerPin
+	read, err := readTransact(br.db, func(tr fdb.ReadTransaction) (int, error) {
+		var err error
+
+		rest = nil
+		pin, err = br.readPin(tr)
+		if err != nil {
+			return 0, err
+		}
+
+		if off >= pin.len {
+			return 0, io.EOF
+		}
+
+		endChunk := (off + int64(len(p)) + chunkSize - 1) / chunkSize
+
+		if endChunk-startChunk > int64(br.chunksPerTransaction) {
+			endChunk = startChunk + int64(br.chunksPerTransaction)
+		}
 
-	_, err := readTransact(br.db, func(tr fdb.ReadTransaction) (any, error) {
-		startChunk := br.off
-		endChunk := br.off + int(math.Ceil(float64(len(buf)-read)/float64(br.chunkSize)))
-		endChunkCap := int(math.Min(float64(startChunk+br.chunksPerTransaction), float64(endChunk))) + 1
+		if lastChunk := (pin.len + chunkSize - 1) / chunkSize; endChunk > lastChunk {
+			endChunk = lastChunk
+		}
 
-		chunkRange := fdb.KeyRange(fdb.KeyRange{
+		chunkRange := fdb.KeyRange{
 			Begin: bytesSpace.Sub(startChunk),
-			End:   bytesSpace.Sub(endChunkCap),
-		})
+			End:   bytesSpace.Sub(endChunk),
+		}
+
+		checksumRange := fdb.KeyRange{
+			Begin: checksumsSpace.Sub(startChunk),
+			End:   checksumsSpace.Sub(endChunk),
+		}
 
+		checksumsFuture := tr.GetRange(checksumRange, fdb.RangeOptions{})
 		entries, err := tr.GetRange(chunkRange, fdb.RangeOptions{}).GetSliceWithError()
 
 		if err != nil {
-			return read, err
+			return 0, err
+		}
+
+		err = checkChunkIndexes(br.id(), bytesSpace, startChunk, entries)
+		if err != nil {
+			return 0, err
 		}
 
-		if len(entries) == 0 {
-			// Didn't find any entries, we are done
-			return read, io.EOF
+		if int64(len(entries)) < endChunk-startChunk {
+			// Chunks within the pinned length are missing
+			return 0, io.ErrUnexpectedEOF
 		}
 
-		for _, v := range entries {
-			n := copy(buf[read:], v.Value)
-			br.off += 1
+		chunks := make([][]byte, len(entries))
+		for i, v := range entries {
+			chunks[i] = v.Value
+		}
+
+		if br.contentAddressed {
+			chunks, err = resolveChunks(tr, br.chunksDir, entries)
+
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		payloads := chunks
+		chunks, err = br.decode(br.id(), startChunk, chunks)
+
+		if err != nil {
+			return 0, err
+		}
+
+		checksums, err := checksumsFuture.GetSliceWithError()
+		if err != nil {
+			return 0, err
+		}
+
+		err = verifyChunks(br.id(), startChunk, br.checksummedChunks(payloads, chunks), checksumsSpace, checksums)
+		if err != nil {
+			return 0, err
+		}
+
+		read := 0
+		for i, chunk := range chunks {
+			chunkEnd := pin.len - (startChunk+int64(i))*chunkSize
+			if chunkEnd > chunkSize {
+				chunkEnd = chunkSize
+			}
+
+			if int64(len(chunk)) < chunkEnd {
+				// The blob was truncated after the reader was pinned
+				return read, io.ErrUnexpectedEOF
+			}
+
+			value := chunk[:chunkEnd]
+			if i == 0 {
+				value = value[skip:]
+			}
+
+			n := copy(p[read:], value)
 			read += n
 
-			if n < len(v.Value) {
-				// No more output buffer, safe the rest for next read
-				br.buf = v.Value[n:]
+			if n < len(value) {
+				// No more output buffer, save the rest for next read
+				rest = value[n:]
 				return read, nil
-			} else if len(v.Value) < br.chunkSize {
-				// chunk is too short and we read all of it;
-				// we are now at the end
-				return read, io.EOF
 			}
-		}
 
-		if len(entries[len(entries)-1].Value) < br.chunkSize {
-			// last chunk was too short
-			// we hit the end
-			return read, io.EOF
+			if off+int64(read) == pin.len {
+				// We read to the end of the pinned length
+				return read, io.EOF
+			}
 		}
 
 		return read, nil
 	})
 
-	return read, err
+	br.setPin(pin)
+
+	return read, rest, err
+}
+
+func (br *reader) Read(p []byte) (int, error) {
+	read := copy(p, br.buf)
+	br.buf = br.buf[read:]
+	br.off += int64(read)
+
+	if len(p) == read {
+		return read, br.verify(p[:read], nil)
+	}
+
+	n, rest, err := br.readChunks(p[read:], br.off)
+	br.off += int64(n)
+	br.buf = rest
+
+	return read + n, br.verify(p[:read+n], err)
+}
+
+// Feeds content read sequentially from the start of the blob into the digest,
+// and verifies the digest against the checksum of the blob when the end is
+// reached.
+func (br *reader) verify(p []byte, err error) error {
+	if br.digest == nil || br.digested != br.off-int64(len(p)) {
+		// Not reading sequentially from the start
+		return err
+	}
+
+	br.digest.Write(p)
+	br.digested += int64(len(p))
+
+	if err == io.EOF && !bytes.Equal(br.digest.Sum(nil), br.pin.checksum) {
+		return fmt.Errorf("%w: checksum mismatch for %q", CorruptBlobError, br.id())
+	}
+
+	return err
+}
+
+func (br *reader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+
+	read := 0
+	for read < len(p) {
+		n, _, err := br.readChunks(p[read:], off+int64(read))
+		read += n
+
+		if err == io.EOF && read == len(p) {
+			// The requested range ends at the end of the blob
+			return read, nil
+		}
+
+		if err != nil {
+			return read, err
+		}
+	}
+
+	return read, nil
+}
+
+func (br *reader) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = br.off + offset
+	case io.SeekEnd:
+		err := br.ctx.Err()
+		if err != nil {
+			return br.off, err
+		}
+
+		pin, err := br.ensurePin()
+
+		if err != nil {
+			return br.off, err
+		}
+
+		abs = pin.len + offset
+	default:
+		return br.off, fmt.Errorf("invalid whence %d", whence)
+	}
+
+	if abs < 0 {
+		return br.off, errors.New("negative position")
+	}
+
+	if br.off <= abs && abs <= br.off+int64(len(br.buf)) {
+		// Seeking within the buffered chunk
+		br.buf = br.buf[abs-br.off:]
+	} else {
+		br.buf = nil
+	}
+
+	br.off = abs
+
+	if br.digest != nil && abs == 0 {
+		// Reading from the start again
+		br.digest.Reset()
+		br.digested = 0
+	}
+
+	return abs, nil
 }
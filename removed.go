@@ -1,78 +1,177 @@
 package blobs
 
 import (
+	"context"
+	"fmt"
 	"time"
 
 	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
 )
 
 // Marks the blob with the given id as removed.
 //
 // After a blob is removed it can't be retrieved anymore, but any active readers
 // can still access the removed blob. The removed blobs can be fully deleted
-// using the [Store.DeleteRemovedBlobsBefore] method.
+// using the [Store.DeleteRemovedBlobsBefore] method. Keys naming the blob are
+// removed together with it.
 func (store *Store) RemoveBlob(id Id) error {
+	return store.RemoveBlobContext(context.Background(), id)
+}
+
+// Like [Store.RemoveBlob], but returns the error of the context if it is done.
+func (store *Store) RemoveBlobContext(ctx context.Context, id Id) error {
+	err := ctx.Err()
+	if err != nil {
+		return err
+	}
+
 	return updateTransact(store.db, func(tr fdb.Transaction) error {
-		blobDir, err := store.openBlobDir(id)
-		if err != nil {
-			return err
-		}
+		return store.RemoveBlobTx(tr, id)
+	})
+}
 
-		removedPath := append(store.removedDir.GetPath(), string(id))
-		dst, err := blobDir.MoveTo(tr, removedPath)
+// Like [Store.RemoveBlob], but removes the blob on the given transaction.
+//
+// This makes it possible to remove a blob atomically together with other
+// writes.
+func (store *Store) RemoveBlobTx(tr fdb.Transaction, id Id) error {
+	return store.removeBlobTx(tr, id, store.systemTime.Now().Unix())
+}
 
-		if err != nil {
-			return err
-		}
+// Removes the blob on the transaction, recording it as removed at the given
+// unix timestamp.
+func (store *Store) removeBlobTx(tr fdb.Transaction, id Id, unixTimestamp int64) error {
+	blobDir, err := store.openBlobDir(tr, id)
+	if err != nil {
+		return err
+	}
 
-		unixTimestamp := store.systemTime.Now().Unix()
-		tr.Set(dst.Sub("deletedAt"), encodeUInt64(uint64(unixTimestamp)))
+	length, err := readLen(tr, blobDir)
+	if err != nil {
+		return err
+	}
 
-		return nil
-	})
+	err = store.removeKeysOf(tr, blobDir, id)
+	if err != nil {
+		return err
+	}
+
+	dst, err := moveEntry(tr, store.blobsDir, blobDir, store.removedDir, string(id))
+
+	if err != nil {
+		return err
+	}
+
+	tr.Set(dst.Sub("deletedAt"), encodeUInt64(uint64(unixTimestamp)))
+	store.addToCleanupIndex(tr, removedIndex, unixTimestamp, id)
+
+	store.addUsage(tr, bytesCounter, -length)
+	store.addUsage(tr, blobsCounter, -1)
+	store.addUsage(tr, removedBytesCounter, length)
+
+	return nil
 }
 
-// Deletes blobs that was marked as removed before a given date.
+func (store *Store) openRemovedBlobDir(rt fdb.ReadTransactor, id Id) (directory.DirectorySubspace, error) {
+	removedBlobDir, err := store.removedDir.Open(rt, []string{string(id)}, nil)
+
+	if err != nil {
+		return removedBlobDir, fmt.Errorf("%w: %q", BlobNotFoundError, id)
+	}
+
+	return removedBlobDir, nil
+}
+
+// Returns a blob instance for the removed blob with the given id.
 //
-// This is useful to make a periodical cleaning job.
-func (store *Store) DeleteRemovedBlobsBefore(date time.Time) ([]Id, error) {
-	var deletedIds []Id
-	err := updateTransact(store.db, func(tr fdb.Transaction) error {
-		ids, err := store.removedDir.List(tr, []string{})
+// This makes it possible to inspect the content and metadata of a removed blob
+// before restoring it using [Store.RestoreBlob]. Removed blobs can be retrieved
+// until they are deleted.
+func (store *Store) RemovedBlob(id Id) (*Blob, error) {
+	return store.RemovedBlobContext(context.Background(), id)
+}
+
+// Like [Store.RemovedBlob], but returns the error of the context if it is done.
+func (store *Store) RemovedBlobContext(ctx context.Context, id Id) (*Blob, error) {
+	err := ctx.Err()
+	if err != nil {
+		return nil, err
+	}
 
+	removedBlobDir, err := store.openRemovedBlobDir(store.db, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return store.loadBlob(removedBlobDir)
+}
+
+// Restores the removed blob with the given id, making it retrievable again.
+//
+// The blob keeps the time it was created at. Blobs can be restored until they
+// are deleted using [Store.DeleteRemovedBlobsBefore].
+func (store *Store) RestoreBlob(id Id) error {
+	return store.RestoreBlobContext(context.Background(), id)
+}
+
+// Like [Store.RestoreBlob], but returns the error of the context if it is done.
+func (store *Store) RestoreBlobContext(ctx context.Context, id Id) error {
+	err := ctx.Err()
+	if err != nil {
+		return err
+	}
+
+	return updateTransact(store.db, func(tr fdb.Transaction) error {
+		removedBlobDir, err := store.openRemovedBlobDir(tr, id)
 		if err != nil {
 			return err
 		}
 
-		for _, id := range ids {
-			removedBlobDir, err := store.removedDir.Open(tr, []string{id}, nil)
-
-			if err != nil {
-				return err
-			}
+		err = store.removeFromCleanupIndex(tr, removedIndex, removedBlobDir, "deletedAt", id)
+		if err != nil {
+			return err
+		}
 
-			data, err := tr.Get(removedBlobDir.Sub("deletedAt")).Get()
+		length, err := readLen(tr, removedBlobDir)
+		if err != nil {
+			return err
+		}
 
-			if err != nil {
-				return err
-			}
+		dst, err := moveEntry(tr, store.removedDir, removedBlobDir, store.blobsDir, string(id))
 
-			deletedAt := time.Unix(int64(decodeUInt64(data)), 0)
+		if err != nil {
+			return err
+		}
 
-			if deletedAt.Before(date) {
-				deleted, err := store.removedDir.Remove(tr, []string{id})
-				if err != nil {
-					return err
-				}
+		tr.Clear(dst.Sub("deletedAt"))
+		setCommittedVersion(tr, dst)
 
-				if deleted {
-					deletedIds = append(deletedIds, Id(id))
-				}
-			}
-		}
+		store.addUsage(tr, removedBytesCounter, -length)
+		store.addUsage(tr, bytesCounter, length)
+		store.addUsage(tr, blobsCounter, 1)
 
 		return nil
 	})
+}
+
+// Deletes blobs that was marked as removed before a given date.
+//
+// This is useful to make a periodical cleaning job.
+//
+// Only the expired blobs are read, using an index ordered by the time the blobs
+// were removed. The blobs are deleted in batches across multiple transactions,
+// so the deleted ids are returned together with an error if a batch fails.
+// Running it again continues with the blobs that wasn't deleted yet.
+//
+// Content addressed chunks referenced by the deleted blobs are released.
+func (store *Store) DeleteRemovedBlobsBefore(date time.Time, opts ...CleanupOption) ([]Id, error) {
+	return store.DeleteRemovedBlobsBeforeContext(context.Background(), date, opts...)
+}
 
-	return deletedIds, err
+// Like [Store.DeleteRemovedBlobsBefore], but returns the error of the context if
+// it is done. Batches deleted before the context was done stay deleted.
+func (store *Store) DeleteRemovedBlobsBeforeContext(ctx context.Context, date time.Time, opts ...CleanupOption) ([]Id, error) {
+	return store.deleteExpired(ctx, removedIndex, store.removedDir, removedBytesCounter, date, opts)
 }
@@ -1,6 +1,7 @@
 package blobs
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"strings"
@@ -8,6 +9,7 @@ import (
 	"time"
 
 	"github.com/alecthomas/assert/v2"
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
 )
 
 func TestRemoveBlob(t *testing.T) {
@@ -70,3 +72,118 @@ func TestDeleteRemovedBlobsBefore(t *testing.T) {
 		assert.Equal(t, 5, len(deleted), "Removed blobs that was deleted")
 	})
 }
+
+func TestRestoreBlob(t *testing.T) {
+	date, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+
+	st := &SystemTimeMock{Time: date}
+
+	store := createTestStore(
+		WithChunkSize(100),
+		WithSystemTime(st),
+	)
+
+	t.Run("removed blobs can be inspected and restored", func(t *testing.T) {
+		blob, err := store.Create(strings.NewReader("content"), WithFilename("file.txt"))
+		assert.NoError(t, err)
+
+		st.Time = date.Add(time.Hour)
+		err = store.RemoveBlob(blob.Id())
+		assert.NoError(t, err)
+
+		removedBlob, err := store.RemovedBlob(blob.Id())
+		assert.NoError(t, err)
+		metadata, err := removedBlob.Metadata()
+		assert.NoError(t, err)
+		assert.Equal(t, "file.txt", metadata.Filename)
+
+		err = store.RestoreBlob(blob.Id())
+		assert.NoError(t, err)
+
+		restoredBlob, err := store.Blob(blob.Id())
+		assert.NoError(t, err)
+		data, err := io.ReadAll(restoredBlob.Reader())
+		assert.NoError(t, err)
+		assert.Equal(t, "content", string(data))
+
+		createdAt, err := restoredBlob.CreatedAt()
+		assert.NoError(t, err)
+		assert.Equal(t, date, createdAt.UTC())
+
+		_, err = store.RemovedBlob(blob.Id())
+		assert.True(t, errors.Is(err, BlobNotFoundError))
+	})
+
+	t.Run("restored blobs are not deleted by the cleanup", func(t *testing.T) {
+		blob, err := store.Create(strings.NewReader("content"))
+		assert.NoError(t, err)
+		err = store.RemoveBlob(blob.Id())
+		assert.NoError(t, err)
+		err = store.RestoreBlob(blob.Id())
+		assert.NoError(t, err)
+
+		deleted, err := store.DeleteRemovedBlobsBefore(st.Time.Add(time.Hour))
+		assert.NoError(t, err)
+		assert.Equal(t, 0, len(deleted))
+
+		_, err = store.Blob(blob.Id())
+		assert.NoError(t, err)
+	})
+
+	t.Run("restoring a blob that isn't removed fails", func(t *testing.T) {
+		err := store.RestoreBlob("missing")
+		assert.EqualError(t, err, `blob not found: "missing"`)
+	})
+}
+
+func TestRemoveBlobTx(t *testing.T) {
+	store := createTestStore(WithChunkSize(100))
+
+	t.Run("removes the blob together with other writes", func(t *testing.T) {
+		blob, err := store.Create(strings.NewReader("content"))
+		assert.NoError(t, err)
+
+		recordKey := fdb.Key("test-record-" + string(blob.Id()))
+
+		_, err = store.db.Transact(func(tr fdb.Transaction) (any, error) {
+			txBlob, err := store.BlobTx(tr, blob.Id())
+			if err != nil {
+				return nil, err
+			}
+
+			length, err := txBlob.LenTx(tr)
+			if err != nil {
+				return nil, err
+			}
+			assert.Equal(t, uint64(7), length)
+
+			tr.Clear(recordKey)
+
+			return nil, store.RemoveBlobTx(tr, blob.Id())
+		})
+		assert.NoError(t, err)
+
+		_, err = store.Blob(blob.Id())
+		assert.True(t, errors.Is(err, BlobNotFoundError))
+	})
+
+	t.Run("nothing is removed when the transaction fails", func(t *testing.T) {
+		blob, err := store.Create(strings.NewReader("content"))
+		assert.NoError(t, err)
+
+		failure := errors.New("failure")
+
+		_, err = store.db.Transact(func(tr fdb.Transaction) (any, error) {
+			err := store.RemoveBlobTx(tr, blob.Id())
+			if err != nil {
+				return nil, err
+			}
+
+			return nil, failure
+		})
+		assert.Equal(t, failure, err)
+
+		_, err = store.Blob(blob.Id())
+		assert.NoError(t, err)
+	})
+}
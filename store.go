@@ -1,8 +1,10 @@
 package blobs
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/apple/foundationdb/bindings/go/src/fdb"
 	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
@@ -19,10 +21,21 @@ type Store struct {
 	blobsDir             directory.DirectorySubspace
 	removedDir           directory.DirectorySubspace
 	uploadsDir           directory.DirectorySubspace
+	chunksDir            directory.DirectorySubspace
+	cleanupDir           directory.DirectorySubspace
+	versionsDir          directory.DirectorySubspace
+	namesDir             directory.DirectorySubspace
+	usageDir             directory.DirectorySubspace
 	chunkSize            int
 	chunksPerTransaction int
 	systemTime           SystemTime
 	idGenerator          IdGenerator
+	deduplicate          bool
+	codec                Codec
+	keyProvider          KeyProvider
+	maxVersions          int
+	versionMaxAge        time.Duration
+	quota                uint64
 }
 
 // NewStore constructs a new blob store with the given FoundationDB instance, a
@@ -44,12 +57,37 @@ func NewStore(db fdb.Database, ns string, opts ...Option) (*Store, error) {
 	if err != nil {
 		return nil, err
 	}
+	chunksDir, err := createDirectory(db, dir, "chunks")
+	if err != nil {
+		return nil, err
+	}
+	cleanupDir, err := createDirectory(db, dir, "cleanup")
+	if err != nil {
+		return nil, err
+	}
+	versionsDir, err := createDirectory(db, dir, "versions")
+	if err != nil {
+		return nil, err
+	}
+	namesDir, err := createDirectory(db, dir, "names")
+	if err != nil {
+		return nil, err
+	}
+	usageDir, err := createDirectory(db, dir, "usage")
+	if err != nil {
+		return nil, err
+	}
 
 	store := &Store{
 		db:                   db,
 		blobsDir:             blobsDir,
 		uploadsDir:           uploadsDir,
 		removedDir:           removedDir,
+		chunksDir:            chunksDir,
+		cleanupDir:           cleanupDir,
+		versionsDir:          versionsDir,
+		namesDir:             namesDir,
+		usageDir:             usageDir,
 		chunkSize:            10000,
 		chunksPerTransaction: 100,
 		systemTime:           realClock{},
@@ -63,11 +101,28 @@ func NewStore(db fdb.Database, ns string, opts ...Option) (*Store, error) {
 		}
 	}
 
+	if store.chunkSize > store.maxChunkSize() {
+		return store, fmt.Errorf("invalid chunkSize %d > %d, encrypted chunks need room for the nonce and tag", store.chunkSize, store.maxChunkSize())
+	}
+
+	releasingDir, err := transact(db, store.openReleasingDir)
+	if err != nil {
+		return store, err
+	}
+
+	// Index the entries of stores created before entries were indexed
+	for _, entriesDir := range []directory.DirectorySubspace{blobsDir, uploadsDir, removedDir, releasingDir} {
+		err := indexEntries(db, entriesDir, 100)
+		if err != nil {
+			return store, err
+		}
+	}
+
 	return store, nil
 }
 
-func (store *Store) openBlobDir(id Id) (directory.DirectorySubspace, error) {
-	blobDir, err := store.blobsDir.Open(store.db, []string{string(id)}, nil)
+func (store *Store) openBlobDir(rt fdb.ReadTransactor, id Id) (directory.DirectorySubspace, error) {
+	blobDir, err := store.blobsDir.Open(rt, []string{string(id)}, nil)
 
 	if err != nil {
 		return blobDir, fmt.Errorf("%w: %q", BlobNotFoundError, id)
@@ -78,46 +133,94 @@ func (store *Store) openBlobDir(id Id) (directory.DirectorySubspace, error) {
 
 // Returns a blob instance for the given id.
 func (store *Store) Blob(id Id) (*Blob, error) {
-	blobDir, err := store.openBlobDir(id)
+	return store.BlobContext(context.Background(), id)
+}
 
+// Like [Store.Blob], but returns the error of the context if it is done.
+//
+// Use [Blob.ReaderContext] to bound reading the content of the blob by a
+// context.
+func (store *Store) BlobContext(ctx context.Context, id Id) (*Blob, error) {
+	err := ctx.Err()
 	if err != nil {
 		return nil, err
 	}
 
-	data, err := readTransact(store.db, func(tr fdb.ReadTransaction) ([]byte, error) {
-		return tr.Get(blobDir.Sub("chunkSize")).Get()
-	})
+	blobDir, err := store.openBlobDir(store.db, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return store.loadBlob(blobDir)
+}
+
+// Like [Store.Blob], but retrieves the blob on the given transaction.
+//
+// The returned blob reads its content in its own transactions.
+func (store *Store) BlobTx(tr fdb.ReadTransaction, id Id) (*Blob, error) {
+	blobDir, err := store.openBlobDir(tr, id)
 
 	if err != nil {
 		return nil, err
 	}
 
-	chunkSize := int(decodeUInt64(data))
+	return store.loadBlobTx(tr, blobDir)
+}
+
+// Returns a blob instance for the blob stored in the given directory.
+func (store *Store) loadBlob(blobDir directory.DirectorySubspace) (*Blob, error) {
+	return readTransact(store.db, func(tr fdb.ReadTransaction) (*Blob, error) {
+		return store.loadBlobTx(tr, blobDir)
+	})
+}
 
+func (store *Store) loadBlobTx(tr fdb.ReadTransaction, blobDir directory.DirectorySubspace) (*Blob, error) {
 	blob := &Blob{
 		db:                   store.db,
 		dir:                  blobDir,
-		chunkSize:            chunkSize,
 		chunksPerTransaction: store.chunksPerTransaction,
+		chunksDir:            store.chunksDir,
+	}
+
+	var err error
+
+	blob.chunkEncoding, err = store.readChunkEncoding(tr, blobDir)
+	if err != nil {
+		return nil, err
 	}
 
-	return blob, err
+	return blob, nil
 }
 
 // Creates and returns a new blob with the content of the given reader r.
-func (store *Store) Create(r io.Reader) (*Blob, error) {
-	token, err := store.Upload(r)
+//
+// Metadata can be attached to the blob using upload options.
+func (store *Store) Create(r io.Reader, opts ...UploadOption) (*Blob, error) {
+	return store.CreateContext(context.Background(), r, opts...)
+}
+
+// Like [Store.Create], but stops creating the blob with the error of the
+// context when it is done. The partial upload is deleted when the context is
+// done or the upload can't be committed.
+func (store *Store) CreateContext(ctx context.Context, r io.Reader, opts ...UploadOption) (*Blob, error) {
+	token, err := store.UploadContext(ctx, r, opts...)
 	if err != nil {
 		return nil, err
 	}
 
+	err = ctx.Err()
+	if err != nil {
+		return nil, store.abortFailedUpload(token, err)
+	}
+
 	id, err := transact(store.db, func(tr fdb.Transaction) (Id, error) {
 		return store.CommitUpload(tr, token)
 	})
 
 	if err != nil {
-		return nil, err
+		return nil, store.abortFailedUpload(token, err)
 	}
 
-	return store.Blob(id)
+	return store.BlobContext(ctx, id)
 }
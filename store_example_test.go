@@ -197,6 +197,67 @@ func ExampleStore_RemoveBlob() {
 	// Output: Blob not found
 }
 
+func ExampleStore_RestoreBlob() {
+	store := createTestStore()
+
+	r := strings.NewReader("My blob content")
+	createdBlob, err := store.Create(r)
+	if err != nil {
+		log.Fatal("Could not create blob")
+	}
+
+	err = store.RemoveBlob(createdBlob.Id())
+	if err != nil {
+		log.Fatal("Could not remove blob")
+	}
+
+	err = store.RestoreBlob(createdBlob.Id())
+	if err != nil {
+		log.Fatal("Could not restore blob")
+	}
+
+	blob, err := store.Blob(createdBlob.Id())
+	if err != nil {
+		log.Fatal("Could not retrieve blob")
+	}
+
+	content, err := io.ReadAll(blob.Reader())
+	if err != nil {
+		log.Fatal("Could not read blob")
+	}
+
+	fmt.Println(string(content))
+	// Output: My blob content
+}
+
+func ExampleStore_CopyBlob() {
+	store := createTestStore()
+
+	r := strings.NewReader("My blob content")
+	blob, err := store.Create(r)
+	if err != nil {
+		log.Fatal("Could not create blob")
+	}
+
+	id, err := store.CopyBlob(blob.Id())
+	if err != nil {
+		log.Fatal("Could not copy blob")
+	}
+
+	copiedBlob, err := store.Blob(id)
+	if err != nil {
+		log.Fatal("Could not retrieve blob")
+	}
+
+	content, err := io.ReadAll(copiedBlob.Reader())
+	if err != nil {
+		log.Fatal("Could not read blob")
+	}
+
+	fmt.Println(string(content))
+	// Output: My blob content
+}
+
 func ExampleStore_Upload() {
 	db := fdbConnect()
 	store, err := NewStore(db, testNamespace())
@@ -231,3 +292,108 @@ func ExampleStore_Upload() {
 	fmt.Printf("Blob content: %s", content)
 	// Output: Blob content: My blob content
 }
+
+func ExampleStore_StartUpload() {
+	store := createTestStore()
+
+	token, err := store.StartUpload()
+	if err != nil {
+		log.Fatal("Could not start upload")
+	}
+
+	for _, part := range []string{"My blob", " content"} {
+		_, err := store.AppendUpload(token, strings.NewReader(part))
+		if err != nil {
+			log.Fatal("Could not append to upload")
+		}
+	}
+
+	id, err := transact(store.db, func(tr fdb.Transaction) (Id, error) {
+		return store.CommitUpload(tr, token)
+	})
+	if err != nil {
+		log.Fatal("Could not commit upload")
+	}
+
+	blob, err := store.Blob(id)
+	if err != nil {
+		log.Fatal("Could not retrieve blob")
+	}
+
+	content, err := io.ReadAll(blob.Reader())
+	if err != nil {
+		log.Fatal("Could not read blob content")
+	}
+
+	fmt.Printf("Blob content: %s", content)
+	// Output: Blob content: My blob content
+}
+
+func ExampleStore_NewUploadWriter() {
+	store := createTestStore()
+
+	w, err := store.NewUploadWriter()
+	if err != nil {
+		log.Fatal("Could not create upload writer")
+	}
+
+	fmt.Fprintf(w, "My blob content")
+
+	err = w.Close()
+	if err != nil {
+		log.Fatal("Could not upload blob")
+	}
+
+	id, err := transact(store.db, func(tr fdb.Transaction) (Id, error) {
+		return store.CommitUpload(tr, w.Token())
+	})
+	if err != nil {
+		log.Fatal("Could not commit upload")
+	}
+
+	blob, err := store.Blob(id)
+	if err != nil {
+		log.Fatal("Could not retrieve blob")
+	}
+
+	content, err := io.ReadAll(blob.Reader())
+	if err != nil {
+		log.Fatal("Could not read blob content")
+	}
+
+	fmt.Printf("Blob content: %s", content)
+	// Output: Blob content: My blob content
+}
+
+func ExampleStore_ListBlobs() {
+	store := createTestStore(WithIdGenerator(&TestIdgenerator{}))
+
+	for i := 0; i < 5; i++ {
+		_, err := store.Create(strings.NewReader("Blob content"))
+		if err != nil {
+			log.Fatal("Could not create blob")
+		}
+	}
+
+	var cursor string
+	for {
+		page, err := store.ListBlobs(WithLimit(2), WithCursor(cursor))
+		if err != nil {
+			log.Fatal("Could not list blobs")
+		}
+
+		for _, blob := range page.Blobs {
+			fmt.Println(blob.Id)
+		}
+
+		if page.Cursor == "" {
+			break
+		}
+		cursor = page.Cursor
+	}
+	// Output: blob:0
+	// blob:1
+	// blob:2
+	// blob:3
+	// blob:4
+}
@@ -7,7 +7,11 @@ func transact[T any](db fdb.Transactor, cb func(tr fdb.Transaction) (T, error))
 		return cb(tr)
 	})
 
-	return result.(T), err
+	// The result is nil when the transaction fails without a result, the value
+	// is then the zero value
+	value, _ := result.(T)
+
+	return value, err
 }
 
 func readTransact[T any](db fdb.ReadTransactor, cb func(tr fdb.ReadTransaction) (T, error)) (T, error) {
@@ -15,7 +19,11 @@ func readTransact[T any](db fdb.ReadTransactor, cb func(tr fdb.ReadTransaction)
 		return cb(tr)
 	})
 
-	return result.(T), err
+	// The result is nil when the transaction fails without a result, the value
+	// is then the zero value
+	value, _ := result.(T)
+
+	return value, err
 }
 
 func updateTransact(db fdb.Transactor, cb func(tr fdb.Transaction) error) error {
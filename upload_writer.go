@@ -0,0 +1,133 @@
+package blobs
+
+import (
+	"bytes"
+	"errors"
+)
+
+// Writer uploading the content written to it.
+//
+// Content is buffered until there is enough to fill the chunks of a
+// transaction, which are then appended to the upload. Closing the writer
+// flushes the rest of the content and makes the token for commiting the upload
+// available.
+type UploadWriter struct {
+	store     *Store
+	token     UploadToken
+	len       uint64
+	buf       []byte
+	batchSize int
+	closed    bool
+	err       error
+}
+
+// Returns a new writer uploading the content written to it into a temporary
+// location. After the writer is closed the upload can be commited on a
+// transaction using the token of the writer.
+//
+// Metadata can be attached to the blob using upload options.
+func (store *Store) NewUploadWriter(opts ...UploadOption) (*UploadWriter, error) {
+	token, err := store.StartUpload(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &UploadWriter{
+		store:     store,
+		token:     token,
+		batchSize: store.chunkSize * store.chunksPerTransaction,
+	}
+
+	return w, nil
+}
+
+// Appends the first n buffered bytes to the upload and returns the number of
+// them that were committed, which is less than n when a transaction fails.
+func (w *UploadWriter) flush(n int) (int, error) {
+	length, err := w.store.AppendUpload(w.token, bytes.NewReader(w.buf[:n]))
+
+	flushed := 0
+	if length > w.len {
+		flushed = int(length - w.len)
+		w.len = length
+	}
+
+	w.buf = append(w.buf[:0], w.buf[flushed:]...)
+
+	return flushed, err
+}
+
+// Writes p to the upload.
+//
+// Content is appended to the upload whenever there is enough buffered content
+// to fill a transaction. If a transaction fails, the number of bytes of p
+// committed to the upload before the failure is returned with the error.
+func (w *UploadWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("write to closed upload writer")
+	}
+
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	buffered := len(w.buf)
+	w.buf = append(w.buf, p...)
+
+	flushed := 0
+	for len(w.buf) >= w.batchSize {
+		n, err := w.flush(w.batchSize)
+		flushed += n
+
+		if err != nil {
+			w.err = err
+
+			if flushed < buffered {
+				return 0, err
+			}
+
+			return flushed - buffered, err
+		}
+	}
+
+	return len(p), nil
+}
+
+// Flushes the buffered content to the upload and closes the writer.
+//
+// After the writer is closed, the upload can be committed using the token
+// returned by [UploadWriter.Token].
+func (w *UploadWriter) Close() error {
+	if w.closed {
+		return w.err
+	}
+
+	w.closed = true
+
+	if w.err != nil {
+		return w.err
+	}
+
+	_, w.err = w.flush(len(w.buf))
+
+	return w.err
+}
+
+// Discards the upload and closes the writer.
+func (w *UploadWriter) Abort() error {
+	w.closed = true
+	w.buf = nil
+
+	if w.err == nil {
+		w.err = errors.New("upload writer aborted")
+	}
+
+	return w.store.AbortUpload(w.token)
+}
+
+// Returns the token for commiting the upload on a transaction.
+//
+// The upload is only complete after the writer has been closed successfully.
+func (w *UploadWriter) Token() UploadToken {
+	return w.token
+}
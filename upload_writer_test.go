@@ -0,0 +1,129 @@
+package blobs
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+)
+
+func TestUploadWriter(t *testing.T) {
+	store := createTestStore(WithChunkSize(10), WithChunksPerTransaction(3))
+
+	commit := func(t *testing.T, w *UploadWriter) *Blob {
+		id, err := transact(store.db, func(tr fdb.Transaction) (Id, error) {
+			return store.CommitUpload(tr, w.Token())
+		})
+		assert.NoError(t, err)
+
+		blob, err := store.Blob(id)
+		assert.NoError(t, err)
+
+		return blob
+	}
+
+	t.Run("uploads the content written to it", func(t *testing.T) {
+		lengths := []int{0, 10, 29, 30, 31, 200}
+
+		for _, length := range lengths {
+			input := make([]byte, length)
+			_, err := rand.Read(input)
+			assert.NoError(t, err)
+
+			w, err := store.NewUploadWriter()
+			assert.NoError(t, err)
+
+			_, err = io.Copy(w, io.LimitReader(bytes.NewReader(input), int64(length)))
+			assert.NoError(t, err)
+
+			err = w.Close()
+			assert.NoError(t, err)
+
+			blob := commit(t, w)
+
+			data, err := io.ReadAll(blob.Reader())
+			assert.NoError(t, err)
+			assert.Equal(t, input, data, "length: %d", length)
+		}
+	})
+
+	t.Run("supports many small writes", func(t *testing.T) {
+		w, err := store.NewUploadWriter(WithContentType("application/json"))
+		assert.NoError(t, err)
+
+		encoder := json.NewEncoder(w)
+		for i := 0; i < 20; i++ {
+			err := encoder.Encode(map[string]int{"i": i})
+			assert.NoError(t, err)
+		}
+
+		err = w.Close()
+		assert.NoError(t, err)
+
+		blob := commit(t, w)
+
+		decoder := json.NewDecoder(blob.Reader())
+		for i := 0; i < 20; i++ {
+			var value map[string]int
+			err := decoder.Decode(&value)
+			assert.NoError(t, err)
+			assert.Equal(t, i, value["i"])
+		}
+
+		metadata, err := blob.Metadata()
+		assert.NoError(t, err)
+		assert.Equal(t, "application/json", metadata.ContentType)
+	})
+
+	t.Run("rejects writes after it is closed", func(t *testing.T) {
+		w, err := store.NewUploadWriter()
+		assert.NoError(t, err)
+
+		err = w.Close()
+		assert.NoError(t, err)
+
+		_, err = w.Write([]byte("content"))
+		assert.EqualError(t, err, "write to closed upload writer")
+	})
+
+	t.Run("returns the number of bytes committed when a transaction fails", func(t *testing.T) {
+		store := createTestStore(WithChunkSize(10), WithChunksPerTransaction(3), WithQuota(75))
+
+		w, err := store.NewUploadWriter()
+		assert.NoError(t, err)
+
+		n, err := w.Write(make([]byte, 20))
+		assert.NoError(t, err)
+		assert.Equal(t, 20, n)
+
+		n, err = w.Write(make([]byte, 100))
+		assert.True(t, errors.Is(err, QuotaExceededError))
+		assert.Equal(t, 40, n)
+
+		length, err := store.UploadLen(w.Token())
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(60), length)
+	})
+
+	t.Run("discards the upload when it is aborted", func(t *testing.T) {
+		w, err := store.NewUploadWriter()
+		assert.NoError(t, err)
+
+		_, err = w.Write(make([]byte, 100))
+		assert.NoError(t, err)
+
+		err = w.Abort()
+		assert.NoError(t, err)
+
+		text, err := w.Token().MarshalText()
+		assert.NoError(t, err)
+
+		_, err = store.ParseUploadToken(text)
+		assert.True(t, errors.Is(err, UploadNotFoundError))
+	})
+}
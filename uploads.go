@@ -1,7 +1,12 @@
 package blobs
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding"
 	"errors"
+	"fmt"
+	"hash"
 	"io"
 	"time"
 
@@ -9,55 +14,273 @@ import (
 	"github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
 )
 
-func (store *Store) write(blobDir subspace.Subspace, r io.Reader) error {
-	chunk := make([]byte, store.chunkSize)
+var invalidUploadTokenError = errors.New("invalid upload token, tokens needs to be produced by the upload method")
+
+// Checks that the upload with the given id is still pending.
+//
+// The content of a directory stays at the same prefix when it is moved, so
+// tokens of committed uploads still points at the content of the blob.
+func (store *Store) checkUploadExists(rt fdb.ReadTransactor, id Id) error {
+	exists, err := store.uploadsDir.Exists(rt, []string{string(id)})
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return fmt.Errorf("%w: %q", UploadNotFoundError, id)
+	}
+
+	return nil
+}
+
+// Appends the content of the reader r to the upload or committed blob in the
+// given directory and returns its length.
+//
+// The content is read in batches of chunks per transaction chunks before each
+// transaction, so transactions can be retried. If the last chunk is partial, it
+// is rewritten with the new content appended.
+//
+// The checksum is updated with each batch. Blobs without a digest state, stored
+// before content could be appended, loses their checksum.
+//
+// The digest state holds the content of the last partial block of the digest,
+// so it is sealed with the data key of encrypted blobs.
+func (store *Store) append(ctx context.Context, id Id, dir subspace.Subspace, r io.Reader, committed bool) (uint64, error) {
+	var enc chunkEncoding
 	var written uint64
-	var chunkIndex int
+	var tail []byte
+	var digest hash.Hash
+
+	checkExists := store.checkUploadExists
+	conflictError := fmt.Errorf("%w: concurrent append to upload %q", UploadConflictError, id)
+	if committed {
+		checkExists = store.checkBlobModifiable
+		conflictError = fmt.Errorf("%w: concurrent modification of blob %q", BlobConflictError, id)
+	}
+
+	err := ctx.Err()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = readTransact(store.db, func(tr fdb.ReadTransaction) (any, error) {
+		err := checkExists(tr, id)
+		if err != nil {
+			return nil, err
+		}
+
+		lenFuture := tr.Get(dir.Sub("len"))
+		digestStateFuture := tr.Get(dir.Sub("digestState"))
+
+		data, err := lenFuture.Get()
+		if err != nil {
+			return nil, err
+		}
+		written = decodeUInt64(data)
+
+		enc, err = store.readChunkEncoding(tr, dir)
+		if err != nil {
+			return nil, err
+		}
 
-	bytesSpace := blobDir.Sub("bytes")
+		digestState, err := digestStateFuture.Get()
+		if err != nil {
+			return nil, err
+		}
+
+		digestState, err = enc.openValue(id, "digestState", digestState)
+		if err != nil {
+			return nil, err
+		}
+
+		digest = nil
+		if digestState != nil {
+			digest = sha256.New()
+			err = digest.(encoding.BinaryUnmarshaler).UnmarshalBinary(digestState)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		tail = nil
+		if written%uint64(enc.chunkSize) != 0 {
+			tail, err = store.readChunk(tr, id, dir, enc, int64(written/uint64(enc.chunkSize)))
+		}
+
+		return nil, err
+	})
+
+	if err != nil {
+		return written, err
+	}
+
+	chunkSize := enc.chunkSize
+	chunkIndex := int64(written / uint64(chunkSize))
+	chunk := make([]byte, chunkSize)
+	filled := copy(chunk, tail)
+	stored := filled
 
 	for {
-		finished, err := transact(store.db, func(tr fdb.Transaction) (bool, error) {
-			for i := 0; i < store.chunksPerTransaction; i++ {
-				n, err := io.ReadFull(r, chunk)
+		var batch [][]byte
+		var readErr error
+		eof := false
 
-				tr.Set(bytesSpace.Sub(chunkIndex), chunk[0:n])
+		for len(batch) < store.chunksPerTransaction {
+			n, err := io.ReadFull(r, chunk[filled:])
+			filled += n
 
-				chunkIndex++
-				written += uint64(n)
+			if err == io.ErrUnexpectedEOF || err == io.EOF {
+				eof = true
+				break
+			}
 
-				if err == io.ErrUnexpectedEOF || err == io.EOF {
-					return true, nil
-				}
+			if err != nil {
+				// Commit the chunks read so far before failing
+				readErr = err
+				break
+			}
+
+			if digest != nil {
+				digest.Write(chunk[stored:])
+			}
+			batch = append(batch, append([]byte(nil), chunk...))
+			filled = 0
+			stored = 0
+		}
 
+		if eof && stored < filled {
+			if digest != nil {
+				digest.Write(chunk[stored:filled])
+			}
+			batch = append(batch, append([]byte(nil), chunk[:filled]...))
+		}
+
+		if len(batch) == 0 {
+			return written, readErr
+		}
+
+		newWritten := uint64(chunkIndex) * uint64(chunkSize)
+		for _, c := range batch {
+			newWritten += uint64(len(c))
+		}
+
+		var digestState, checksum []byte
+		if digest != nil {
+			digestState, err = digest.(encoding.BinaryMarshaler).MarshalBinary()
+			if err != nil {
+				return written, err
+			}
+			checksum = digest.Sum(nil)
+		}
+
+		err = ctx.Err()
+		if err != nil {
+			return written, err
+		}
+
+		err = updateTransact(store.db, func(tr fdb.Transaction) error {
+			err := checkExists(tr, id)
+			if err != nil {
+				return err
+			}
+
+			data, err := tr.Get(dir.Sub("len")).Get()
+			if err != nil {
+				return err
+			}
+
+			if decodeUInt64(data) != written {
+				return conflictError
+			}
+
+			delta := int64(newWritten - written)
+
+			err = store.checkQuota(tr, delta)
+			if err != nil {
+				return err
+			}
+
+			usageCounter := uploadBytesCounter
+			if committed {
+				usageCounter = bytesCounter
+			}
+			store.addUsage(tr, usageCounter, delta)
+
+			for i, c := range batch {
+				err := store.writeChunk(tr, dir, enc, chunkIndex+int64(i), c)
 				if err != nil {
-					return false, err
+					return err
 				}
 			}
 
-			return false, nil
+			tr.Set(dir.Sub("len"), encodeUInt64(newWritten))
+
+			if committed {
+				tr.Set(dir.Sub("modifiedAt"), encodeUInt64(uint64(store.systemTime.Now().Unix())))
+				setCommittedVersion(tr, dir)
+			}
+
+			if digest != nil {
+				tr.Set(dir.Sub("digestState"), enc.sealValue("digestState", digestState))
+			}
+
+			if checksum != nil {
+				tr.Set(dir.Sub("checksum"), enc.sealValue("checksum", checksum))
+			} else {
+				tr.Clear(dir.Sub("checksum"))
+			}
+
+			return nil
 		})
 
-		if finished {
-			break
+		if err != nil {
+			return written, err
 		}
 
-		if err != nil {
-			return err
+		written = newWritten
+		chunkIndex += int64(len(batch))
+
+		if eof || readErr != nil {
+			return written, readErr
 		}
 	}
+}
 
-	return updateTransact(store.db, func(tr fdb.Transaction) error {
-		tr.Set(blobDir.Sub("len"), encodeUInt64(written))
-		tr.Set(blobDir.Sub("chunkSize"), encodeUInt64(uint64(store.chunkSize)))
-		return nil
-	})
+// Starts a new upload and returns a token for appending content to the upload
+// and commiting it on a transaction later.
+//
+// Metadata can be attached to the blob using upload options.
+//
+// The token can be serialized using [UploadToken.MarshalText] and restored with
+// [Store.ParseUploadToken], allowing the upload to be resumed from any process.
+func (store *Store) StartUpload(opts ...UploadOption) (UploadToken, error) {
+	options, err := newUploadOptions(opts)
+	if err != nil {
+		return UploadToken{}, err
+	}
+
+	return store.startUpload(store.idGenerator.NextId(), store.chunkSize, options.metadata)
 }
 
-// Uploads the content of the given reader r into a temporary location and
-// returns a token for commiting the upload on a transaction later.
-func (store *Store) Upload(r io.Reader) (UploadToken, error) {
-	id := store.idGenerator.NextId()
+// Starts an upload with the given id, storing its content in chunks of the
+// given size.
+func (store *Store) startUpload(id Id, chunkSize int, metadata Metadata) (UploadToken, error) {
+	var enc chunkEncoding
+	var keyId string
+	var wrappedKey []byte
+	var err error
+	if store.keyProvider != nil {
+		enc.aead, keyId, wrappedKey, err = newDataKey(store.keyProvider)
+		if err != nil {
+			return UploadToken{}, err
+		}
+	}
+
+	digest := sha256.New()
+	digestState, err := digest.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return UploadToken{}, err
+	}
 
 	uploadDir, err := store.uploadsDir.Create(store.db, []string{string(id)}, nil)
 
@@ -70,14 +293,117 @@ func (store *Store) Upload(r io.Reader) (UploadToken, error) {
 	err = updateTransact(store.db, func(tr fdb.Transaction) error {
 		unixTimestamp := store.systemTime.Now().Unix()
 		tr.Set(uploadDir.Sub("uploadStartedAt"), encodeUInt64(uint64(unixTimestamp)))
+		store.addToCleanupIndex(tr, uploadsIndex, unixTimestamp, id)
+		indexEntry(tr, store.uploadsDir, uploadDir, string(id))
+		tr.Set(uploadDir.Sub("len"), encodeUInt64(0))
+		tr.Set(uploadDir.Sub("digestState"), enc.sealValue("digestState", digestState))
+		tr.Set(uploadDir.Sub("checksum"), enc.sealValue("checksum", digest.Sum(nil)))
+		store.writeChunkEncoding(tr, uploadDir, chunkSize, keyId, wrappedKey)
+		writeMetadata(tr, uploadDir, metadata)
 		return nil
 	})
 
+	return token, err
+}
+
+// Appends the content of the given reader r to the upload with the given token
+// and returns the number of bytes uploaded so far.
+//
+// The content is committed in batches of chunks per transaction chunks. If the
+// append fails, the number of bytes committed can be retrieved with
+// [Store.UploadLen] and the upload resumed from there.
+func (store *Store) AppendUpload(token UploadToken, r io.Reader) (uint64, error) {
+	return store.AppendUploadContext(context.Background(), token, r)
+}
+
+// Like [Store.AppendUpload], but stops appending with the error of the context
+// when it is done. The context is checked before each transaction, the content
+// committed before that is kept, so the upload can be resumed.
+func (store *Store) AppendUploadContext(ctx context.Context, token UploadToken, r io.Reader) (uint64, error) {
+	if token.dir == nil {
+		return 0, invalidUploadTokenError
+	}
+
+	return store.append(ctx, token.id(), token.dir, r, false)
+}
+
+// Returns the number of bytes committed to the upload with the given token.
+func (store *Store) UploadLen(token UploadToken) (uint64, error) {
+	if token.dir == nil {
+		return 0, invalidUploadTokenError
+	}
+
+	return readTransact(store.db, func(tr fdb.ReadTransaction) (uint64, error) {
+		err := store.checkUploadExists(tr, token.id())
+		if err != nil {
+			return 0, err
+		}
+
+		data, err := tr.Get(token.dir.Sub("len")).Get()
+		if err != nil {
+			return 0, err
+		}
+
+		return decodeUInt64(data), nil
+	})
+}
+
+// Returns the upload token serialized as text.
+func (token UploadToken) MarshalText() ([]byte, error) {
+	if token.dir == nil {
+		return nil, invalidUploadTokenError
+	}
+
+	return []byte(token.id()), nil
+}
+
+func (token UploadToken) id() Id {
+	path := token.dir.GetPath()
+	return Id(path[len(path)-1])
+}
+
+// Parses an upload token serialized with [UploadToken.MarshalText].
+//
+// Returns an [UploadNotFoundError] if the upload doesn't exist, because it has
+// been committed or deleted.
+func (store *Store) ParseUploadToken(text []byte) (UploadToken, error) {
+	uploadDir, err := store.uploadsDir.Open(store.db, []string{string(text)}, nil)
+
+	if err != nil {
+		return UploadToken{}, fmt.Errorf("%w: %q", UploadNotFoundError, text)
+	}
+
+	return UploadToken{dir: uploadDir}, nil
+}
+
+// Uploads the content of the given reader r into a temporary location and
+// returns a token for commiting the upload on a transaction later.
+//
+// Metadata can be attached to the blob using upload options.
+func (store *Store) Upload(r io.Reader, opts ...UploadOption) (UploadToken, error) {
+	return store.UploadContext(context.Background(), r, opts...)
+}
+
+// Like [Store.Upload], but stops uploading with the error of the context when it
+// is done. The partial upload is deleted when the context is done.
+func (store *Store) UploadContext(ctx context.Context, r io.Reader, opts ...UploadOption) (UploadToken, error) {
+	err := ctx.Err()
+	if err != nil {
+		return UploadToken{}, err
+	}
+
+	token, err := store.StartUpload(opts...)
+
 	if err != nil {
 		return token, err
 	}
 
-	err = store.write(uploadDir, r)
+	_, err = store.AppendUploadContext(ctx, token, r)
+
+	if err != nil && (ctx.Err() != nil || errors.Is(err, QuotaExceededError) || errors.Is(err, ChunkTooLargeError)) {
+		// The upload can't be resumed
+		err = store.abortFailedUpload(token, err)
+	}
 
 	return token, err
 }
@@ -86,67 +412,114 @@ func (store *Store) Upload(r io.Reader) (UploadToken, error) {
 // from the upload and returns its id.
 func (store *Store) CommitUpload(tr fdb.Transaction, token UploadToken) (Id, error) {
 	if token.dir == nil {
-		return "", errors.New("invalid upload token, tokens needs to be produced by the upload method")
+		return "", invalidUploadTokenError
 	}
 
 	uploadDir := token.dir
-	uploadPath := uploadDir.GetPath()
-	id := uploadPath[len(uploadPath)-1]
+	id := token.id()
+
+	err := store.removeFromCleanupIndex(tr, uploadsIndex, uploadDir, "uploadStartedAt", id)
+
+	if err != nil {
+		return id, err
+	}
+
+	tr.Clear(uploadDir.Sub("uploadStartedAt"))
 
-	dstPath := append(store.blobsDir.GetPath(), id)
-	blobDir, err := uploadDir.MoveTo(tr, dstPath)
+	length, err := readLen(tr, uploadDir)
 
 	if err != nil {
-		return Id(id), err
+		return id, err
+	}
+
+	blobDir, err := moveEntry(tr, store.uploadsDir, uploadDir, store.blobsDir, string(id))
+
+	if err != nil {
+		return id, err
 	}
 
 	unixTimestamp := store.systemTime.Now().Unix()
 	tr.Set(blobDir.Sub("createdAt"), encodeUInt64(uint64(unixTimestamp)))
+	setCommittedVersion(tr, blobDir)
+
+	store.addUsage(tr, uploadBytesCounter, -length)
+	store.addUsage(tr, bytesCounter, length)
+	store.addUsage(tr, blobsCounter, 1)
 
-	return Id(id), nil
+	return id, nil
 }
 
-// Deletes uploads that was started before a given time.
+// Aborts the upload with the given token, deleting the content uploaded so far.
 //
-// This is useful to make a periodical cleaning job.
-func (store *Store) DeleteUploadsStartedBefore(date time.Time) ([]Id, error) {
-	var deletedIds []Id
-	err := updateTransact(store.db, func(tr fdb.Transaction) error {
-		ids, err := store.uploadsDir.List(tr, []string{})
+// The references of uploads to content addressed chunks are released at most
+// chunks per transaction at a time. Uploads referencing more chunks are moved
+// out of the uploads, and their chunks are released across multiple
+// transactions like the chunks of deleted blobs.
+func (store *Store) AbortUpload(token UploadToken) error {
+	if token.dir == nil {
+		return invalidUploadTokenError
+	}
 
-		if err != nil {
-			return err
-		}
+	releasing, err := transact(store.db, func(tr fdb.Transaction) (bool, error) {
+		return store.abortUploadTx(tr, token)
+	})
 
-		for _, id := range ids {
-			uploadDir, err := store.uploadsDir.Open(tr, []string{id}, nil)
+	if err != nil || !releasing {
+		return err
+	}
 
-			if err != nil {
-				return err
-			}
+	// A release that fails is continued by the next cleanup
+	return store.releaseDeletedChunks(context.Background())
+}
 
-			data, err := tr.Get(uploadDir.Sub("uploadStartedAt")).Get()
+// Deletes the upload with the given token on the transaction. Returns true if
+// the upload was moved to have its chunks released by
+// [Store.releaseDeletedChunks].
+func (store *Store) abortUploadTx(tr fdb.Transaction, token UploadToken) (bool, error) {
+	id := token.id()
 
-			if err != nil {
-				return err
-			}
+	err := store.checkUploadExists(tr, id)
+	if err != nil {
+		return false, err
+	}
 
-			uploadStartedAt := time.Unix(int64(decodeUInt64(data)), 0)
+	err = store.removeFromCleanupIndex(tr, uploadsIndex, token.dir, "uploadStartedAt", id)
+	if err != nil {
+		return false, err
+	}
 
-			if uploadStartedAt.Before(date) {
-				deleted, err := store.uploadsDir.Remove(tr, []string{id})
-				if err != nil {
-					return err
-				}
+	length, err := readLen(tr, token.dir)
+	if err != nil {
+		return false, err
+	}
+	store.addUsage(tr, uploadBytesCounter, -length)
 
-				if deleted {
-					deletedIds = append(deletedIds, Id(id))
-				}
-			}
-		}
+	return store.deleteEntry(tr, store.uploadsDir, token.dir, id)
+}
 
-		return nil
-	})
+// Aborts the upload with the given token after it failed with err, and returns
+// err along with the error of aborting the upload, if any.
+func (store *Store) abortFailedUpload(token UploadToken, err error) error {
+	abortErr := store.AbortUpload(token)
+	if abortErr != nil {
+		return fmt.Errorf("%w, and the upload couldn't be aborted: %w", err, abortErr)
+	}
+
+	return err
+}
+
+// Deletes uploads that was started before a given time.
+//
+// This is useful to make a periodical cleaning job.
+//
+// Like [Store.DeleteRemovedBlobsBefore], only the expired uploads are read and
+// they are deleted in batches across multiple transactions.
+func (store *Store) DeleteUploadsStartedBefore(date time.Time, opts ...CleanupOption) ([]Id, error) {
+	return store.DeleteUploadsStartedBeforeContext(context.Background(), date, opts...)
+}
 
-	return deletedIds, err
+// Like [Store.DeleteUploadsStartedBefore], but returns the error of the context
+// if it is done. Batches deleted before the context was done stay deleted.
+func (store *Store) DeleteUploadsStartedBeforeContext(ctx context.Context, date time.Time, opts ...CleanupOption) ([]Id, error) {
+	return store.deleteExpired(ctx, uploadsIndex, store.uploadsDir, uploadBytesCounter, date, opts)
 }
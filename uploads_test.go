@@ -1,6 +1,10 @@
 package blobs
 
 import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -67,6 +71,37 @@ func TestUploadCommit(t *testing.T) {
 	})
 }
 
+func TestAbortUpload(t *testing.T) {
+	t.Run("releases the chunks of large uploads across transactions", func(t *testing.T) {
+		store := createTestStore(WithChunkSize(2), WithChunksPerTransaction(3), WithDeduplication())
+
+		kept, err := store.Create(strings.NewReader("01"))
+		assert.NoError(t, err)
+
+		token, err := store.Upload(strings.NewReader("0123456789abcdefghijklmnopqrstuvwxyz"))
+		assert.NoError(t, err)
+
+		err = store.AbortUpload(token)
+		assert.NoError(t, err)
+
+		_, err = store.UploadLen(token)
+		assert.True(t, errors.Is(err, UploadNotFoundError))
+
+		refs, err := readTransact(store.db, func(tr fdb.ReadTransaction) ([]fdb.KeyValue, error) {
+			return tr.GetRange(store.chunksDir.Sub("refs"), fdb.RangeOptions{}).GetSliceWithError()
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(refs))
+		assert.Equal(t, uint64(1), decodeUInt64(refs[0].Value))
+
+		usage, err := store.Usage()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), usage.UploadBytes)
+
+		assert.Equal(t, "01", readBlob(t, store, kept.Id()))
+	})
+}
+
 func TestDeleteUploadsStartedBefore(t *testing.T) {
 	date, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
 
@@ -97,3 +132,145 @@ func TestDeleteUploadsStartedBefore(t *testing.T) {
 		assert.Equal(t, 5, len(deleted), "Pending upload that was deleted")
 	})
 }
+
+func TestResumableUpload(t *testing.T) {
+	appendParts := func(t *testing.T, store *Store, token UploadToken, input []byte, partSizes []int) {
+		offset := 0
+		for _, size := range partSizes {
+			end := offset + size
+			if end > len(input) {
+				end = len(input)
+			}
+
+			n, err := store.AppendUpload(token, bytes.NewReader(input[offset:end]))
+			assert.NoError(t, err)
+			assert.Equal(t, uint64(end), n)
+
+			offset = end
+		}
+	}
+
+	commitAndRead := func(t *testing.T, store *Store, token UploadToken) *Blob {
+		id, err := transact(store.db, func(tr fdb.Transaction) (Id, error) {
+			return store.CommitUpload(tr, token)
+		})
+		assert.NoError(t, err)
+
+		blob, err := store.Blob(id)
+		assert.NoError(t, err)
+
+		return blob
+	}
+
+	t.Run("supports appending parts of any size", func(t *testing.T) {
+		store := createTestStore(WithChunkSize(10), WithChunksPerTransaction(2))
+
+		input := make([]byte, 200)
+		_, err := rand.Read(input)
+		assert.NoError(t, err)
+
+		token, err := store.StartUpload()
+		assert.NoError(t, err)
+
+		appendParts(t, store, token, input, []int{0, 3, 7, 10, 15, 1, 64, 100})
+
+		uploaded, err := store.UploadLen(token)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(200), uploaded)
+
+		blob := commitAndRead(t, store, token)
+
+		data, err := io.ReadAll(blob.Reader())
+		assert.NoError(t, err)
+		assert.Equal(t, input, data)
+
+		checksum, err := blob.Checksum()
+		assert.NoError(t, err)
+		want := sha256.Sum256(input)
+		assert.Equal(t, want[:], checksum)
+	})
+
+	t.Run("supports appending parts with compression, encryption and deduplication", func(t *testing.T) {
+		keyProvider := &AESKeyProvider{
+			Keys:         map[string][]byte{"key": make([]byte, 32)},
+			CurrentKeyId: "key",
+		}
+
+		store := createTestStore(
+			WithChunkSize(10),
+			WithCompression(GzipCodec{}),
+			WithEncryption(keyProvider),
+			WithDeduplication(),
+		)
+
+		input := make([]byte, 95)
+		_, err := rand.Read(input)
+		assert.NoError(t, err)
+
+		token, err := store.StartUpload()
+		assert.NoError(t, err)
+
+		appendParts(t, store, token, input, []int{5, 5, 13, 72})
+
+		blob := commitAndRead(t, store, token)
+
+		data, err := io.ReadAll(blob.Reader())
+		assert.NoError(t, err)
+		assert.Equal(t, input, data)
+	})
+
+	t.Run("can be resumed from another process using a serialized token", func(t *testing.T) {
+		db := fdbConnect()
+		ns := testNamespace()
+
+		store, err := NewStore(db, ns, WithChunkSize(10))
+		assert.NoError(t, err)
+
+		token, err := store.StartUpload(WithFilename("resumed.txt"))
+		assert.NoError(t, err)
+
+		_, err = store.AppendUpload(token, strings.NewReader("Hello, "))
+		assert.NoError(t, err)
+
+		text, err := token.MarshalText()
+		assert.NoError(t, err)
+
+		other, err := NewStore(db, ns)
+		assert.NoError(t, err)
+
+		resumed, err := other.ParseUploadToken(text)
+		assert.NoError(t, err)
+
+		_, err = other.AppendUpload(resumed, strings.NewReader("world!"))
+		assert.NoError(t, err)
+
+		blob := commitAndRead(t, other, resumed)
+
+		data, err := io.ReadAll(blob.Reader())
+		assert.NoError(t, err)
+		assert.Equal(t, "Hello, world!", string(data))
+
+		metadata, err := blob.Metadata()
+		assert.NoError(t, err)
+		assert.Equal(t, "resumed.txt", metadata.Filename)
+	})
+
+	t.Run("returns an error when parsing tokens for unknown uploads", func(t *testing.T) {
+		store := createTestStore()
+
+		_, err := store.ParseUploadToken([]byte("missing"))
+		assert.True(t, errors.Is(err, UploadNotFoundError))
+	})
+
+	t.Run("returns an error when appending to a committed upload", func(t *testing.T) {
+		store := createTestStore()
+
+		token, err := store.Upload(strings.NewReader("content"))
+		assert.NoError(t, err)
+
+		commitAndRead(t, store, token)
+
+		_, err = store.AppendUpload(token, strings.NewReader("more"))
+		assert.True(t, errors.Is(err, UploadNotFoundError))
+	})
+}
@@ -0,0 +1,199 @@
+package blobs
+
+import (
+	"fmt"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
+)
+
+// The number of blobs read per transaction when recomputing the usage.
+const usageBatchSize = 100
+
+// Names of the usage counters.
+const (
+	bytesCounter        = "bytes"
+	blobsCounter        = "blobs"
+	uploadBytesCounter  = "uploadBytes"
+	removedBytesCounter = "removedBytes"
+)
+
+// The usage of a store.
+//
+// Lengths are the length of the content, not the space taken up by the stored
+// chunks after deduplication and compression.
+type Usage struct {
+	// The total length of the blobs.
+	Bytes int64
+	// The number of blobs.
+	Blobs int64
+	// The total length of the content uploaded to pending uploads.
+	UploadBytes int64
+	// The total length of the removed blobs that are not deleted yet.
+	RemovedBytes int64
+}
+
+// The total length of the content held by the store.
+func (usage Usage) TotalBytes() int64 {
+	return usage.Bytes + usage.UploadBytes + usage.RemovedBytes
+}
+
+// Adds the delta to a usage counter using an atomic add, so concurrent updates
+// doesn't conflict.
+func (store *Store) addUsage(tr fdb.Transaction, counter string, delta int64) {
+	if delta != 0 {
+		tr.Add(store.usageDir.Sub(counter), encodeUInt64(uint64(delta)))
+	}
+}
+
+// Reads the length stored in the given blob or upload directory.
+func readLen(tr fdb.ReadTransaction, dir subspace.Subspace) (int64, error) {
+	data, err := tr.Get(dir.Sub("len")).Get()
+	if err != nil || data == nil {
+		return 0, err
+	}
+
+	return int64(decodeUInt64(data)), nil
+}
+
+func (store *Store) usageTx(tr fdb.ReadTransaction) (Usage, error) {
+	var usage Usage
+
+	counters := map[string]*int64{
+		bytesCounter:        &usage.Bytes,
+		blobsCounter:        &usage.Blobs,
+		uploadBytesCounter:  &usage.UploadBytes,
+		removedBytesCounter: &usage.RemovedBytes,
+	}
+
+	futures := map[string]fdb.FutureByteSlice{}
+	for counter := range counters {
+		futures[counter] = tr.Get(store.usageDir.Sub(counter))
+	}
+
+	for counter, value := range counters {
+		data, err := futures[counter].Get()
+		if err != nil {
+			return usage, err
+		}
+
+		if data != nil {
+			*value = int64(decodeUInt64(data))
+		}
+	}
+
+	return usage, nil
+}
+
+// Returns the usage of the store.
+//
+// The usage is maintained with atomic counters as blobs are uploaded, removed
+// and deleted. Stores containing blobs from before the usage was tracked needs
+// to initialize the counters using [Store.RecomputeUsage].
+func (store *Store) Usage() (Usage, error) {
+	return readTransact(store.db, store.usageTx)
+}
+
+// Checks that adding delta bytes to the store doesn't exceed the quota.
+//
+// The counters are read as a snapshot, so concurrent uploads doesn't conflict.
+// Concurrent uploads can therefore exceed the quota by the content they upload
+// in a single transaction.
+func (store *Store) checkQuota(tr fdb.ReadTransaction, delta int64) error {
+	if store.quota == 0 || delta <= 0 {
+		return nil
+	}
+
+	usage, err := store.usageTx(tr.Snapshot())
+	if err != nil {
+		return err
+	}
+
+	if usage.TotalBytes()+delta > int64(store.quota) {
+		return fmt.Errorf("%w: %d bytes used of %d, can't add %d bytes", QuotaExceededError, usage.TotalBytes(), store.quota, delta)
+	}
+
+	return nil
+}
+
+// Recomputes the usage counters by reading the length of every blob, upload and
+// removed blob, and returns the usage.
+//
+// This is used to initialize the counters of stores containing blobs from
+// before the usage was tracked. The lengths are read in batches across multiple
+// transactions, so changes made while recomputing can make the counters drift.
+func (store *Store) RecomputeUsage() (Usage, error) {
+	var usage Usage
+
+	dirs := []struct {
+		dir   directory.DirectorySubspace
+		bytes *int64
+		count *int64
+	}{
+		{store.blobsDir, &usage.Bytes, &usage.Blobs},
+		{store.uploadsDir, &usage.UploadBytes, nil},
+		{store.removedDir, &usage.RemovedBytes, nil},
+	}
+
+	for _, d := range dirs {
+		options := &listOptions{limit: usageBatchSize}
+
+		for {
+			var bytes, count int64
+
+			cursor, err := readTransact(store.db, func(tr fdb.ReadTransaction) (string, error) {
+				bytes, count = 0, 0
+
+				_, subdirs, cursor, err := listPage(tr, d.dir, options)
+				if err != nil {
+					return "", err
+				}
+
+				lens := make([]fdb.FutureByteSlice, len(subdirs))
+				for i, subdir := range subdirs {
+					lens[i] = tr.Get(subdir.Sub("len"))
+				}
+
+				for _, future := range lens {
+					data, err := future.Get()
+					if err != nil {
+						return "", err
+					}
+
+					if data != nil {
+						bytes += int64(decodeUInt64(data))
+					}
+					count++
+				}
+
+				return cursor, nil
+			})
+
+			if err != nil {
+				return usage, err
+			}
+
+			*d.bytes += bytes
+			if d.count != nil {
+				*d.count += count
+			}
+
+			if cursor == "" {
+				break
+			}
+
+			options.cursor = cursor
+		}
+	}
+
+	err := updateTransact(store.db, func(tr fdb.Transaction) error {
+		tr.Set(store.usageDir.Sub(bytesCounter), encodeUInt64(uint64(usage.Bytes)))
+		tr.Set(store.usageDir.Sub(blobsCounter), encodeUInt64(uint64(usage.Blobs)))
+		tr.Set(store.usageDir.Sub(uploadBytesCounter), encodeUInt64(uint64(usage.UploadBytes)))
+		tr.Set(store.usageDir.Sub(removedBytesCounter), encodeUInt64(uint64(usage.RemovedBytes)))
+		return nil
+	})
+
+	return usage, err
+}
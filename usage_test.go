@@ -0,0 +1,104 @@
+package blobs
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+)
+
+func TestUsage(t *testing.T) {
+	store := createTestStore(WithChunkSize(10))
+
+	assertUsage := func(t *testing.T, want Usage) {
+		t.Helper()
+		usage, err := store.Usage()
+		assert.NoError(t, err)
+		assert.Equal(t, want, usage)
+	}
+
+	t.Run("tracks the usage through the blob lifecycle", func(t *testing.T) {
+		token, err := store.Upload(strings.NewReader("0123456789abcde"))
+		assert.NoError(t, err)
+		assertUsage(t, Usage{UploadBytes: 15})
+
+		id, err := transact(store.db, func(tr fdb.Transaction) (Id, error) {
+			return store.CommitUpload(tr, token)
+		})
+		assert.NoError(t, err)
+		assertUsage(t, Usage{Bytes: 15, Blobs: 1})
+
+		_, err = store.AppendBlob(id, strings.NewReader("fghij"))
+		assert.NoError(t, err)
+		assertUsage(t, Usage{Bytes: 20, Blobs: 1})
+
+		err = store.TruncateBlob(id, 12)
+		assert.NoError(t, err)
+		assertUsage(t, Usage{Bytes: 12, Blobs: 1})
+
+		err = store.RemoveBlob(id)
+		assert.NoError(t, err)
+		assertUsage(t, Usage{RemovedBytes: 12})
+
+		err = store.RestoreBlob(id)
+		assert.NoError(t, err)
+		assertUsage(t, Usage{Bytes: 12, Blobs: 1})
+
+		err = store.RemoveBlob(id)
+		assert.NoError(t, err)
+		_, err = store.DeleteRemovedBlobsBefore(time.Now().Add(time.Minute))
+		assert.NoError(t, err)
+		assertUsage(t, Usage{})
+
+		token, err = store.Upload(strings.NewReader("upload"))
+		assert.NoError(t, err)
+		err = store.AbortUpload(token)
+		assert.NoError(t, err)
+		assertUsage(t, Usage{})
+	})
+
+	t.Run("recomputes the usage", func(t *testing.T) {
+		_, err := store.Create(strings.NewReader("content"))
+		assert.NoError(t, err)
+
+		err = updateTransact(store.db, func(tr fdb.Transaction) error {
+			tr.ClearRange(store.usageDir)
+			return nil
+		})
+		assert.NoError(t, err)
+
+		usage, err := store.RecomputeUsage()
+		assert.NoError(t, err)
+		assert.Equal(t, Usage{Bytes: 7, Blobs: 1}, usage)
+		assertUsage(t, usage)
+	})
+}
+
+func TestQuota(t *testing.T) {
+	store := createTestStore(WithChunkSize(10), WithQuota(25))
+
+	t.Run("rejects uploads exceeding the quota", func(t *testing.T) {
+		blob, err := store.Create(strings.NewReader("0123456789"))
+		assert.NoError(t, err)
+
+		_, err = store.Create(strings.NewReader(strings.Repeat("x", 20)))
+		assert.True(t, errors.Is(err, QuotaExceededError))
+
+		_, err = store.AppendBlob(blob.Id(), strings.NewReader(strings.Repeat("x", 20)))
+		assert.True(t, errors.Is(err, QuotaExceededError))
+
+		_, err = store.CopyBlob(blob.Id())
+		assert.NoError(t, err)
+
+		_, err = store.CopyBlob(blob.Id())
+		assert.True(t, errors.Is(err, QuotaExceededError))
+	})
+
+	t.Run("rejects invalid quotas", func(t *testing.T) {
+		_, err := NewStore(store.db, testNamespace(), WithQuota(0))
+		assert.EqualError(t, err, "invalid quota, quota needs to be greater than zero")
+	})
+}
@@ -0,0 +1,917 @@
+package blobs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+)
+
+// The number of entries listed per transaction when verifying.
+const verifyBatchSize = 100
+
+// The number of times an entry modified while it is verified is verified again.
+const verifyAttempts = 3
+
+// The kind of a problem found by [Store.Verify].
+type ProblemKind string
+
+const (
+	// A key the entry needs is missing, like "len", "chunkSize" or
+	// "createdAt".
+	MissingKeyProblem ProblemKind = "missing key"
+	// The entry has chunks missing or chunks beyond its length.
+	ChunkCountProblem ProblemKind = "chunk count"
+	// A chunk is shorter than the length of the entry requires.
+	ShortChunkProblem ProblemKind = "short chunk"
+	// A chunk can't be decoded, doesn't match its checksum or is longer than
+	// the chunk size.
+	CorruptChunkProblem ProblemKind = "corrupt chunk"
+	// The entry holds a key that isn't part of the stored form of an entry.
+	StrayKeyProblem ProblemKind = "stray key"
+)
+
+// Names of the directories verified by [Store.Verify].
+const (
+	BlobsDir   = "blobs"
+	UploadsDir = "uploads"
+	RemovedDir = "removed"
+)
+
+// A problem found by [Store.Verify].
+type Problem struct {
+	// The directory of the entry with the problem, [BlobsDir], [UploadsDir]
+	// or [RemovedDir].
+	Dir string
+	// The id of the blob or upload with the problem.
+	Id   Id
+	Kind ProblemKind
+	// A description of the problem.
+	Description string
+	// If the problem was repaired, see [WithRepair].
+	Repaired bool
+
+	// The steps repairing the problem, each step changes a single key or
+	// chunk.
+	repairs []func(tr fdb.Transaction) error
+}
+
+func (problem Problem) String() string {
+	return fmt.Sprintf("%s %q: %s: %s", problem.Dir, problem.Id, problem.Kind, problem.Description)
+}
+
+// The report of verifying a store.
+type VerifyReport struct {
+	// The number of verified blobs.
+	Blobs int
+	// The number of verified uploads.
+	Uploads int
+	// The number of verified removed blobs.
+	RemovedBlobs int
+	// The entries that were modified on every attempt to verify them, these
+	// are not verified and not counted as verified.
+	Unverified []Id
+	// The problems found.
+	Problems []Problem
+}
+
+// Returns true if no problems were found, or all of them were repaired.
+func (report VerifyReport) OK() bool {
+	for _, problem := range report.Problems {
+		if !problem.Repaired {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Verify option type.
+type VerifyOption func(verify *verifyOptions) error
+
+type verifyOptions struct {
+	repair bool
+}
+
+// Repairs the problems that can be repaired without losing content.
+//
+// The repairs of an entry are done in batches of chunks per transaction keys,
+// and stop if the entry is modified in between. Stray keys and chunks beyond the
+// length are cleared. A missing length is
+// recomputed from the chunks when they are complete. A missing creation,
+// removal or upload start time is set to the time of the repair. Uploads with
+// missing, short or corrupt chunks are deleted, so they can be uploaded again.
+//
+// The usage counters are not updated for recomputed lengths, use
+// [Store.RecomputeUsage] after repairing to correct them.
+func WithRepair() VerifyOption {
+	return func(verify *verifyOptions) error {
+		verify.repair = true
+		return nil
+	}
+}
+
+// Walks every blob, upload and removed blob in the store and checks that it is
+// stored correctly, and returns a report of the problems found.
+//
+// The checks cover missing keys, chunk counts that doesn't match the length and
+// chunk size, chunks that are shorter than the length requires, chunks that
+// can't be decoded or doesn't match their checksums, and stray keys. Each entry
+// is verified in batches of chunks per transaction chunks. Entries that are
+// modified while they are verified are verified again, and entries that keep
+// being modified are reported as unverified.
+//
+// Problems are reported, not returned as errors, the error is only returned
+// when the store can't be read. Use [WithRepair] to repair the problems that
+// can be repaired.
+func (store *Store) Verify(opts ...VerifyOption) (VerifyReport, error) {
+	return store.VerifyContext(context.Background(), opts...)
+}
+
+// Like [Store.Verify], but stops verifying with the error of the context when
+// it is done. The report of the entries verified so far is returned with the
+// error.
+func (store *Store) VerifyContext(ctx context.Context, opts ...VerifyOption) (VerifyReport, error) {
+	var report VerifyReport
+
+	options := &verifyOptions{}
+
+	for _, opt := range opts {
+		err := opt(options)
+		if err != nil {
+			return report, err
+		}
+	}
+
+	dirs := []struct {
+		name  string
+		dir   directory.DirectorySubspace
+		count *int
+	}{
+		{BlobsDir, store.blobsDir, &report.Blobs},
+		{UploadsDir, store.uploadsDir, &report.Uploads},
+		{RemovedDir, store.removedDir, &report.RemovedBlobs},
+	}
+
+	for _, d := range dirs {
+		listOptions := &listOptions{limit: verifyBatchSize}
+
+		for {
+			err := ctx.Err()
+			if err != nil {
+				return report, err
+			}
+
+			var names []string
+
+			cursor, err := readTransact(store.db, func(tr fdb.ReadTransaction) (string, error) {
+				var cursor string
+				var err error
+
+				names, _, cursor, err = listPage(tr, d.dir, listOptions)
+
+				return cursor, err
+			})
+
+			if err != nil {
+				return report, err
+			}
+
+			for _, name := range names {
+				problems, result, err := store.verifyEntry(ctx, d.name, d.dir, Id(name), options)
+				if err != nil {
+					return report, err
+				}
+
+				switch result {
+				case entryVerified:
+					*d.count++
+					report.Problems = append(report.Problems, problems...)
+				case entryModified:
+					report.Unverified = append(report.Unverified, Id(name))
+				}
+			}
+
+			if cursor == "" {
+				break
+			}
+
+			listOptions.cursor = cursor
+		}
+	}
+
+	return report, nil
+}
+
+// A chunk of an entry as seen while verifying.
+type verifiedChunk struct {
+	// The stored key of the chunk.
+	key fdb.Key
+	// The hash of content addressed chunks.
+	hash []byte
+	// If the content of a content addressed chunk is missing.
+	missing bool
+	// If the chunk could be decoded.
+	decoded bool
+	// The length and checksum of the decoded content.
+	len      int64
+	checksum []byte
+}
+
+// The stored form of an entry as seen while verifying.
+type verifiedEntry struct {
+	name      string
+	id        Id
+	parent    directory.DirectorySubspace
+	dir       directory.DirectorySubspace
+	len       []byte
+	chunkSize []byte
+	// The values of the keys that change whenever the content is modified.
+	modified [][]byte
+	enc      chunkEncoding
+	encErr   error
+	// Timestamp keys required by the directory of the entry.
+	timestamps map[string][]byte
+	chunks     map[int64]*verifiedChunk
+	checksums  map[int64][]byte
+	problems   []Problem
+}
+
+// Adds a problem that is repaired by the given steps, or can't be repaired if
+// there are none.
+func (entry *verifiedEntry) addProblem(kind ProblemKind, repairs []func(tr fdb.Transaction) error, format string, args ...any) {
+	entry.problems = append(entry.problems, Problem{
+		Dir:         entry.name,
+		Id:          entry.id,
+		Kind:        kind,
+		Description: fmt.Sprintf(format, args...),
+		repairs:     repairs,
+	})
+}
+
+// Returns the timestamp keys the entries of the directory with the given name
+// needs.
+func timestampKeys(name string) []string {
+	switch name {
+	case UploadsDir:
+		return []string{"uploadStartedAt"}
+	case RemovedDir:
+		return []string{"createdAt", "deletedAt"}
+	default:
+		return []string{"createdAt"}
+	}
+}
+
+// The keys of the stored form of an entry apart from chunks, checksums,
+// attributes and timestamps.
+var entryKeys = map[string]bool{
+	"len":              true,
+	"chunkSize":        true,
+	"contentAddressed": true,
+	"codec":            true,
+	"keyId":            true,
+	"dataKey":          true,
+	"checksum":         true,
+	"digestState":      true,
+	"modifiedAt":       true,
+	"truncations":      true,
+	"version":          true,
+	"committedVersion": true,
+	"contentType":      true,
+	"filename":         true,
+}
+
+// The outcome of verifying an entry.
+type verifyResult int
+
+const (
+	entryVerified verifyResult = iota
+	// The entry was moved or deleted while it was verified.
+	entryGone
+	// The entry was modified on every attempt to verify it.
+	entryModified
+)
+
+// Verifies the entry with the given id, and repairs it if requested.
+func (store *Store) verifyEntry(ctx context.Context, name string, dir directory.DirectorySubspace, id Id, options *verifyOptions) ([]Problem, verifyResult, error) {
+	for attempt := 1; attempt <= verifyAttempts; attempt++ {
+		entry, err := store.readVerifiedEntry(ctx, name, dir, id)
+		if err != nil || entry == nil {
+			return nil, entryGone, err
+		}
+
+		store.checkEntry(entry)
+
+		// Entries modified while they are verified, are verified again
+		modified, err := readTransact(store.db, func(tr fdb.ReadTransaction) ([][]byte, error) {
+			return readModifiedKeys(tr, entry.dir)
+		})
+
+		if err != nil {
+			return nil, entryGone, err
+		}
+
+		if !equalValues(modified, entry.modified) {
+			continue
+		}
+
+		if options.repair && len(entry.problems) > 0 {
+			err = store.repairEntry(ctx, entry)
+			if err != nil {
+				return nil, entryGone, err
+			}
+		}
+
+		return entry.problems, entryVerified, nil
+	}
+
+	return nil, entryModified, nil
+}
+
+// Reads the stored form of an entry, returns nil if the entry doesn't exist.
+func (store *Store) readVerifiedEntry(ctx context.Context, name string, dir directory.DirectorySubspace, id Id) (*verifiedEntry, error) {
+	entry := &verifiedEntry{
+		name:       name,
+		id:         id,
+		parent:     dir,
+		timestamps: map[string][]byte{},
+		chunks:     map[int64]*verifiedChunk{},
+		checksums:  map[int64][]byte{},
+	}
+
+	found, err := readTransact(store.db, func(tr fdb.ReadTransaction) (bool, error) {
+		var err error
+
+		entry.dir, err = dir.Open(tr, []string{string(id)}, nil)
+		if errors.Is(err, directory.ErrDirNotExists) {
+			return false, nil
+		}
+
+		if err != nil {
+			return false, err
+		}
+
+		entry.modified, err = readModifiedKeys(tr, entry.dir)
+		if err != nil {
+			return false, err
+		}
+
+		lenFuture := tr.Get(entry.dir.Sub("len"))
+		chunkSizeFuture := tr.Get(entry.dir.Sub("chunkSize"))
+
+		timestamps := map[string]fdb.FutureByteSlice{}
+		for _, key := range timestampKeys(name) {
+			timestamps[key] = tr.Get(entry.dir.Sub(key))
+		}
+
+		entry.len, err = lenFuture.Get()
+		if err != nil {
+			return false, err
+		}
+
+		entry.chunkSize, err = chunkSizeFuture.Get()
+		if err != nil {
+			return false, err
+		}
+
+		for key, future := range timestamps {
+			entry.timestamps[key], err = future.Get()
+			if err != nil {
+				return false, err
+			}
+		}
+
+		entry.enc, entry.encErr = store.readChunkEncoding(tr, entry.dir)
+
+		return true, nil
+	})
+
+	if err != nil || !found {
+		return nil, err
+	}
+
+	begin, end := entry.dir.FDBRangeKeySelectors()
+	keyRange := fdb.SelectorRange{Begin: begin, End: end}
+
+	for {
+		err := ctx.Err()
+		if err != nil {
+			return nil, err
+		}
+
+		more, err := readTransact(store.db, func(tr fdb.ReadTransaction) (bool, error) {
+			entries, err := tr.GetRange(keyRange, fdb.RangeOptions{
+				Limit: store.chunksPerTransaction,
+			}).GetSliceWithError()
+
+			if err != nil || len(entries) == 0 {
+				return false, err
+			}
+
+			err = store.readVerifiedKeys(tr, entry, entries)
+			if err != nil {
+				return false, err
+			}
+
+			keyRange.Begin = fdb.FirstGreaterThan(entries[len(entries)-1].Key)
+
+			return len(entries) == store.chunksPerTransaction, nil
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !more {
+			return entry, nil
+		}
+	}
+}
+
+// Reads the values of the keys of the entry stored in the given directory that
+// change whenever its content is modified, see modifiedKeys.
+func readModifiedKeys(tr fdb.ReadTransaction, dir subspace.Subspace) ([][]byte, error) {
+	futures := make([]fdb.FutureByteSlice, len(modifiedKeys))
+	for i, key := range modifiedKeys {
+		futures[i] = tr.Get(dir.Sub(key))
+	}
+
+	values := make([][]byte, len(modifiedKeys))
+	for i, future := range futures {
+		var err error
+		values[i], err = future.Get()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return values, nil
+}
+
+func equalValues(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Classifies a batch of keys of an entry, decoding the chunks among them.
+func (store *Store) readVerifiedKeys(tr fdb.ReadTransaction, entry *verifiedEntry, entries []fdb.KeyValue) error {
+	chunksKey := "bytes"
+	if entry.enc.contentAddressed {
+		chunksKey = "hashes"
+	}
+
+	allowed := map[string]bool{}
+	for _, key := range timestampKeys(entry.name) {
+		allowed[key] = true
+	}
+
+	var chunkIndexes []int64
+	var payloads []fdb.FutureByteSlice
+
+	for _, kv := range entries {
+		t, err := entry.dir.Unpack(kv.Key)
+
+		var name string
+		var index int64
+		isIndexed := false
+
+		if err == nil && len(t) > 0 {
+			name, _ = t[0].(string)
+		}
+
+		if err == nil && len(t) == 2 {
+			index, isIndexed = t[1].(int64)
+		}
+
+		switch {
+		case err != nil:
+		case len(t) == 1 && (entryKeys[name] || allowed[name]):
+			continue
+		case len(t) == 2 && (name == "attributes" || name == "names"):
+			if _, ok := t[1].(string); ok {
+				continue
+			}
+		case isIndexed && name == chunksKey:
+			chunk := &verifiedChunk{key: kv.Key}
+			entry.chunks[index] = chunk
+
+			if entry.enc.contentAddressed {
+				chunk.hash = kv.Value
+				chunkIndexes = append(chunkIndexes, index)
+				payloads = append(payloads, tr.Get(store.chunksDir.Sub("data", kv.Value)))
+			} else {
+				entry.decodeChunk(chunk, index, kv.Value)
+			}
+			continue
+		case isIndexed && name == "checksums":
+			entry.checksums[index] = kv.Value
+			continue
+		}
+
+		key := kv.Key
+		var hash []byte
+		if isIndexed && name == "hashes" {
+			// Stray references to content addressed chunks are released
+			// like the references of deleted blobs
+			hash = kv.Value
+		}
+
+		entry.addProblem(StrayKeyProblem, []func(tr fdb.Transaction) error{func(tr fdb.Transaction) error {
+			tr.Clear(key)
+
+			if hash != nil {
+				return store.releaseChunk(tr, hash)
+			}
+
+			return nil
+		}}, "stray key %s", describeKey(entry.dir, kv.Key))
+	}
+
+	for i, future := range payloads {
+		payload, err := future.Get()
+		if err != nil {
+			return err
+		}
+
+		chunk := entry.chunks[chunkIndexes[i]]
+
+		if payload == nil {
+			chunk.missing = true
+		} else {
+			entry.decodeChunk(chunk, chunkIndexes[i], payload)
+		}
+	}
+
+	return nil
+}
+
+// Decodes the stored chunk with the given index, recording the length and
+// checksum of its content.
+func (entry *verifiedEntry) decodeChunk(chunk *verifiedChunk, index int64, payload []byte) {
+	if entry.encErr != nil {
+		return
+	}
+
+	chunks, err := entry.enc.decode(entry.id, index, [][]byte{payload})
+	if err != nil {
+		return
+	}
+
+	chunk.decoded = true
+	chunk.len = int64(len(chunks[0]))
+	chunk.checksum = entry.enc.storedChecksum(chunks[0], payload)
+}
+
+// Describes a key of the entry stored in the given directory.
+func describeKey(dir subspace.Subspace, key fdb.Key) string {
+	t, err := dir.Unpack(key)
+	if err != nil {
+		return fdb.Printable(key[len(dir.Bytes()):])
+	}
+
+	return fmt.Sprint([]tuple.TupleElement(t))
+}
+
+// Checks the stored form of an entry against its length and chunk size, adding
+// the problems found.
+func (store *Store) checkEntry(entry *verifiedEntry) {
+	dir := entry.dir
+
+	if entry.encErr != nil {
+		entry.addProblem(CorruptChunkProblem, nil, "can't read the chunk encoding: %v", entry.encErr)
+	}
+
+	for _, key := range timestampKeys(entry.name) {
+		if entry.timestamps[key] != nil {
+			continue
+		}
+
+		key := key
+		entry.addProblem(MissingKeyProblem, []func(tr fdb.Transaction) error{func(tr fdb.Transaction) error {
+			unixTimestamp := store.systemTime.Now().Unix()
+			tr.Set(dir.Sub(key), encodeUInt64(uint64(unixTimestamp)))
+
+			switch key {
+			case "deletedAt":
+				store.addToCleanupIndex(tr, removedIndex, unixTimestamp, entry.id)
+			case "uploadStartedAt":
+				store.addToCleanupIndex(tr, uploadsIndex, unixTimestamp, entry.id)
+			}
+
+			return nil
+		}}, "missing %q key", key)
+	}
+
+	indexes := make([]int64, 0, len(entry.chunks))
+	for index := range entry.chunks {
+		indexes = append(indexes, index)
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+
+	var chunkSize int64
+	if entry.chunkSize != nil {
+		chunkSize = int64(decodeUInt64(entry.chunkSize))
+	}
+
+	if chunkSize <= 0 {
+		entry.addProblem(MissingKeyProblem, nil, `missing "chunkSize" key`)
+	}
+
+	if entry.len == nil {
+		var repairs []func(tr fdb.Transaction) error
+
+		if length, ok := completeLen(entry, indexes, chunkSize); ok {
+			repairs = append(repairs, func(tr fdb.Transaction) error {
+				tr.Set(dir.Sub("len"), encodeUInt64(uint64(length)))
+				return nil
+			})
+		}
+
+		entry.addProblem(MissingKeyProblem, repairs, `missing "len" key`)
+	}
+
+	if chunkSize <= 0 {
+		return
+	}
+
+	// Without a length the chunks present defines the expected chunks
+	var length, expected int64
+	if entry.len != nil {
+		length = int64(decodeUInt64(entry.len))
+		expected = (length + chunkSize - 1) / chunkSize
+	} else if len(indexes) > 0 {
+		expected = indexes[len(indexes)-1] + 1
+	}
+
+	var missing, extra []int64
+
+	for index := int64(0); index < expected; index++ {
+		if entry.chunks[index] == nil {
+			missing = append(missing, index)
+		}
+	}
+
+	for _, index := range indexes {
+		chunk := entry.chunks[index]
+
+		if index >= expected {
+			if index == expected && chunk.decoded && chunk.len == 0 {
+				// Blobs stored by earlier versions end with an empty chunk
+				// when the length is a multiple of the chunk size
+				continue
+			}
+
+			extra = append(extra, index)
+			continue
+		}
+
+		if chunk.missing {
+			entry.addProblem(CorruptChunkProblem, nil, "chunk %d references missing content", index)
+			continue
+		}
+
+		if !chunk.decoded {
+			if entry.encErr == nil {
+				entry.addProblem(CorruptChunkProblem, nil, "chunk %d can't be decoded", index)
+			}
+			continue
+		}
+
+		want := chunkSize
+		if index == expected-1 && entry.len != nil {
+			want = length - index*chunkSize
+		}
+
+		if chunk.len > chunkSize || (chunk.len > want && entry.len != nil) {
+			entry.addProblem(CorruptChunkProblem, nil, "chunk %d is %d bytes, expected %d", index, chunk.len, want)
+		} else if chunk.len < want && (index < expected-1 || entry.len != nil) {
+			entry.addProblem(ShortChunkProblem, nil, "chunk %d is %d bytes, expected %d", index, chunk.len, want)
+		}
+
+		if checksum := entry.checksums[index]; checksum != nil && !bytes.Equal(checksum, chunk.checksum) {
+			entry.addProblem(CorruptChunkProblem, nil, "chunk %d doesn't match its checksum", index)
+		}
+	}
+
+	if len(missing) > 0 {
+		entry.addProblem(ChunkCountProblem, nil, "%d of %d chunks are missing, the first is chunk %d", len(missing), expected, missing[0])
+	}
+
+	if len(extra) > 0 {
+		repairs := make([]func(tr fdb.Transaction) error, 0, len(extra))
+
+		for _, index := range extra {
+			index := index
+			chunk := entry.chunks[index]
+
+			repairs = append(repairs, func(tr fdb.Transaction) error {
+				tr.Clear(chunk.key)
+				tr.Clear(dir.Sub("checksums", index))
+
+				if chunk.hash != nil {
+					return store.releaseChunk(tr, chunk.hash)
+				}
+
+				return nil
+			})
+		}
+
+		entry.addProblem(ChunkCountProblem, repairs, "%d chunks beyond the length, the first is chunk %d", len(extra), extra[0])
+	}
+
+	checksums := make([]int64, 0, len(entry.checksums))
+	for index := range entry.checksums {
+		// Checksums of missing chunks are covered by the missing chunks
+		if entry.chunks[index] == nil && index >= expected {
+			checksums = append(checksums, index)
+		}
+	}
+	sort.Slice(checksums, func(i, j int) bool { return checksums[i] < checksums[j] })
+
+	for _, index := range checksums {
+		key := dir.Sub("checksums", index)
+		entry.addProblem(StrayKeyProblem, []func(tr fdb.Transaction) error{func(tr fdb.Transaction) error {
+			tr.Clear(key)
+			return nil
+		}}, "stray key %s", describeKey(dir, key.FDBKey()))
+	}
+}
+
+// Returns the length of the content of the chunks, if they are complete
+// without a length to check them against.
+func completeLen(entry *verifiedEntry, indexes []int64, chunkSize int64) (int64, bool) {
+	if chunkSize <= 0 {
+		return 0, false
+	}
+
+	var length int64
+
+	for i, index := range indexes {
+		chunk := entry.chunks[index]
+
+		if index != int64(i) || !chunk.decoded || chunk.len > chunkSize {
+			return 0, false
+		}
+
+		if i < len(indexes)-1 && chunk.len != chunkSize {
+			return 0, false
+		}
+
+		length += chunk.len
+	}
+
+	return length, true
+}
+
+// Returns true if the entry exists and wasn't modified since the given values
+// of the modified keys were read.
+func (store *Store) entryUnmodified(tr fdb.Transaction, entry *verifiedEntry, expected [][]byte) (bool, error) {
+	exists, err := entry.parent.Exists(tr, []string{string(entry.id)})
+	if err != nil || !exists {
+		return false, err
+	}
+
+	modified, err := readModifiedKeys(tr, entry.dir)
+	if err != nil {
+		return false, err
+	}
+
+	return equalValues(modified, expected), nil
+}
+
+// Returns true if the problems include missing, short or corrupt chunks.
+func hasChunkProblems(problems []Problem) bool {
+	for _, problem := range problems {
+		switch problem.Kind {
+		case ChunkCountProblem, ShortChunkProblem, CorruptChunkProblem:
+			return true
+		}
+	}
+
+	return false
+}
+
+// Deletes an upload with inconsistent chunks, unless it was modified since it
+// was verified. The problems are marked as repaired when it is deleted.
+func (store *Store) deleteVerifiedUpload(ctx context.Context, entry *verifiedEntry) error {
+	var deleted bool
+
+	releasing, err := transact(store.db, func(tr fdb.Transaction) (bool, error) {
+		deleted = false
+
+		unmodified, err := store.entryUnmodified(tr, entry, entry.modified)
+		if err != nil || !unmodified {
+			return false, err
+		}
+
+		deleted = true
+
+		return store.abortUploadTx(tr, UploadToken{dir: entry.dir})
+	})
+
+	if err != nil || !deleted {
+		return err
+	}
+
+	for i := range entry.problems {
+		entry.problems[i].Repaired = true
+	}
+
+	if !releasing {
+		return nil
+	}
+
+	return store.releaseDeletedChunks(ctx)
+}
+
+// Repairs the problems of the entry that can be repaired, in batches of chunks
+// per transaction steps. Stops when the entry was modified since it was
+// verified, the problems repaired so far are marked as repaired.
+func (store *Store) repairEntry(ctx context.Context, entry *verifiedEntry) error {
+	if entry.name == UploadsDir && hasChunkProblems(entry.problems) {
+		// Uploads can be uploaded again, so uploads with inconsistent chunks
+		// are deleted
+		return store.deleteVerifiedUpload(ctx, entry)
+	}
+
+	var steps []func(tr fdb.Transaction) error
+	// The number of steps repairing the problems up to and including each
+	// problem
+	ends := make([]int, len(entry.problems))
+
+	for i, problem := range entry.problems {
+		steps = append(steps, problem.repairs...)
+		ends[i] = len(steps)
+	}
+
+	// The repairs can change the length, so the values each batch expects are
+	// the ones left by the previous batch
+	expected := entry.modified
+	done := 0
+
+	for done < len(steps) {
+		err := ctx.Err()
+		if err != nil {
+			return err
+		}
+
+		end := done + store.chunksPerTransaction
+		if end > len(steps) {
+			end = len(steps)
+		}
+
+		var repairedValues [][]byte
+
+		repaired, err := transact(store.db, func(tr fdb.Transaction) (bool, error) {
+			unmodified, err := store.entryUnmodified(tr, entry, expected)
+			if err != nil || !unmodified {
+				// Gone or modified since it was verified
+				return false, err
+			}
+
+			for _, repair := range steps[done:end] {
+				err := repair(tr)
+				if err != nil {
+					return false, err
+				}
+			}
+
+			// Entries without a length get one set by the repairs
+			repairedValues, err = readModifiedKeys(tr, entry.dir)
+
+			return err == nil, err
+		})
+
+		if err != nil {
+			return err
+		}
+
+		if !repaired {
+			break
+		}
+
+		expected = repairedValues
+		done = end
+	}
+
+	for i, problem := range entry.problems {
+		entry.problems[i].Repaired = len(problem.repairs) > 0 && ends[i] <= done
+	}
+
+	return nil
+}
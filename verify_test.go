@@ -0,0 +1,289 @@
+package blobs
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
+)
+
+func problemKinds(report VerifyReport) []ProblemKind {
+	var kinds []ProblemKind
+	for _, problem := range report.Problems {
+		kinds = append(kinds, problem.Kind)
+	}
+	return kinds
+}
+
+func TestVerify(t *testing.T) {
+	input := strings.Repeat("content ", 30)
+
+	createBlob := func(t *testing.T, store *Store) (Id, directory.DirectorySubspace) {
+		blob, err := store.Create(strings.NewReader(input))
+		assert.NoError(t, err)
+
+		blobDir, err := store.openBlobDir(store.db, blob.Id())
+		assert.NoError(t, err)
+
+		return blob.Id(), blobDir
+	}
+
+	modify := func(t *testing.T, store *Store, cb func(tr fdb.Transaction)) {
+		err := updateTransact(store.db, func(tr fdb.Transaction) error {
+			cb(tr)
+			return nil
+		})
+		assert.NoError(t, err)
+	}
+
+	t.Run("reports no problems for a healthy store", func(t *testing.T) {
+		store := createTestStore(WithChunkSize(100), WithDeduplication())
+
+		createBlob(t, store)
+		id, _ := createBlob(t, store)
+		err := store.RemoveBlob(id)
+		assert.NoError(t, err)
+		_, err = store.Upload(strings.NewReader(input))
+		assert.NoError(t, err)
+
+		report, err := store.Verify()
+		assert.NoError(t, err)
+		assert.Equal(t, 1, report.Blobs)
+		assert.Equal(t, 1, report.Uploads)
+		assert.Equal(t, 1, report.RemovedBlobs)
+		assert.Equal(t, 0, len(report.Problems))
+		assert.True(t, report.OK())
+	})
+
+	t.Run("recomputes a missing length from the chunks", func(t *testing.T) {
+		store := createTestStore(WithChunkSize(100))
+		id, blobDir := createBlob(t, store)
+
+		modify(t, store, func(tr fdb.Transaction) {
+			tr.Clear(blobDir.Sub("len"))
+		})
+
+		report, err := store.Verify()
+		assert.NoError(t, err)
+		assert.Equal(t, []ProblemKind{MissingKeyProblem}, problemKinds(report))
+		assert.Equal(t, `missing "len" key`, report.Problems[0].Description)
+		assert.False(t, report.OK())
+
+		report, err = store.Verify(WithRepair())
+		assert.NoError(t, err)
+		assert.True(t, report.Problems[0].Repaired)
+
+		assert.Equal(t, input, readBlob(t, store, id))
+
+		report, err = store.Verify()
+		assert.NoError(t, err)
+		assert.Equal(t, 0, len(report.Problems))
+	})
+
+	t.Run("clears stray keys and chunks beyond the length", func(t *testing.T) {
+		store := createTestStore(WithChunkSize(100))
+		id, blobDir := createBlob(t, store)
+
+		modify(t, store, func(tr fdb.Transaction) {
+			tr.Set(blobDir.Sub("bytes", 5), []byte("stray"))
+			tr.Set(blobDir.Sub("unknown"), []byte("stray"))
+		})
+
+		report, err := store.Verify(WithRepair())
+		assert.NoError(t, err)
+		assert.Equal(t, []ProblemKind{StrayKeyProblem, ChunkCountProblem}, problemKinds(report))
+		assert.True(t, report.OK())
+
+		assert.Equal(t, input, readBlob(t, store, id))
+
+		report, err = store.Verify()
+		assert.NoError(t, err)
+		assert.Equal(t, 0, len(report.Problems))
+	})
+
+	t.Run("reports missing and short chunks", func(t *testing.T) {
+		store := createTestStore(WithChunkSize(100))
+		_, blobDir := createBlob(t, store)
+
+		modify(t, store, func(tr fdb.Transaction) {
+			tr.Set(blobDir.Sub("bytes", 0), []byte("short"))
+			tr.Clear(blobDir.Sub("bytes", 1))
+		})
+
+		report, err := store.Verify(WithRepair())
+		assert.NoError(t, err)
+		assert.Equal(t, []ProblemKind{ShortChunkProblem, CorruptChunkProblem, ChunkCountProblem}, problemKinds(report))
+		assert.Equal(t, "chunk 0 is 5 bytes, expected 100", report.Problems[0].Description)
+		assert.Equal(t, "1 of 3 chunks are missing, the first is chunk 1", report.Problems[2].Description)
+		assert.False(t, report.OK())
+	})
+
+	t.Run("sets a missing removal time", func(t *testing.T) {
+		store := createTestStore(WithChunkSize(100))
+		id, _ := createBlob(t, store)
+
+		err := store.RemoveBlob(id)
+		assert.NoError(t, err)
+
+		removedDir, err := store.openRemovedBlobDir(store.db, id)
+		assert.NoError(t, err)
+
+		modify(t, store, func(tr fdb.Transaction) {
+			tr.Clear(removedDir.Sub("deletedAt"))
+		})
+
+		report, err := store.Verify(WithRepair())
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(report.Problems))
+		assert.Equal(t, RemovedDir, report.Problems[0].Dir)
+		assert.Equal(t, `missing "deletedAt" key`, report.Problems[0].Description)
+		assert.True(t, report.OK())
+	})
+
+	t.Run("deletes broken uploads", func(t *testing.T) {
+		store := createTestStore(WithChunkSize(100))
+
+		token, err := store.Upload(strings.NewReader(input))
+		assert.NoError(t, err)
+
+		modify(t, store, func(tr fdb.Transaction) {
+			tr.Clear(token.dir.Sub("bytes", 0))
+		})
+
+		report, err := store.Verify(WithRepair())
+		assert.NoError(t, err)
+		assert.Equal(t, []ProblemKind{ChunkCountProblem}, problemKinds(report))
+		assert.True(t, report.OK())
+
+		_, err = store.UploadLen(token)
+		assert.True(t, errors.Is(err, UploadNotFoundError))
+	})
+
+	t.Run("repairs uploads with missing metadata in place", func(t *testing.T) {
+		store := createTestStore(WithChunkSize(100))
+
+		token, err := store.Upload(strings.NewReader(input))
+		assert.NoError(t, err)
+
+		modify(t, store, func(tr fdb.Transaction) {
+			tr.Clear(token.dir.Sub("uploadStartedAt"))
+		})
+
+		report, err := store.Verify(WithRepair())
+		assert.NoError(t, err)
+		assert.Equal(t, []ProblemKind{MissingKeyProblem}, problemKinds(report))
+		assert.Equal(t, `missing "uploadStartedAt" key`, report.Problems[0].Description)
+		assert.True(t, report.OK())
+
+		length, err := store.UploadLen(token)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(len(input)), length)
+
+		report, err = store.Verify()
+		assert.NoError(t, err)
+		assert.Equal(t, 0, len(report.Problems))
+	})
+
+	t.Run("doesn't repair entries truncated and appended back since they were verified", func(t *testing.T) {
+		store := createTestStore(WithChunkSize(100))
+		id, blobDir := createBlob(t, store)
+
+		modify(t, store, func(tr fdb.Transaction) {
+			tr.Set(blobDir.Sub("unknown"), []byte("stray"))
+		})
+
+		entry, err := store.readVerifiedEntry(context.Background(), BlobsDir, store.blobsDir, id)
+		assert.NoError(t, err)
+		store.checkEntry(entry)
+		assert.Equal(t, []ProblemKind{StrayKeyProblem}, problemKinds(VerifyReport{Problems: entry.problems}))
+
+		// The blob ends up with the same length
+		err = store.TruncateBlob(id, uint64(len(input)-8))
+		assert.NoError(t, err)
+		_, err = store.AppendBlob(id, strings.NewReader("content "))
+		assert.NoError(t, err)
+
+		err = store.repairEntry(context.Background(), entry)
+		assert.NoError(t, err)
+		assert.False(t, entry.problems[0].Repaired)
+
+		report, err := store.Verify()
+		assert.NoError(t, err)
+		assert.Equal(t, []ProblemKind{StrayKeyProblem}, problemKinds(report))
+	})
+
+	t.Run("reports no problems for copied, named, versioned and modified blobs", func(t *testing.T) {
+		store := createTestStore(WithChunkSize(100))
+		id, _ := createBlob(t, store)
+
+		_, err := store.CopyBlob(id)
+		assert.NoError(t, err)
+
+		token, err := store.Upload(strings.NewReader(input))
+		assert.NoError(t, err)
+		err = updateTransact(store.db, func(tr fdb.Transaction) error {
+			_, err := store.CommitUploadAs(tr, token, "named")
+			return err
+		})
+		assert.NoError(t, err)
+
+		version, err := store.CreateVersion("versioned", strings.NewReader(input))
+		assert.NoError(t, err)
+		_, err = store.AppendBlob(version.Id, strings.NewReader(input))
+		assert.NoError(t, err)
+		err = store.TruncateBlob(version.Id, 150)
+		assert.NoError(t, err)
+
+		err = store.RemoveBlob(id)
+		assert.NoError(t, err)
+		err = store.RestoreBlob(id)
+		assert.NoError(t, err)
+
+		report, err := store.Verify()
+		assert.NoError(t, err)
+		assert.Equal(t, 4, report.Blobs)
+		assert.Equal(t, 0, len(report.Problems))
+	})
+
+	t.Run("repairs entries across transactions", func(t *testing.T) {
+		store := createTestStore(WithChunkSize(10), WithChunksPerTransaction(2), WithDeduplication())
+		id, blobDir := createBlob(t, store)
+
+		var hash, refs []byte
+		modify(t, store, func(tr fdb.Transaction) {
+			hash = tr.Get(blobDir.Sub("hashes", 0)).MustGet()
+			refs = tr.Get(store.chunksDir.Sub("refs", hash)).MustGet()
+
+			for index := 24; index < 30; index++ {
+				tr.Set(blobDir.Sub("hashes", index), hash)
+				tr.Add(store.chunksDir.Sub("refs", hash), encodeUInt64(1))
+			}
+
+			for i := 0; i < 3; i++ {
+				tr.Set(blobDir.Sub("unknown", i), []byte("stray"))
+			}
+		})
+
+		report, err := store.Verify(WithRepair())
+		assert.NoError(t, err)
+		assert.Equal(t, []ProblemKind{StrayKeyProblem, StrayKeyProblem, StrayKeyProblem, ChunkCountProblem}, problemKinds(report))
+		assert.True(t, report.OK())
+
+		assert.Equal(t, input, readBlob(t, store, id))
+
+		report, err = store.Verify()
+		assert.NoError(t, err)
+		assert.Equal(t, 0, len(report.Problems))
+
+		// The references of the cleared chunks are released
+		released, err := readTransact(store.db, func(tr fdb.ReadTransaction) ([]byte, error) {
+			return tr.Get(store.chunksDir.Sub("refs", hash)).Get()
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, refs, released)
+	})
+}
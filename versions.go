@@ -0,0 +1,314 @@
+package blobs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+)
+
+// A version of a versioned key.
+type BlobVersion struct {
+	// The version number, versions of a key are numbered from 1 and up.
+	Version int
+	// The id of the blob holding the content of the version.
+	Id Id
+	// The time the version was committed at.
+	CreatedAt time.Time
+}
+
+// Reads the versions of the key on a transaction, oldest first.
+func (store *Store) versionsTx(tr fdb.ReadTransaction, key string) ([]BlobVersion, error) {
+	versionsSpace := store.versionsDir.Sub(key)
+
+	entries, err := tr.GetRange(versionsSpace, fdb.RangeOptions{}).GetSliceWithError()
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeVersions(versionsSpace, entries)
+}
+
+func decodeVersions(versionsSpace subspace.Subspace, entries []fdb.KeyValue) ([]BlobVersion, error) {
+	versions := make([]BlobVersion, len(entries))
+
+	for i, entry := range entries {
+		k, err := versionsSpace.Unpack(entry.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		v, err := tuple.Unpack(entry.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		versions[i] = BlobVersion{
+			Version:   int(k[0].(int64)),
+			Id:        Id(v[0].(string)),
+			CreatedAt: time.Unix(v[1].(int64), 0),
+		}
+	}
+
+	return versions, nil
+}
+
+// Reads the latest version of the key on a transaction, the version is zero if
+// the key has no versions.
+func (store *Store) latestVersionTx(tr fdb.ReadTransaction, key string) (BlobVersion, error) {
+	versionsSpace := store.versionsDir.Sub(key)
+
+	entries, err := tr.GetRange(versionsSpace, fdb.RangeOptions{
+		Limit:   1,
+		Reverse: true,
+	}).GetSliceWithError()
+
+	if err != nil || len(entries) == 0 {
+		return BlobVersion{}, err
+	}
+
+	versions, err := decodeVersions(versionsSpace, entries)
+	if err != nil {
+		return BlobVersion{}, err
+	}
+
+	return versions[0], nil
+}
+
+// The maximum number of versions removed in a single transaction.
+const pruneBatchSize = 100
+
+// Removes the oldest versions that are no longer retained, at most prune batch
+// size versions, and returns true if there might be more to remove. The latest
+// version is always kept.
+//
+// Versions are removed oldest first until a version that is retained is
+// reached, so only the versions being removed are read. A version is no longer
+// retained when it is max versions or more below the latest version, or older
+// than the max age.
+//
+// The blobs of the removed versions are removed like blobs removed with
+// [Store.RemoveBlob].
+func (store *Store) pruneVersionsTx(tr fdb.Transaction, key string, latest int) (bool, error) {
+	if latest == 0 || (store.maxVersions == 0 && store.versionMaxAge == 0) {
+		return false, nil
+	}
+
+	versionsSpace := store.versionsDir.Sub(key)
+	begin, _ := versionsSpace.FDBRangeKeys()
+
+	entries, err := tr.GetRange(fdb.KeyRange{Begin: begin, End: versionsSpace.Sub(latest)}, fdb.RangeOptions{
+		Limit: pruneBatchSize,
+	}).GetSliceWithError()
+
+	if err != nil {
+		return false, err
+	}
+
+	versions, err := decodeVersions(versionsSpace, entries)
+	if err != nil {
+		return false, err
+	}
+
+	now := store.systemTime.Now()
+
+	for _, version := range versions {
+		tooMany := store.maxVersions > 0 && latest-version.Version >= store.maxVersions
+		tooOld := store.versionMaxAge > 0 && version.CreatedAt.Before(now.Add(-store.versionMaxAge))
+
+		if !tooMany && !tooOld {
+			return false, nil
+		}
+
+		tr.Clear(versionsSpace.Sub(version.Version))
+
+		err := store.RemoveBlobTx(tr, version.Id)
+		if err != nil && !errors.Is(err, BlobNotFoundError) {
+			return false, err
+		}
+	}
+
+	return len(versions) == pruneBatchSize, nil
+}
+
+// Checks that the blob with the given id exists and can be modified.
+//
+// Only the blob of the latest version of a versioned key can be appended to or
+// truncated, modifying an earlier version fails with a [VersionNotLatestError].
+func (store *Store) checkBlobModifiable(rt fdb.ReadTransactor, id Id) error {
+	_, err := rt.ReadTransact(func(tr fdb.ReadTransaction) (any, error) {
+		blobDir, err := store.openBlobDir(tr, id)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := tr.Get(blobDir.Sub("version")).Get()
+		if err != nil || data == nil {
+			return nil, err
+		}
+
+		v, err := tuple.Unpack(data)
+		if err != nil {
+			return nil, err
+		}
+
+		key := v[0].(string)
+		version := v[1].(int64)
+
+		latest, err := tr.GetRange(store.versionsDir.Sub(key), fdb.RangeOptions{
+			Limit:   1,
+			Reverse: true,
+		}).GetSliceWithError()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(latest) == 1 && bytes.Equal(latest[0].Key, store.versionsDir.Sub(key, version).FDBKey()) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("%w: %q is version %d of %q", VersionNotLatestError, id, version, key)
+	})
+
+	return err
+}
+
+// Commits an upload as a new version of the given key on a transaction.
+//
+// The key points to the series of blobs committed as versions of it. Each
+// commit adds a version numbered one higher than the latest version, and
+// versions that are no longer retained are removed, see [WithMaxVersions] and
+// [WithVersionMaxAge]. At most a batch of versions is removed by a commit, use
+// [Store.PruneVersions] to remove the rest. Concurrent commits to the same key
+// conflict, so every version gets a unique number.
+//
+// Only the blob of the latest version can be appended to or truncated.
+func (store *Store) CommitVersion(tr fdb.Transaction, key string, token UploadToken) (BlobVersion, error) {
+	var version BlobVersion
+
+	err := checkKey(key)
+	if err != nil {
+		return version, err
+	}
+
+	id, err := store.CommitUpload(tr, token)
+	if err != nil {
+		return version, err
+	}
+
+	latest, err := store.latestVersionTx(tr, key)
+	if err != nil {
+		return version, err
+	}
+
+	version.Version = latest.Version + 1
+
+	unixTimestamp := store.systemTime.Now().Unix()
+	version.Id = id
+	version.CreatedAt = time.Unix(unixTimestamp, 0)
+
+	tr.Set(store.versionsDir.Sub(key, version.Version), tuple.Tuple{string(id), unixTimestamp}.Pack())
+
+	blobDir, err := store.openBlobDir(tr, id)
+	if err != nil {
+		return version, err
+	}
+
+	tr.Set(blobDir.Sub("version"), tuple.Tuple{key, version.Version}.Pack())
+
+	_, err = store.pruneVersionsTx(tr, key, version.Version)
+
+	return version, err
+}
+
+// Creates a new version of the given key with the content of the reader r.
+//
+// Metadata can be attached to the blob using upload options.
+func (store *Store) CreateVersion(key string, r io.Reader, opts ...UploadOption) (BlobVersion, error) {
+	return store.CreateVersionContext(context.Background(), key, r, opts...)
+}
+
+// Like [Store.CreateVersion], but stops creating the version with the error of
+// the context when it is done. The partial upload is deleted when the context
+// is done.
+func (store *Store) CreateVersionContext(ctx context.Context, key string, r io.Reader, opts ...UploadOption) (BlobVersion, error) {
+	err := checkKey(key)
+	if err != nil {
+		return BlobVersion{}, err
+	}
+
+	token, err := store.UploadContext(ctx, r, opts...)
+	if err != nil {
+		return BlobVersion{}, err
+	}
+
+	err = ctx.Err()
+	if err != nil {
+		return BlobVersion{}, store.abortFailedUpload(token, err)
+	}
+
+	return transact(store.db, func(tr fdb.Transaction) (BlobVersion, error) {
+		return store.CommitVersion(tr, key, token)
+	})
+}
+
+// Returns the retained versions of the given key, oldest first.
+func (store *Store) Versions(key string) ([]BlobVersion, error) {
+	return readTransact(store.db, func(tr fdb.ReadTransaction) ([]BlobVersion, error) {
+		return store.versionsTx(tr, key)
+	})
+}
+
+// Returns the blob of the given version of a key.
+//
+// A [VersionNotFoundError] is returned if the key doesn't have the version, or
+// the version is no longer retained. A [BlobNotFoundError] is returned if the
+// blob of the version was removed.
+func (store *Store) BlobAtVersion(key string, version int) (*Blob, error) {
+	return readTransact(store.db, func(tr fdb.ReadTransaction) (*Blob, error) {
+		data, err := tr.Get(store.versionsDir.Sub(key, version)).Get()
+		if err != nil {
+			return nil, err
+		}
+
+		if data == nil {
+			return nil, fmt.Errorf("%w: %q version %d", VersionNotFoundError, key, version)
+		}
+
+		v, err := tuple.Unpack(data)
+		if err != nil {
+			return nil, err
+		}
+
+		return store.BlobTx(tr, Id(v[0].(string)))
+	})
+}
+
+// Removes the versions of the given key that are no longer retained.
+//
+// This is useful to expire versions using [WithVersionMaxAge] without
+// committing a new version. The versions are removed in batches across
+// multiple transactions.
+func (store *Store) PruneVersions(key string) error {
+	for {
+		more, err := transact(store.db, func(tr fdb.Transaction) (bool, error) {
+			latest, err := store.latestVersionTx(tr, key)
+			if err != nil {
+				return false, err
+			}
+
+			return store.pruneVersionsTx(tr, key, latest.Version)
+		})
+
+		if err != nil || !more {
+			return err
+		}
+	}
+}
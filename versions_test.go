@@ -0,0 +1,148 @@
+package blobs
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestVersions(t *testing.T) {
+	date, _ := time.Parse(time.RFC3339, "2023-01-01T00:00:00Z")
+
+	t.Run("keeps the versions of a key", func(t *testing.T) {
+		store := createTestStore()
+
+		for _, content := range []string{"v1", "v2", "v3"} {
+			_, err := store.CreateVersion("doc", strings.NewReader(content))
+			assert.NoError(t, err)
+		}
+
+		versions, err := store.Versions("doc")
+		assert.NoError(t, err)
+		assert.Equal(t, 3, len(versions))
+
+		for i, version := range versions {
+			assert.Equal(t, i+1, version.Version)
+
+			blob, err := store.BlobAtVersion("doc", version.Version)
+			assert.NoError(t, err)
+			assert.Equal(t, version.Id, blob.Id())
+		}
+
+		assert.Equal(t, "v2", readBlob(t, store, versions[1].Id))
+
+		_, err = store.BlobAtVersion("doc", 4)
+		assert.True(t, errors.Is(err, VersionNotFoundError))
+
+		versions, err = store.Versions("other")
+		assert.NoError(t, err)
+		assert.Equal(t, 0, len(versions))
+	})
+
+	t.Run("removes versions beyond the max versions", func(t *testing.T) {
+		store := createTestStore(WithMaxVersions(2))
+
+		var created []BlobVersion
+		for _, content := range []string{"v1", "v2", "v3"} {
+			version, err := store.CreateVersion("doc", strings.NewReader(content))
+			assert.NoError(t, err)
+			created = append(created, version)
+		}
+
+		versions, err := store.Versions("doc")
+		assert.NoError(t, err)
+		assert.Equal(t, created[1:], versions)
+
+		_, err = store.Blob(created[0].Id)
+		assert.True(t, errors.Is(err, BlobNotFoundError))
+
+		_, err = store.RemovedBlob(created[0].Id)
+		assert.NoError(t, err)
+	})
+
+	t.Run("removes versions older than the max age", func(t *testing.T) {
+		st := &SystemTimeMock{Time: date}
+		store := createTestStore(WithSystemTime(st), WithVersionMaxAge(time.Hour))
+
+		_, err := store.CreateVersion("doc", strings.NewReader("v1"))
+		assert.NoError(t, err)
+		st.Time = date.Add(30 * time.Minute)
+		_, err = store.CreateVersion("doc", strings.NewReader("v2"))
+		assert.NoError(t, err)
+
+		st.Time = date.Add(2 * time.Hour)
+		err = store.PruneVersions("doc")
+		assert.NoError(t, err)
+
+		versions, err := store.Versions("doc")
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(versions))
+		assert.Equal(t, 2, versions[0].Version)
+	})
+
+	t.Run("prunes more versions than a batch across transactions", func(t *testing.T) {
+		store := createTestStore()
+
+		for i := 0; i < pruneBatchSize+5; i++ {
+			_, err := store.CreateVersion("doc", strings.NewReader("content"))
+			assert.NoError(t, err)
+		}
+
+		store.maxVersions = 1
+		err := store.PruneVersions("doc")
+		assert.NoError(t, err)
+
+		versions, err := store.Versions("doc")
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(versions))
+		assert.Equal(t, pruneBatchSize+5, versions[0].Version)
+	})
+
+	t.Run("only the latest version can be modified", func(t *testing.T) {
+		store := createTestStore()
+
+		first, err := store.CreateVersion("doc", strings.NewReader("v1"))
+		assert.NoError(t, err)
+
+		_, err = store.AppendBlob(first.Id, strings.NewReader(" appended"))
+		assert.NoError(t, err)
+
+		second, err := store.CreateVersion("doc", strings.NewReader("v2"))
+		assert.NoError(t, err)
+
+		_, err = store.AppendBlob(first.Id, strings.NewReader(" again"))
+		assert.True(t, errors.Is(err, VersionNotLatestError))
+
+		err = store.TruncateBlob(first.Id, 1)
+		assert.True(t, errors.Is(err, VersionNotLatestError))
+
+		assert.Equal(t, "v1 appended", readBlob(t, store, first.Id))
+
+		err = store.TruncateBlob(second.Id, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, "v", readBlob(t, store, second.Id))
+	})
+
+	t.Run("removed versions aren't found", func(t *testing.T) {
+		store := createTestStore()
+
+		version, err := store.CreateVersion("doc", strings.NewReader("v1"))
+		assert.NoError(t, err)
+
+		err = store.RemoveBlob(version.Id)
+		assert.NoError(t, err)
+
+		_, err = store.BlobAtVersion("doc", version.Version)
+		assert.True(t, errors.Is(err, BlobNotFoundError))
+	})
+
+	t.Run("rejects empty keys", func(t *testing.T) {
+		store := createTestStore()
+
+		_, err := store.CreateVersion("", strings.NewReader("content"))
+		assert.EqualError(t, err, "invalid key, key can't be empty")
+	})
+}